@@ -2,6 +2,7 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,57 +19,131 @@ import (
 
 type Service interface {
 	Username() string
-	GetMe() (*User, error)
-	GetChatMember(params GetChatMemberParams) (*ChatMember, error)
-	GetUpdates(params GetUpdatesParams) ([]Update, error)
-	GetUpdatesChannel() chan Update
-	SendVoice(params SendVoiceParams) (*Message, error)
-	SendPoll(params SendPollParams) (*Message, error)
-	SendMessage(params SendMessageParams) (*Message, error)
-	EditMessageText(params EditMessageTextParams) (*Message, error)
-	AnswerInlineQuery(params AnswerInlineQueryParams) error
-	SendDocument(params SendDocumentParams) error
+	GetMe(ctx context.Context) (*User, error)
+	GetChatMember(ctx context.Context, params GetChatMemberParams) (*ChatMember, error)
+	GetUpdates(ctx context.Context, params GetUpdatesParams) ([]Update, error)
+	GetUpdatesChannel(ctx context.Context, handled func() int) chan Update
+	CommitUpdates(ctx context.Context, offset int) error
+	SetWebhook(ctx context.Context, params SetWebhookParams) error
+	DeleteWebhook(ctx context.Context, params DeleteWebhookParams) error
+	SendVoice(ctx context.Context, params SendVoiceParams) (*Message, error)
+	SendPoll(ctx context.Context, params SendPollParams) (*Message, error)
+	SendMessage(ctx context.Context, params SendMessageParams) (*Message, error)
+	EditMessageText(ctx context.Context, params EditMessageTextParams) (*Message, error)
+	AnswerInlineQuery(ctx context.Context, params AnswerInlineQueryParams) error
+	AnswerCallbackQuery(ctx context.Context, params AnswerCallbackQueryParams) error
+	SetMyCommands(ctx context.Context, params SetMyCommandsParams) error
+	SendDocument(ctx context.Context, params SendDocumentParams) error
 }
 
 type service struct {
-	retry    util.Retry
-	token    string
-	username string
-	baseURL  string
-	client   http.Client
+	retry     util.Retry
+	scheduler *scheduler
+	token     string
+	username  string
+	baseURL   string
+	client    http.Client
 }
 
 var _ Service = &service{}
 
-func NewService(token string) Service {
-	return &service{
+// AllowedUpdates are the update types the bot asks Telegram for, both when
+// polling and when receiving updates through a webhook.
+var AllowedUpdates = []string{"message", "edited_message", "poll", "poll_answer", "callback_query", "inline_query"}
+
+// Option changes the defaults of NewService.
+type Option func(s *service)
+
+// WithBaseURL makes the service call another Bot API server, like a local
+// one or a bottest.Server. The token and method are appended to url.
+func WithBaseURL(url string) Option {
+	return func(s *service) {
+		s.baseURL = url
+	}
+}
+
+// WithLimits replaces DefaultLimits. Zero rates aren't limited.
+func WithLimits(limits Limits) Option {
+	return func(s *service) {
+		s.scheduler = newScheduler(limits)
+	}
+}
+
+func NewService(token string, opts ...Option) Service {
+	s := &service{
 		token:   token,
 		baseURL: "https://api.telegram.org/bot",
 		retry: util.Retry{
 			MaxAttempts: 3,
+			DelayFactor: 2,
 			Delay:       time.Second,
+			// a chat flooded for longer fails instead of holding the
+			// handler
+			MaxWait: time.Minute,
 		},
+		scheduler: newScheduler(DefaultLimits),
 		client: http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func apiJSONRequest[T any](bot *service, path string, data any) (res Result[T], err error) {
-	u := bot.baseURL + bot.token + "/" + path
-
+// apiJSONRequest calls the Bot API method at path. Requests that send
+// something to a chat must pass its chatID so they go through the
+// scheduler, the others pass 0.
+func apiJSONRequest[T any](ctx context.Context, bot *service, chatID int64, path string, data any) (res Result[T], err error) {
 	var reqBody []byte
-	var reqReader io.Reader
-
 	if data != nil {
 		reqBody, err = json.Marshal(data)
 		if err != nil {
 			return
 		}
+	}
+
+	err = bot.retry.Do(ctx, func() error {
+		if chatID != 0 {
+			err := bot.scheduler.wait(ctx, chatID)
+			if err != nil {
+				return util.Permanent(err)
+			}
+		}
+
+		res, err = doJSONRequest[T](ctx, bot, path, reqBody)
+
+		var botErr BotError
+		if !errors.As(err, &botErr) {
+			return err
+		}
+		if botErr.RetryAfter() > 0 {
+			d := time.Duration(botErr.RetryAfter()) * time.Second
+			if chatID != 0 {
+				// Only this chat is held; other chats keep sending.
+				// Requests without a chat only wait themselves.
+				bot.scheduler.hold(chatID, d)
+			}
+			return util.RetryAfter(err, d)
+		}
+		if botErr.Status < 500 {
+			return util.Permanent(err)
+		}
+		return err
+	})
+	return
+}
+
+func doJSONRequest[T any](ctx context.Context, bot *service, path string, reqBody []byte) (res Result[T], err error) {
+	u := bot.baseURL + bot.token + "/" + path
+
+	var reqReader io.Reader
+	if reqBody != nil {
 		reqReader = bytes.NewReader(reqBody)
 	}
 
-	req, err := http.NewRequest("POST", u, reqReader)
+	req, err := http.NewRequestWithContext(ctx, "POST", u, reqReader)
 	if err != nil {
 		err = errors.New(bot.hideToken(err.Error()))
 		return
@@ -76,12 +151,7 @@ func apiJSONRequest[T any](bot *service, path string, data any) (res Result[T],
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 
-	var resp *http.Response
-	err = bot.retry.Do(func() error {
-		resp, err = bot.client.Do(req)
-		return err
-	})
-
+	resp, err := bot.client.Do(req)
 	if err != nil {
 		err = errors.New(bot.hideToken(err.Error()))
 		return
@@ -89,15 +159,18 @@ func apiJSONRequest[T any](bot *service, path string, data any) (res Result[T],
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		err = bot.respError(resp, reqBody, respBody)
+	if err != nil {
 		return
 	}
-	if err != nil {
+
+	// Telegram describes failures in the body, even for 4xx and 5xx statuses
+	jsonErr := json.Unmarshal(respBody, &res)
+	if resp.StatusCode >= 400 || (jsonErr == nil && !res.Ok) {
+		err = bot.respError(resp, reqBody, respBody)
 		return
 	}
 
-	err = json.Unmarshal(respBody, &res)
+	err = jsonErr
 	return
 }
 
@@ -105,72 +178,185 @@ func (s *service) Username() string {
 	return s.username
 }
 
-func (s *service) GetMe() (*User, error) {
-	res, err := apiJSONRequest[User](s, "getMe", nil)
+func (s *service) GetMe(ctx context.Context) (*User, error) {
+	res, err := apiJSONRequest[User](ctx, s, 0, "getMe", nil)
 	s.username = res.Result.Username
 	return &res.Result, err
 }
 
-func (s *service) GetChatMember(params GetChatMemberParams) (*ChatMember, error) {
-	res, err := apiJSONRequest[ChatMember](s, "getMe", params)
+func (s *service) GetChatMember(ctx context.Context, params GetChatMemberParams) (*ChatMember, error) {
+	res, err := apiJSONRequest[ChatMember](ctx, s, 0, "getChatMember", params)
 	return &res.Result, err
 }
 
-func (s *service) GetUpdates(params GetUpdatesParams) ([]Update, error) {
-	res, err := apiJSONRequest[[]Update](s, "getUpdates", params)
+func (s *service) GetUpdates(ctx context.Context, params GetUpdatesParams) ([]Update, error) {
+	res, err := apiJSONRequest[[]Update](ctx, s, 0, "getUpdates", params)
 	return res.Result, err
 }
 
-func (s *service) GetUpdatesChannel() chan Update {
+// pendingPollDelay is the most to wait before polling again when Telegram
+// sends only updates still being handled. The poll is sooner if one of
+// them finishes.
+const pendingPollDelay = time.Second
+
+// pollLimit is how many updates each poll gets, the most Telegram allows.
+const pollLimit = 100
+
+// GetUpdatesChannel polls updates until ctx is done, then closes the channel.
+// Telegram is only told updates before handled() were handled, the offset of
+// the first one not handled yet, so the pending ones are sent again after a
+// restart. With a nil handled, every update on the channel is confirmed.
+//
+// When a slow handler holds back a whole page of updates already sent on
+// the channel, the page is confirmed to get to the new ones, so the bot
+// keeps listening to the other chats.
+func (s *service) GetUpdatesChannel(ctx context.Context, handled func() int) chan Update {
 	ch := make(chan Update)
 	go func() {
-		updateID := 0
+		defer close(ch)
+		// the first update not sent on the channel yet
+		next := 0
+		// a whole page was held back by the pending updates
+		blocked := false
 		for {
+			offset := next
+			if handled != nil && next != 0 && !blocked {
+				if h := handled(); h != 0 && h < next {
+					offset = h
+				}
+			}
+
+			blocked = false
+
 			params := GetUpdatesParams{
-				Offset:         updateID,
+				Offset:         offset,
+				Limit:          pollLimit,
 				Timeout:        5,
-				AllowedUpdates: []string{"message", "poll", "poll_answer", "callback_query", "inline_query"},
+				AllowedUpdates: AllowedUpdates,
+			}
+			updates, err := s.GetUpdates(ctx, params)
+			if ctx.Err() != nil {
+				return
 			}
-			updates, err := s.GetUpdates(params)
 			if err != nil {
 				log.Print(s.hideToken(err.Error()))
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
 			}
+
+			sent := 0
 			for _, u := range updates {
-				updateID = u.UpdateID + 1
-				ch <- u
+				if u.UpdateID < next {
+					// still being handled
+					continue
+				}
+				select {
+				case ch <- u:
+					next = u.UpdateID + 1
+					sent++
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			switch {
+			case len(updates) == pollLimit && sent == 0:
+				log.Printf("updates from %d still being handled, confirming them to get the next ones", offset)
+				blocked = true
+			case len(updates) > 0 && sent == 0:
+				// polling again would get the same updates right away
+				waitHandled(ctx, handled, offset)
 			}
-			time.Sleep(time.Second)
 		}
 	}()
 	return ch
 }
 
-func (s *service) SendVoice(params SendVoiceParams) (*Message, error) {
-	res, err := apiJSONRequest[Message](s, "sendVoice", params)
+// waitHandled waits until handled() moves from offset, up to
+// pendingPollDelay.
+func waitHandled(ctx context.Context, handled func() int, offset int) {
+	ticker := time.NewTicker(pendingPollDelay / 20)
+	defer ticker.Stop()
+	deadline := time.After(pendingPollDelay)
+	for {
+		select {
+		case <-ticker.C:
+			if handled() != offset {
+				return
+			}
+		case <-deadline:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CommitUpdates confirms every update with an ID lower than offset, so
+// Telegram won't send them again.
+func (s *service) CommitUpdates(ctx context.Context, offset int) error {
+	// an update is confirmed as soon as getUpdates is called with a higher offset
+	_, err := s.GetUpdates(ctx, GetUpdatesParams{
+		Offset: offset,
+		Limit:  1,
+	})
+	return err
+}
+
+func (s *service) SetWebhook(ctx context.Context, params SetWebhookParams) error {
+	_, err := apiJSONRequest[bool](ctx, s, 0, "setWebhook", params)
+	return err
+}
+
+func (s *service) DeleteWebhook(ctx context.Context, params DeleteWebhookParams) error {
+	_, err := apiJSONRequest[bool](ctx, s, 0, "deleteWebhook", params)
+	return err
+}
+
+func (s *service) SendVoice(ctx context.Context, params SendVoiceParams) (*Message, error) {
+	res, err := apiJSONRequest[Message](ctx, s, params.ChatID, "sendVoice", params)
 	return &res.Result, err
 }
 
-func (s *service) SendPoll(params SendPollParams) (*Message, error) {
-	res, err := apiJSONRequest[Message](s, "sendPoll", params)
+func (s *service) SendPoll(ctx context.Context, params SendPollParams) (*Message, error) {
+	res, err := apiJSONRequest[Message](ctx, s, params.ChatID, "sendPoll", params)
 	return &res.Result, err
 }
 
-func (s *service) SendMessage(params SendMessageParams) (*Message, error) {
-	res, err := apiJSONRequest[Message](s, "sendMessage", params)
+func (s *service) SendMessage(ctx context.Context, params SendMessageParams) (*Message, error) {
+	res, err := apiJSONRequest[Message](ctx, s, params.ChatID, "sendMessage", params)
 	return &res.Result, err
 }
 
-func (s *service) EditMessageText(params EditMessageTextParams) (*Message, error) {
-	res, err := apiJSONRequest[Message](s, "editMessageText", params)
+func (s *service) EditMessageText(ctx context.Context, params EditMessageTextParams) (*Message, error) {
+	res, err := apiJSONRequest[Message](ctx, s, params.ChatID, "editMessageText", params)
 	return &res.Result, err
 }
 
-func (s *service) AnswerInlineQuery(params AnswerInlineQueryParams) error {
-	_, err := apiJSONRequest[bool](s, "answerInlineQuery", params)
+func (s *service) AnswerInlineQuery(ctx context.Context, params AnswerInlineQueryParams) error {
+	_, err := apiJSONRequest[bool](ctx, s, 0, "answerInlineQuery", params)
+	return err
+}
+
+func (s *service) AnswerCallbackQuery(ctx context.Context, params AnswerCallbackQueryParams) error {
+	_, err := apiJSONRequest[bool](ctx, s, 0, "answerCallbackQuery", params)
 	return err
 }
 
-func (s *service) SendDocument(params SendDocumentParams) error {
+func (s *service) SetMyCommands(ctx context.Context, params SetMyCommandsParams) error {
+	_, err := apiJSONRequest[bool](ctx, s, 0, "setMyCommands", params)
+	return err
+}
+
+func (s *service) SendDocument(ctx context.Context, params SendDocumentParams) error {
+	err := s.scheduler.wait(ctx, params.ChatID)
+	if err != nil {
+		return err
+	}
+
 	f, err := os.Open(params.FileName)
 	if err != nil {
 		return err
@@ -201,7 +387,7 @@ func (s *service) SendDocument(params SendDocumentParams) error {
 	}
 
 	u := s.baseURL + s.token + "/sendDocument"
-	req, err := http.NewRequest("POST", u, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", u, body)
 	if err != nil {
 		return err
 	}
@@ -214,13 +400,17 @@ func (s *service) SendDocument(params SendDocumentParams) error {
 	}
 	defer resp.Body.Close()
 
-	var res Result[any]
-	err = json.NewDecoder(resp.Body).Decode(&res)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	var res Result[any]
+	jsonErr := json.Unmarshal(respBody, &res)
+	if resp.StatusCode >= 400 || (jsonErr == nil && !res.Ok) {
+		return s.respError(resp, nil, respBody)
+	}
+	return jsonErr
 }
 
 func (s *service) hideToken(str string) string {
@@ -233,22 +423,12 @@ func (s *service) respError(resp *http.Response, reqBody []byte, respBody []byte
 	err.Status = resp.StatusCode
 	err.RequestBody = reqBody
 	err.ResponseBody = respBody
-	return err
-}
-
-type BotError struct {
-	Path         string
-	Status       int
-	RequestBody  []byte
-	ResponseBody []byte
-}
 
-func (e BotError) Error() string {
-	return fmt.Sprintf(
-		"POST %s\n%s\n\nStatus %s\n\n%s",
-		e.Path,
-		string(e.RequestBody),
-		http.StatusText(e.Status),
-		string(e.ResponseBody),
-	)
+	var res Result[json.RawMessage]
+	if json.Unmarshal(respBody, &res) == nil {
+		err.ErrorCode = res.ErrorCode
+		err.Description = res.Description
+		err.Parameters = res.Parameters
+	}
+	return err
 }
@@ -1,16 +1,19 @@
 package bothandler
 
 import (
+	"context"
 	"errors"
 	"log"
 	"regexp"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/igoracmelo/euperturbot/bot"
 )
 
-type HandlerFunc func(s bot.Service, u bot.Update) error
+type HandlerFunc func(ctx context.Context, s bot.Service, u bot.Update) error
 type Middleware = func(next HandlerFunc) HandlerFunc
 type CriteriaFunc func(s bot.Service, u bot.Update) bool
 
@@ -42,6 +45,16 @@ var AnyText CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	return u.Message != nil && u.Message.Text != ""
 }
 
+// AnyEditedText matches the edits of text messages. Telegram sends the
+// whole message again, with the new text.
+var AnyEditedText CriteriaFunc = func(s bot.Service, u bot.Update) bool {
+	return u.EditedMessage != nil && u.EditedMessage.Text != ""
+}
+
+var ChatMigrated CriteriaFunc = func(s bot.Service, u bot.Update) bool {
+	return u.Message != nil && u.Message.MigrateToChatID != 0
+}
+
 var AnyCommand CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	if u.Message == nil {
 		return false
@@ -71,39 +84,97 @@ var AnyInlineQuery CriteriaFunc = func(s bot.Service, u bot.Update) bool {
 	return u.InlineQuery != nil
 }
 
+// DefaultTimeout is how long a handler has to process an update.
+const DefaultTimeout = 2 * time.Minute
+
+// DefaultShutdownTimeout is how long Start waits for running handlers
+// once it stops receiving updates.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// cancelTimeout is how long Start waits for the handlers to return once
+// their contexts are cancelled on shutdown.
+const cancelTimeout = 5 * time.Second
+
+const (
+	DefaultWorkers    = 10
+	DefaultQueueSize  = 100
+	DefaultLagWarning = 5 * time.Second
+)
+
 type UpdateController struct {
-	source   <-chan bot.Update
-	bot      bot.Service
-	handlers []struct {
-		criteria CriteriaFunc
-		fn       HandlerFunc
-	}
+	// Timeout is the deadline of the context passed to each handler, unless
+	// changed by the Timeout middleware
+	Timeout time.Duration
+	// ShutdownTimeout is how long to wait for running handlers on shutdown,
+	// before cancelling their contexts
+	ShutdownTimeout time.Duration
+	// Workers is how many updates are handled in parallel. Updates from the
+	// same chat are handled one at a time, in order, so a slow chat holds
+	// only one worker. DefaultWorkers if less than 1.
+	Workers int
+	// QueueSize is how many updates wait for a worker before Start blocks.
+	// DefaultQueueSize if less than 1.
+	QueueSize int
+	// LagWarning logs updates that waited longer than this in the queue
+	LagWarning time.Duration
+
+	// Source is where Start reads the updates from
+	Source <-chan bot.Update
+
+	bot         bot.Service
+	handlers    []handler
 	middlewares []Middleware
+
+	mut     sync.Mutex
+	pending map[int]struct{}
+	lastID  int
+	expired bool
+	stats   Stats
 }
 
 func NewUpdateHandler(s bot.Service, source <-chan bot.Update) *UpdateController {
 	return &UpdateController{
-		source: source,
-		bot:    s,
+		Timeout:         DefaultTimeout,
+		ShutdownTimeout: DefaultShutdownTimeout,
+		Workers:         DefaultWorkers,
+		QueueSize:       DefaultQueueSize,
+		LagWarning:      DefaultLagWarning,
+		Source:          source,
+		bot:             s,
+		pending:         map[int]struct{}{},
 	}
 }
 
-func (uc *UpdateController) Middleware(mw Middleware, criterias ...CriteriaFunc) {
-	criteria := func(s bot.Service, u bot.Update) bool {
-		for _, c := range criterias {
-			if !c(s, u) {
-				return false
-			}
+type handler struct {
+	criteria    CriteriaFunc
+	fn          HandlerFunc
+	middlewares []Middleware
+}
+
+// Chain composes middlewares so they run in the given order, the first one
+// being the outermost.
+func Chain(mws ...Middleware) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
 		}
-		return true
+		return next
 	}
+}
+
+// Middleware registers a middleware that wraps every handler, but only runs
+// for updates matching all the criterias. Middlewares run in the order they
+// were registered, before the ones of groups and handlers.
+func (uc *UpdateController) Middleware(mw Middleware, criterias ...CriteriaFunc) {
+	criteria := And(criterias...)
 
 	_mw := func(hf HandlerFunc) HandlerFunc {
-		return func(s bot.Service, u bot.Update) error {
+		wrapped := mw(hf)
+		return func(ctx context.Context, s bot.Service, u bot.Update) error {
 			if criteria(s, u) {
-				return mw(hf)(s, u)
+				return wrapped(ctx, s, u)
 			} else {
-				return hf(s, u)
+				return hf(ctx, s, u)
 			}
 		}
 	}
@@ -111,60 +182,253 @@ func (uc *UpdateController) Middleware(mw Middleware, criterias ...CriteriaFunc)
 	uc.middlewares = append(uc.middlewares, _mw)
 }
 
-func (uh *UpdateController) Handle(criteria CriteriaFunc, fn func(s bot.Service, u bot.Update) error) {
-	uh.handlers = append(uh.handlers, struct {
-		criteria CriteriaFunc
-		fn       HandlerFunc
-	}{
-		criteria,
-		fn,
+// Handle registers fn to handle the updates matching criteria, wrapped by
+// mws. Only the first matching handler runs.
+func (uh *UpdateController) Handle(criteria CriteriaFunc, fn HandlerFunc, mws ...Middleware) {
+	uh.handlers = append(uh.handlers, handler{
+		criteria:    criteria,
+		fn:          fn,
+		middlewares: mws,
 	})
 }
 
-func (uh *UpdateController) Start() {
-	limit := make(chan struct{}, 10)
-	for update := range uh.source {
-		for _, handler := range uh.handlers {
-			handler := handler
-			update := update
-			if !handler.criteria(uh.bot, update) {
-				continue
-			}
+// Group returns a group whose handlers share mws, like a set of
+// admin-only commands.
+func (uh *UpdateController) Group(mws ...Middleware) *Group {
+	return &Group{
+		uh:          uh,
+		middlewares: mws,
+	}
+}
 
-			fn := handler.fn
-			for _, mw := range uh.middlewares {
-				fn = mw(handler.fn)
-			}
+type Group struct {
+	uh          *UpdateController
+	middlewares []Middleware
+}
+
+// Handle registers fn on the controller, wrapped by the group middlewares
+// and then by mws.
+func (g *Group) Handle(criteria CriteriaFunc, fn HandlerFunc, mws ...Middleware) {
+	all := append(append([]Middleware{}, g.middlewares...), mws...)
+	g.uh.Handle(criteria, fn, all...)
+}
+
+// Group returns a subgroup that runs the middlewares of g before mws.
+func (g *Group) Group(mws ...Middleware) *Group {
+	return &Group{
+		uh:          g.uh,
+		middlewares: append(append([]Middleware{}, g.middlewares...), mws...),
+	}
+}
+
+// Start handles updates until the source is closed or ctx is done. Then it
+// waits up to ShutdownTimeout for the queued and running handlers before
+// cancelling their contexts, and a little more for them to return.
+func (uh *UpdateController) Start(ctx context.Context) {
+	handlerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-			limit <- struct{}{}
-			go func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Print("handler panic recovered: ", r)
-						debug.PrintStack()
-					}
-				}()
-				defer func() {
-					<-limit
-				}()
-				log.Print(update)
-				err := fn(uh.bot, update)
-
-				var reply Reply
-				if errors.As(err, &reply) {
-					_, err = uh.bot.SendMessage(bot.SendMessageParams{
-						ChatID:                   update.Message.Chat.ID,
-						ReplyToMessageID:         update.Message.MessageID,
-						AllowSendingWithoutReply: true,
-						Text:                     reply.Text,
-						ParseMode:                reply.ParseMode,
-					})
-				}
-				if err != nil {
-					log.Print(err)
-				}
-			}()
+	wg := sync.WaitGroup{}
+	queues := newChatQueues(uh.queueSize())
+	for i := 0; i < uh.workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uh.work(handlerCtx, queues)
+		}()
+	}
+
+loop:
+	for {
+		var update bot.Update
+		var ok bool
+		select {
+		case update, ok = <-uh.Source:
+		case <-ctx.Done():
+		}
+		if !ok {
 			break
 		}
+
+		uh.begin(update.UpdateID)
+
+		uh.enqueued(1)
+		if !queues.push(ctx, queuedUpdate{update, time.Now()}) {
+			// never queued, so it stays pending and isn't committed
+			uh.enqueued(-1)
+			break loop
+		}
+	}
+	queues.close()
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(uh.ShutdownTimeout):
+		log.Print("shutdown timeout: cancelling running handlers")
+		// cancelled handlers didn't finish their work, keep them pending
+		uh.mut.Lock()
+		uh.expired = true
+		uh.mut.Unlock()
+		cancel()
+
+		// they may still be using what is closed after Start returns, like
+		// the database, so give them a moment to see the cancel
+		select {
+		case <-finished:
+		case <-time.After(cancelTimeout):
+			log.Print("handlers still running after cancelled")
+		}
+	}
+
+	stats := uh.Stats()
+	log.Printf("handled %d updates, queue lag avg %s, max %s", stats.Handled, stats.AvgLag(), stats.MaxLag)
+}
+
+func (uh *UpdateController) workers() int {
+	if uh.Workers < 1 {
+		return DefaultWorkers
+	}
+	return uh.Workers
+}
+
+func (uh *UpdateController) queueSize() int {
+	if uh.QueueSize < 1 {
+		return DefaultQueueSize
+	}
+	return uh.QueueSize
+}
+
+// HandleUpdate handles u in the calling goroutine, without the queues of
+// Start. Meant for tests and replays, where the order must be exact.
+func (uh *UpdateController) HandleUpdate(ctx context.Context, u bot.Update) {
+	fn := uh.handlerFor(u)
+	if fn != nil {
+		uh.run(ctx, fn, u)
+	}
+}
+
+// Offset is the offset to commit the handled updates with. Every update
+// with a lower ID was handled, so it is safe to confirm them.
+func (uh *UpdateController) Offset() int {
+	uh.mut.Lock()
+	defer uh.mut.Unlock()
+
+	if len(uh.pending) == 0 {
+		if uh.lastID == 0 {
+			return 0
+		}
+		return uh.lastID + 1
+	}
+
+	offset := 0
+	for id := range uh.pending {
+		if offset == 0 || id < offset {
+			offset = id
+		}
+	}
+	return offset
+}
+
+func (uh *UpdateController) begin(updateID int) {
+	uh.mut.Lock()
+	defer uh.mut.Unlock()
+	uh.pending[updateID] = struct{}{}
+	if updateID > uh.lastID {
+		uh.lastID = updateID
+	}
+}
+
+func (uh *UpdateController) done(updateID int) {
+	uh.mut.Lock()
+	defer uh.mut.Unlock()
+	if !uh.expired {
+		delete(uh.pending, updateID)
+	}
+}
+
+// handlerFor returns the first handler matching the update, wrapped by
+// the middlewares, or nil if there is none.
+func (uh *UpdateController) handlerFor(update bot.Update) HandlerFunc {
+	for _, handler := range uh.handlers {
+		if !handler.criteria(uh.bot, update) {
+			continue
+		}
+
+		mws := append(append([]Middleware{}, uh.middlewares...), handler.middlewares...)
+		return Chain(mws...)(handler.fn)
+	}
+	return nil
+}
+
+func (uh *UpdateController) run(ctx context.Context, fn HandlerFunc, update bot.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Print("handler panic recovered: ", r)
+			debug.PrintStack()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(uh.Timeout, cancel)
+	defer timer.Stop()
+	ctx = context.WithValue(ctx, timerKey{}, timer)
+
+	log.Print(update)
+	err := fn(ctx, uh.bot, update)
+
+	var reply Reply
+	if errors.As(err, &reply) {
+		msg := replyTo(update)
+		if msg == nil {
+			log.Printf("no message to reply %q to", reply.Text)
+			return
+		}
+		_, err = uh.bot.SendMessage(ctx, bot.SendMessageParams{
+			ChatID:                   msg.Chat.ID,
+			ReplyToMessageID:         msg.MessageID,
+			AllowSendingWithoutReply: true,
+			Text:                     reply.Text,
+			ParseMode:                reply.ParseMode,
+		})
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+type timerKey struct{}
+
+// Timeout gives the handler d to run from now, instead of the Timeout of
+// the controller, as for commands that take longer than the others.
+func Timeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, s bot.Service, u bot.Update) error {
+			if timer, ok := ctx.Value(timerKey{}).(*time.Timer); ok && ctx.Err() == nil {
+				timer.Reset(d)
+			}
+			return next(ctx, s, u)
+		}
+	}
+}
+
+// replyTo is the message a Reply to the update is sent to. For callback
+// queries, it's the message with the button.
+func replyTo(update bot.Update) *bot.Message {
+	if update.Message != nil {
+		return update.Message
+	}
+	if update.EditedMessage != nil {
+		return update.EditedMessage
+	}
+	if update.CallbackQuery != nil {
+		return update.CallbackQuery.Message
 	}
+	return nil
 }
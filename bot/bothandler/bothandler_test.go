@@ -0,0 +1,504 @@
+package bothandler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/bot/bottest"
+)
+
+type fakeBot struct {
+	bot.Service
+	mut      sync.Mutex
+	sent     []bot.SendMessageParams
+	answered []bot.AnswerCallbackQueryParams
+}
+
+func (b *fakeBot) Username() string {
+	return "bot"
+}
+
+func (b *fakeBot) SendMessage(ctx context.Context, params bot.SendMessageParams) (*bot.Message, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.sent = append(b.sent, params)
+	return &bot.Message{MessageID: 1000 + len(b.sent)}, nil
+}
+
+func (b *fakeBot) AnswerCallbackQuery(ctx context.Context, params bot.AnswerCallbackQueryParams) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.answered = append(b.answered, params)
+	return nil
+}
+
+func textUpdate(id int, text string) bot.Update {
+	return bot.Update{
+		UpdateID: id,
+		Message: &bot.Message{
+			MessageID: id,
+			Text:      text,
+			Chat:      &bot.Chat{ID: 1},
+			From:      &bot.User{ID: 1},
+		},
+	}
+}
+
+func TestStartWaitsRunningHandlers(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := false
+
+	uh.Handle(AnyText, func(ctx context.Context, s bot.Service, u bot.Update) error {
+		close(started)
+		<-release
+		finished = true
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		uh.Start(ctx)
+		close(stopped)
+	}()
+
+	source <- textUpdate(10, "oi")
+	<-started
+	cancel()
+
+	select {
+	case <-stopped:
+		t.Fatal("Start returned before the handler finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-stopped
+
+	if !finished {
+		t.Fatal("want handler to finish")
+	}
+	if got := uh.Offset(); got != 11 {
+		t.Fatalf("offset - want: %d, got: %d", 11, got)
+	}
+}
+
+func TestOffsetKeepsUnfinishedUpdates(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	uh.ShutdownTimeout = 10 * time.Millisecond
+
+	var returned atomic.Bool
+	uh.Handle(Command("lento"), func(ctx context.Context, s bot.Service, u bot.Update) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		returned.Store(true)
+		return nil
+	})
+	uh.Handle(AnyText, func(ctx context.Context, s bot.Service, u bot.Update) error {
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		uh.Start(ctx)
+		close(stopped)
+	}()
+
+	source <- textUpdate(1, "oi")
+	source <- textUpdate(2, "/lento")
+	source <- textUpdate(3, "oi")
+	cancel()
+	<-stopped
+
+	// update 2 didn't finish in time, so it must be delivered again
+	if got := uh.Offset(); got != 2 {
+		t.Fatalf("offset - want: %d, got: %d", 2, got)
+	}
+	// but Start waited for it to return once cancelled
+	if !returned.Load() {
+		t.Fatal("Start returned before the cancelled handler")
+	}
+}
+
+func TestRestartDeliversPendingAgain(t *testing.T) {
+	srv := bottest.NewServer()
+	defer srv.Close()
+	s := srv.Service()
+
+	// the first run stops while /lento is running, after the poll that
+	// follows the last update
+	uh := NewUpdateHandler(s, nil)
+	uh.ShutdownTimeout = 10 * time.Millisecond
+	started := make(chan struct{})
+	handled := make(chan struct{})
+	uh.Handle(Command("lento"), func(ctx context.Context, s bot.Service, u bot.Update) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	uh.Handle(AnyText, func(ctx context.Context, s bot.Service, u bot.Update) error {
+		if u.Message.Text == "depois" {
+			close(handled)
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	uh.Source = s.GetUpdatesChannel(ctx, uh.Offset)
+	stopped := make(chan struct{})
+	go func() {
+		uh.Start(ctx)
+		close(stopped)
+	}()
+
+	chat := bot.Chat{ID: 1}
+	from := bot.User{ID: 1}
+	srv.SendText(chat, from, "antes")
+	srv.SendText(chat, from, "/lento")
+	srv.SendText(bot.Chat{ID: 2}, from, "depois")
+	<-started
+	<-handled
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	<-stopped
+	err := s.CommitUpdates(context.Background(), uh.Offset())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next run gets /lento again, and only what came after it
+	var mut sync.Mutex
+	var texts []string
+	uh = NewUpdateHandler(s, nil)
+	uh.Handle(AnyText, func(ctx context.Context, s bot.Service, u bot.Update) error {
+		mut.Lock()
+		defer mut.Unlock()
+		texts = append(texts, u.Message.Text)
+		return nil
+	})
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	uh.Source = s.GetUpdatesChannel(ctx, uh.Offset)
+	go uh.Start(ctx)
+
+	ok := srv.WaitFor(func() bool {
+		mut.Lock()
+		defer mut.Unlock()
+		return len(texts) == 2
+	}, 2*time.Second)
+	mut.Lock()
+	defer mut.Unlock()
+	// from different chats, so in any order
+	sort.Strings(texts)
+	if !ok || texts[0] != "/lento" || texts[1] != "depois" {
+		t.Fatalf("want /lento and the update after it again, got: %q", texts)
+	}
+}
+
+func TestSlowHandlerDoesNotStopPolling(t *testing.T) {
+	srv := bottest.NewServer()
+	defer srv.Close()
+	s := srv.Service()
+
+	uh := NewUpdateHandler(s, nil)
+	uh.ShutdownTimeout = 10 * time.Millisecond
+	handled := make(chan struct{})
+	uh.Handle(Command("lento"), func(ctx context.Context, s bot.Service, u bot.Update) error {
+		<-ctx.Done()
+		return nil
+	})
+	uh.Handle(AnyText, func(ctx context.Context, s bot.Service, u bot.Update) error {
+		if u.Message.Text == "depois" {
+			close(handled)
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	uh.Source = s.GetUpdatesChannel(ctx, uh.Offset)
+	go uh.Start(ctx)
+
+	// /lento holds more than a poll of updates behind it
+	from := bot.User{ID: 1}
+	srv.SendText(bot.Chat{ID: 1}, from, "/lento")
+	for i := 0; i < 100; i++ {
+		srv.SendText(bot.Chat{ID: 2}, from, "oi")
+	}
+	srv.SendText(bot.Chat{ID: 2}, from, "depois")
+
+	select {
+	case <-handled:
+	case <-time.After(3 * time.Second):
+		t.Fatal("want the updates after a full poll handled while /lento runs")
+	}
+}
+
+// handleAll runs uh until every update is handled
+func handleAll(uh *UpdateController, source chan bot.Update, updates ...bot.Update) {
+	go func() {
+		for _, u := range updates {
+			source <- u
+		}
+		close(source)
+	}()
+	uh.Start(context.Background())
+}
+
+type recorder struct {
+	mut   sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) middleware(name string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, s bot.Service, u bot.Update) error {
+			r.record(name)
+			return next(ctx, s, u)
+		}
+	}
+}
+
+func (r *recorder) handler(name string) HandlerFunc {
+	return func(ctx context.Context, s bot.Service, u bot.Update) error {
+		r.record(name)
+		return nil
+	}
+}
+
+func assertCalls(t *testing.T, want []string, got []string) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("calls - want: %v, got: %v", want, got)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("calls - want: %v, got: %v", want, got)
+		}
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	uh := NewUpdateHandler(&fakeBot{}, nil)
+	uh.Timeout = 10 * time.Millisecond
+
+	var errs []error
+	wait := func(ctx context.Context, s bot.Service, u bot.Update) error {
+		select {
+		case <-ctx.Done():
+		case <-time.After(50 * time.Millisecond):
+		}
+		errs = append(errs, ctx.Err())
+		return nil
+	}
+	uh.Handle(Command("lento"), wait, Timeout(time.Second))
+	uh.Handle(AnyText, wait)
+
+	uh.HandleUpdate(context.Background(), textUpdate(1, "/lento"))
+	uh.HandleUpdate(context.Background(), textUpdate(2, "oi"))
+
+	if len(errs) != 2 || errs[0] != nil || errs[1] == nil {
+		t.Fatalf("want only the handler without more time cancelled, got: %v", errs)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	r := &recorder{}
+
+	uh.Middleware(r.middleware("global 1"))
+	uh.Middleware(r.middleware("global 2"))
+
+	admin := uh.Group(r.middleware("group"))
+	admin.Handle(Command("admin"), r.handler("handler"), r.middleware("handler 1"), r.middleware("handler 2"))
+
+	// registered after the handlers, still runs for them
+	uh.Middleware(r.middleware("global 3"))
+
+	handleAll(uh, source, textUpdate(1, "/admin"))
+
+	assertCalls(t, []string{
+		"global 1",
+		"global 2",
+		"global 3",
+		"group",
+		"handler 1",
+		"handler 2",
+		"handler",
+	}, r.calls)
+}
+
+func TestMiddlewareCriteria(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	r := &recorder{}
+
+	uh.Middleware(r.middleware("any"))
+	uh.Middleware(r.middleware("commands"), AnyCommand)
+	uh.Handle(AnyText, r.handler("handler"))
+
+	handleAll(uh, source, textUpdate(1, "oi"))
+
+	assertCalls(t, []string{"any", "handler"}, r.calls)
+}
+
+func TestMiddlewareStopsChain(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	r := &recorder{}
+
+	deny := func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, s bot.Service, u bot.Update) error {
+			r.record("deny")
+			return nil
+		}
+	}
+
+	uh.Middleware(deny)
+	uh.Middleware(r.middleware("after deny"))
+	uh.Handle(AnyText, r.handler("handler"))
+
+	handleAll(uh, source, textUpdate(1, "oi"))
+
+	assertCalls(t, []string{"deny"}, r.calls)
+}
+
+func TestNestedGroups(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	r := &recorder{}
+
+	outer := uh.Group(r.middleware("outer"))
+	inner := outer.Group(r.middleware("inner"))
+	inner.Handle(Command("a"), r.handler("a"))
+	outer.Handle(Command("b"), r.handler("b"))
+
+	handleAll(uh, source, textUpdate(1, "/a"))
+	assertCalls(t, []string{"outer", "inner", "a"}, r.calls)
+
+	r.calls = nil
+	source = make(chan bot.Update)
+	uh.Source = source
+	handleAll(uh, source, textUpdate(2, "/b"))
+	assertCalls(t, []string{"outer", "b"}, r.calls)
+}
+
+func TestFirstMatchingHandlerOnly(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	r := &recorder{}
+
+	uh.Handle(Command("a"), r.handler("command"))
+	uh.Handle(AnyText, r.handler("text"))
+
+	handleAll(uh, source, textUpdate(1, "/a"))
+
+	assertCalls(t, []string{"command"}, r.calls)
+}
+
+func TestSameChatInOrder(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	r := &recorder{}
+
+	uh.Handle(Command("lento"), func(ctx context.Context, s bot.Service, u bot.Update) error {
+		time.Sleep(20 * time.Millisecond)
+		r.record("lento")
+		return nil
+	})
+	uh.Handle(AnyText, r.handler("rapido"))
+
+	handleAll(uh, source, textUpdate(1, "/lento"), textUpdate(2, "oi"))
+
+	assertCalls(t, []string{"lento", "rapido"}, r.calls)
+}
+
+func TestOtherChatsInParallel(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	// a chat waiting for a worker must not queue behind another one, as
+	// chats 1 and 3 would with 2 workers taking chatID % 2
+	uh.Workers = 2
+
+	release := make(chan struct{})
+	uh.Handle(Command("lento"), func(ctx context.Context, s bot.Service, u bot.Update) error {
+		<-release
+		return nil
+	})
+	uh.Handle(AnyText, func(ctx context.Context, s bot.Service, u bot.Update) error {
+		close(release)
+		return nil
+	})
+
+	blocked := textUpdate(1, "/lento")
+	other := textUpdate(2, "oi")
+	other.Message.Chat.ID = 3
+
+	done := make(chan struct{})
+	go func() {
+		handleAll(uh, source, blocked, other)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("chat 3 waited for chat 1")
+	}
+
+	stats := uh.Stats()
+	if stats.Handled != 2 || stats.Queued != 0 {
+		t.Fatalf("stats - want: 2 handled and 0 queued, got: %+v", stats)
+	}
+}
+
+func TestZeroWorkersAndQueueSize(t *testing.T) {
+	source := make(chan bot.Update)
+	uh := NewUpdateHandler(&fakeBot{}, source)
+	uh.Workers = 0
+	uh.QueueSize = 0
+	r := &recorder{}
+	uh.Handle(AnyText, r.handler("oi"))
+
+	handleAll(uh, source, textUpdate(1, "oi"), textUpdate(2, "oi"))
+
+	assertCalls(t, []string{"oi", "oi"}, r.calls)
+}
+
+func TestChatKey(t *testing.T) {
+	tests := []struct {
+		update bot.Update
+		want   int64
+	}{
+		{textUpdate(1, "oi"), 1},
+		{bot.Update{CallbackQuery: &bot.CallbackQuery{From: &bot.User{ID: 2}, Message: &bot.Message{Chat: &bot.Chat{ID: -3}}}}, -3},
+		{bot.Update{InlineQuery: &bot.InlineQuery{From: &bot.User{ID: 4}}}, 4},
+		{bot.Update{PollAnswer: &bot.PollAnswer{User: bot.User{ID: 5}}}, 5},
+	}
+
+	for _, tt := range tests {
+		if got := chatKey(tt.update); got != tt.want {
+			t.Errorf("want: %d, got: %d", tt.want, got)
+		}
+	}
+}
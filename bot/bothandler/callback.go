@@ -0,0 +1,162 @@
+package bothandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// MaxCallbackData is the most bytes Telegram accepts as callback_data.
+const MaxCallbackData = 64
+
+// Toast is returned by callback handlers to show a notification on the
+// client of the user who pressed the button, or an alert when Alert is set.
+type Toast struct {
+	Text  string
+	Alert bool
+}
+
+func (t Toast) Error() string {
+	return ""
+}
+
+// EncodeCallback builds the callback_data of a button for route, like
+// "poll:vote:0" for the route "poll:vote" and the arg 0. Args may be
+// strings without ":", ints, int64s or bools.
+func EncodeCallback(route string, args ...any) (string, error) {
+	parts := []string{route}
+	for _, arg := range args {
+		var part string
+		switch arg := arg.(type) {
+		case string:
+			if strings.Contains(arg, ":") {
+				return "", fmt.Errorf("callback arg %q contains ':'", arg)
+			}
+			part = arg
+		case int:
+			part = strconv.Itoa(arg)
+		case int64:
+			part = strconv.FormatInt(arg, 10)
+		case bool:
+			part = "0"
+			if arg {
+				part = "1"
+			}
+		default:
+			return "", fmt.Errorf("unsupported callback arg type %T", arg)
+		}
+		parts = append(parts, part)
+	}
+
+	data := strings.Join(parts, ":")
+	if len(data) > MaxCallbackData {
+		return "", fmt.Errorf("callback data %q is longer than %d bytes", data, MaxCallbackData)
+	}
+	return data, nil
+}
+
+// MustEncodeCallback is like EncodeCallback but panics on error. It's
+// meant for args known to fit.
+func MustEncodeCallback(route string, args ...any) string {
+	data, err := EncodeCallback(route, args...)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// CallbackArgs are the args encoded after the route of a callback.
+type CallbackArgs []string
+
+func (a CallbackArgs) String(i int) string {
+	if i >= len(a) {
+		return ""
+	}
+	return a[i]
+}
+
+func (a CallbackArgs) Int(i int) (int, error) {
+	return strconv.Atoi(a.String(i))
+}
+
+func (a CallbackArgs) Int64(i int) (int64, error) {
+	return strconv.ParseInt(a.String(i), 10, 64)
+}
+
+func (a CallbackArgs) Bool(i int) bool {
+	return a.String(i) == "1"
+}
+
+type CallbackFunc func(ctx context.Context, s bot.Service, u bot.Update, args CallbackArgs) error
+
+// CallbackRouter sends each callback query to the handler of the longest
+// route prefixing its data, then answers the query so the client stops
+// loading.
+type CallbackRouter struct {
+	routes   map[string]CallbackFunc
+	fallback CallbackFunc
+}
+
+func NewCallbackRouter() *CallbackRouter {
+	return &CallbackRouter{
+		routes: map[string]CallbackFunc{},
+	}
+}
+
+// Handle registers fn for the callbacks of route, like "poll:vote".
+func (r *CallbackRouter) Handle(route string, fn CallbackFunc) {
+	r.routes[route] = fn
+}
+
+// Fallback handles the callbacks no route matches, with the whole data
+// split as args. Useful for buttons sent before the routes existed.
+func (r *CallbackRouter) Fallback(fn CallbackFunc) {
+	r.fallback = fn
+}
+
+// Register adds the router to h as the handler of every callback query.
+func (r *CallbackRouter) Register(h Handler) {
+	h.Handle(AnyCallbackQuery, r.HandleCallback)
+}
+
+func (r *CallbackRouter) HandleCallback(ctx context.Context, s bot.Service, u bot.Update) error {
+	fn, args := r.route(u.CallbackQuery.Data)
+
+	var err error
+	if fn == nil {
+		err = fmt.Errorf("no callback route for %q", u.CallbackQuery.Data)
+	} else {
+		err = fn(ctx, s, u, args)
+	}
+
+	answer := bot.AnswerCallbackQueryParams{
+		CallbackQueryID: u.CallbackQuery.ID,
+	}
+	var toast Toast
+	if errors.As(err, &toast) {
+		answer.Text = toast.Text
+		answer.ShowAlert = toast.Alert
+		err = nil
+	}
+
+	answerErr := s.AnswerCallbackQuery(ctx, answer)
+	if err != nil {
+		return err
+	}
+	return answerErr
+}
+
+func (r *CallbackRouter) route(data string) (CallbackFunc, CallbackArgs) {
+	parts := strings.Split(data, ":")
+	for n := len(parts); n > 0; n-- {
+		fn, ok := r.routes[strings.Join(parts[:n], ":")]
+		if ok {
+			return fn, parts[n:]
+		}
+	}
+	return r.fallback, parts
+}
@@ -0,0 +1,89 @@
+package bothandler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestEncodeCallback(t *testing.T) {
+	tests := []struct {
+		route string
+		args  []any
+		want  string
+	}{
+		{"poll:vote", []any{0}, "poll:vote:0"},
+		{"audio:next", nil, "audio:next"},
+		{"sched:cancel", []any{int64(42), true, "x"}, "sched:cancel:42:1:x"},
+	}
+
+	for _, tt := range tests {
+		got, err := EncodeCallback(tt.route, tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("want: %s, got: %s", tt.want, got)
+		}
+	}
+
+	_, err := EncodeCallback("a", strings.Repeat("x", 63))
+	if err == nil {
+		t.Error("want error for data longer than 64 bytes")
+	}
+
+	_, err = EncodeCallback("a", "b:c")
+	if err == nil {
+		t.Error("want error for arg with ':'")
+	}
+}
+
+func TestCallbackRouter(t *testing.T) {
+	source := make(chan bot.Update)
+	b := &fakeBot{}
+	uh := NewUpdateHandler(b, source)
+
+	var got []string
+	record := func(name string, err error) CallbackFunc {
+		return func(ctx context.Context, s bot.Service, u bot.Update, args CallbackArgs) error {
+			got = append(got, name+" "+strings.Join(args, ","))
+			return err
+		}
+	}
+
+	callbacks := NewCallbackRouter()
+	callbacks.Handle("poll", record("poll", nil))
+	callbacks.Handle("poll:vote", record("vote", Toast{Text: "votado"}))
+	callbacks.Fallback(record("fallback", nil))
+	callbacks.Register(uh)
+
+	handleAll(uh, source,
+		callbackUpdate(1, "poll:vote:1"),
+		callbackUpdate(2, "poll:other"),
+		callbackUpdate(3, "0"),
+	)
+
+	assertCalls(t, []string{"vote 1", "poll other", "fallback 0"}, got)
+
+	if len(b.answered) != 3 {
+		t.Fatalf("want every callback answered, got: %+v", b.answered)
+	}
+	if b.answered[0].Text != "votado" || b.answered[1].Text != "" {
+		t.Fatalf("toast - want only the first answer with text, got: %+v", b.answered)
+	}
+}
+
+func TestCallbackRouterAnswersUnknownRoute(t *testing.T) {
+	b := &fakeBot{}
+	callbacks := NewCallbackRouter()
+
+	err := callbacks.HandleCallback(context.Background(), b, callbackUpdate(1, "nada"))
+	if err == nil {
+		t.Fatal("want error for unknown route")
+	}
+	if len(b.answered) != 1 {
+		t.Fatalf("want callback answered anyway, got: %+v", b.answered)
+	}
+}
@@ -0,0 +1,404 @@
+package bothandler
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+type Permission int
+
+const (
+	Anyone Permission = iota
+	Admin
+	God
+)
+
+type ArgType int
+
+const (
+	// ArgText is the rest of the message, so it must be the last argument
+	ArgText ArgType = iota
+	// ArgTopic is a single #topic, always lowercase
+	ArgTopic
+	// ArgTopics is one or more #topics, so it must be the last argument
+	ArgTopics
+	// ArgDuration is a duration like 1h30m
+	ArgDuration
+	// ArgUser is the author of the replied message, or a mentioned user.
+	// It doesn't take the place of other arguments.
+	ArgUser
+	// ArgWord is a single word
+	ArgWord
+)
+
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+}
+
+func (a Arg) usage() string {
+	name := a.Name
+	switch a.Type {
+	case ArgTopic:
+		name = "#" + name
+	case ArgTopics:
+		name = "#" + name + "..."
+	case ArgUser:
+		name = "@" + name
+	}
+	if a.Optional {
+		return "[" + name + "]"
+	}
+	return "<" + name + ">"
+}
+
+// CommandDef declares a command handled by the CommandRouter.
+type CommandDef struct {
+	Name        string
+	Description string
+	Args        []Arg
+	Permission  Permission
+	// Hidden commands are not listed on /help nor on the Telegram menu
+	Hidden bool
+	// Timeout replaces the Timeout of the controller for the command, see
+	// the Timeout middleware
+	Timeout time.Duration
+	// Feature must be on in the chat for the command to run, checked
+	// before the arguments. See CommandRouter.Features.
+	Feature string
+	// Disabled is the reply when the Feature is off, none if empty
+	Disabled string
+	Handler  HandlerFunc
+}
+
+func (c CommandDef) Usage() string {
+	usage := "/" + c.Name
+	for _, arg := range c.Args {
+		usage += " " + arg.usage()
+	}
+	return usage
+}
+
+// Handler is where commands are registered, like an UpdateController or
+// a Group.
+type Handler interface {
+	Handle(criteria CriteriaFunc, fn HandlerFunc, mws ...Middleware)
+}
+
+// CommandRouter parses and validates the arguments of the commands before
+// calling their handlers, which read them with ArgsFrom.
+type CommandRouter struct {
+	commands []CommandDef
+	guards   map[Permission]Middleware
+	enabled  FeatureFunc
+}
+
+// FeatureFunc tells if the feature key is on in the chat.
+type FeatureFunc func(ctx context.Context, chatID int64, key string) (bool, error)
+
+func NewCommandRouter() *CommandRouter {
+	return &CommandRouter{
+		guards: map[Permission]Middleware{},
+	}
+}
+
+// Guard sets the middleware that checks if the user has the permission.
+func (r *CommandRouter) Guard(p Permission, mw Middleware) {
+	r.guards[p] = mw
+}
+
+func (r *CommandRouter) Add(cmd CommandDef) {
+	r.commands = append(r.commands, cmd)
+}
+
+// Features sets how the Feature of the commands is checked.
+func (r *CommandRouter) Features(fn FeatureFunc) {
+	r.enabled = fn
+}
+
+// Register adds every command and /help to h.
+func (r *CommandRouter) Register(h Handler) {
+	h.Handle(Command("help"), r.Help)
+
+	for _, cmd := range r.commands {
+		cmd := cmd
+		var mws []Middleware
+		if cmd.Permission != Anyone {
+			guard, ok := r.guards[cmd.Permission]
+			if !ok {
+				panic(fmt.Sprintf("no guard for the permission of /%s", cmd.Name))
+			}
+			mws = append(mws, guard)
+		}
+		if cmd.Feature != "" && r.enabled == nil {
+			panic(fmt.Sprintf("no way to check the feature of /%s", cmd.Name))
+		}
+		if cmd.Timeout != 0 {
+			mws = append(mws, Timeout(cmd.Timeout))
+		}
+		h.Handle(Command(cmd.Name), r.parse(cmd), mws...)
+	}
+}
+
+func (r *CommandRouter) parse(cmd CommandDef) HandlerFunc {
+	return func(ctx context.Context, s bot.Service, u bot.Update) error {
+		if cmd.Feature != "" {
+			enabled, err := r.enabled(ctx, u.Message.Chat.ID, cmd.Feature)
+			if err != nil {
+				return err
+			}
+			if !enabled && cmd.Disabled != "" {
+				return Reply{Text: cmd.Disabled}
+			}
+			if !enabled {
+				return nil
+			}
+		}
+
+		args, err := parseArgs(cmd.Args, u.Message)
+		if err != nil {
+			return Reply{
+				Text: err.Error() + "\nuso: " + cmd.Usage(),
+			}
+		}
+		return cmd.Handler(context.WithValue(ctx, argsKey{}, args), s, u)
+	}
+}
+
+// Help replies with the usage of the visible commands.
+func (r *CommandRouter) Help(ctx context.Context, s bot.Service, u bot.Update) error {
+	txt := "comandos:\n"
+	admin := ""
+	for _, cmd := range r.visible(Admin) {
+		line := cmd.Usage() + " - " + cmd.Description + "\n"
+		if cmd.Permission == Admin {
+			admin += line
+		} else {
+			txt += line
+		}
+	}
+	if admin != "" {
+		txt += "\nadmins:\n" + admin
+	}
+	return Reply{
+		Text: txt,
+	}
+}
+
+// SetMyCommands shows the commands on the Telegram menu, including the
+// admin ones for the chat administrators.
+func (r *CommandRouter) SetMyCommands(ctx context.Context, s bot.Service) error {
+	err := s.SetMyCommands(ctx, bot.SetMyCommandsParams{
+		Commands: botCommands(r.visible(Anyone)),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.SetMyCommands(ctx, bot.SetMyCommandsParams{
+		Commands: botCommands(r.visible(Admin)),
+		Scope:    &bot.BotCommandScope{Type: "all_chat_administrators"},
+	})
+}
+
+func (r *CommandRouter) visible(max Permission) []CommandDef {
+	help := CommandDef{Name: "help", Description: "lista os comandos"}
+	cmds := []CommandDef{help}
+	for _, cmd := range r.commands {
+		if !cmd.Hidden && cmd.Permission <= max {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+func botCommands(cmds []CommandDef) []bot.BotCommand {
+	botCmds := []bot.BotCommand{}
+	for _, cmd := range cmds {
+		botCmds = append(botCmds, bot.BotCommand{
+			Command:     cmd.Name,
+			Description: cmd.Description,
+		})
+	}
+	return botCmds
+}
+
+type argsKey struct{}
+
+// Args are the parsed arguments of a command, by name.
+type Args map[string]any
+
+// ArgsFrom returns the arguments parsed by the CommandRouter.
+func ArgsFrom(ctx context.Context) Args {
+	args, _ := ctx.Value(argsKey{}).(Args)
+	return args
+}
+
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Args) Text(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+func (a Args) Topic(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+func (a Args) Topics(name string) []string {
+	v, _ := a[name].([]string)
+	return v
+}
+
+func (a Args) Duration(name string) time.Duration {
+	v, _ := a[name].(time.Duration)
+	return v
+}
+
+func (a Args) User(name string) *bot.User {
+	v, _ := a[name].(*bot.User)
+	return v
+}
+
+var reTopic = regexp.MustCompile(`^#[a-z0-9_]+$`)
+
+func parseArgs(defs []Arg, msg *bot.Message) (Args, error) {
+	args := Args{}
+	rest := commandArgs(msg.Text)
+
+	for _, def := range defs {
+		if def.Type != ArgUser {
+			continue
+		}
+		user, mention := targetUser(msg)
+		if user == nil {
+			if def.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("faltou @%s (ou responda a mensagem dele)", def.Name)
+		}
+		args[def.Name] = user
+		rest = strings.TrimSpace(strings.Replace(rest, mention, "", 1))
+	}
+
+	for _, def := range defs {
+		if def.Type == ArgUser {
+			continue
+		}
+
+		if rest == "" {
+			if def.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("faltou %s", def.usage())
+		}
+
+		switch def.Type {
+		case ArgText:
+			args[def.Name] = rest
+			rest = ""
+
+		case ArgWord:
+			args[def.Name], rest = nextField(rest)
+
+		case ArgTopics:
+			topics := []string{}
+			for _, field := range strings.Fields(rest) {
+				topic := strings.ToLower(field)
+				if !reTopic.MatchString(topic) {
+					return nil, fmt.Errorf("tópico inválido: %s", field)
+				}
+				topics = append(topics, topic)
+			}
+			args[def.Name] = topics
+			rest = ""
+
+		case ArgTopic:
+			var field string
+			field, rest = nextField(rest)
+			topic := strings.ToLower(field)
+			if !reTopic.MatchString(topic) {
+				return nil, fmt.Errorf("tópico inválido: %s", field)
+			}
+			args[def.Name] = topic
+
+		case ArgDuration:
+			var field string
+			field, rest = nextField(rest)
+			d, err := time.ParseDuration(field)
+			if err != nil {
+				return nil, fmt.Errorf("duração inválida: %s", field)
+			}
+			args[def.Name] = d
+		}
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("não entendi: %s", rest)
+	}
+	return args, nil
+}
+
+// commandArgs is the text after the command
+func commandArgs(text string) string {
+	_, rest := nextField(text)
+	return rest
+}
+
+func nextField(s string) (field string, rest string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t\n")
+	if i == -1 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// targetUser is the first mentioned user or else the author of the
+// replied message, along with the text of the mention.
+func targetUser(msg *bot.Message) (*bot.User, string) {
+	var replied *bot.User
+	if msg.ReplyToMessage != nil {
+		replied = msg.ReplyToMessage.From
+	}
+
+	for _, e := range msg.Entities {
+		switch e.Type {
+		case "text_mention":
+			return e.User, entityText(msg.Text, e)
+		case "mention":
+			mention := entityText(msg.Text, e)
+			username := strings.TrimPrefix(mention, "@")
+			if replied != nil && strings.EqualFold(replied.Username, username) {
+				return replied, mention
+			}
+			// plain @username mentions have no ID
+			return &bot.User{Username: username}, mention
+		}
+	}
+
+	if replied != nil {
+		return replied, ""
+	}
+	return nil, ""
+}
+
+// entityText extracts the text of e, whose offsets are in UTF-16 units
+func entityText(text string, e bot.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if e.Offset < 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
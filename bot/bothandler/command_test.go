@@ -0,0 +1,276 @@
+package bothandler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestParseArgs(t *testing.T) {
+	agenda := []Arg{
+		{Name: "topico", Type: ArgTopic},
+		{Name: "duracao", Type: ArgDuration},
+	}
+
+	args, err := parseArgs(agenda, textUpdate(1, "/agenda #Futebol 1h30m").Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args.Topic("topico"); got != "#futebol" {
+		t.Errorf("topic - want: %s, got: %s", "#futebol", got)
+	}
+	if got := args.Duration("duracao"); got != 90*time.Minute {
+		t.Errorf("duration - want: %s, got: %s", 90*time.Minute, got)
+	}
+
+	tests := []struct {
+		text    string
+		wantErr string
+	}{
+		{"/agenda", "faltou <#topico>"},
+		{"/agenda #futebol", "faltou <duracao>"},
+		{"/agenda futebol 1h", "tópico inválido: futebol"},
+		{"/agenda #futebol amanha", "duração inválida: amanha"},
+		{"/agenda #futebol 1h agora", "não entendi: agora"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseArgs(agenda, textUpdate(1, tt.text).Message)
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("%q: err - want: %s, got: %v", tt.text, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParseArgsTextAndTopics(t *testing.T) {
+	args, err := parseArgs([]Arg{{Name: "pergunta", Type: ArgText}}, textUpdate(1, "/ask  qual o sentido\nda vida?").Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args.Text("pergunta"); got != "qual o sentido\nda vida?" {
+		t.Errorf("text - want: %q, got: %q", "qual o sentido\nda vida?", got)
+	}
+
+	args, err = parseArgs([]Arg{{Name: "topicos", Type: ArgTopics}}, textUpdate(1, "/suba #a #B_2").Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args.Topics("topicos"), " "); got != "#a #b_2" {
+		t.Errorf("topics - want: %s, got: %s", "#a #b_2", got)
+	}
+
+	set := []Arg{
+		{Name: "chave", Type: ArgWord, Optional: true},
+		{Name: "valor", Type: ArgText, Optional: true},
+	}
+	args, err = parseArgs(set, textUpdate(1, "/ajuste ask_prompt  seja breve").Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := args.Text("chave"); got != "ask_prompt" {
+		t.Errorf("word - want: %s, got: %s", "ask_prompt", got)
+	}
+	if got := args.Text("valor"); got != "seja breve" {
+		t.Errorf("text - want: %q, got: %q", "seja breve", got)
+	}
+}
+
+func TestParseArgsUser(t *testing.T) {
+	defs := []Arg{
+		{Name: "usuario", Type: ArgUser, Optional: true},
+		{Name: "topicos", Type: ArgTopics},
+	}
+
+	msg := textUpdate(1, "/suba #a").Message
+	msg.ReplyToMessage = &bot.Message{From: &bot.User{ID: 2}}
+	args, err := parseArgs(defs, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := args.User("usuario"); u == nil || u.ID != 2 {
+		t.Errorf("user - want reply author, got: %+v", u)
+	}
+
+	msg = textUpdate(1, "/suba @fulano #a").Message
+	msg.Entities = []bot.MessageEntity{{Type: "mention", Offset: 6, Length: 7}}
+	args, err = parseArgs(defs, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := args.User("usuario"); u == nil || u.Username != "fulano" {
+		t.Errorf("user - want fulano, got: %+v", u)
+	}
+	if got := args.Topics("topicos"); len(got) != 1 || got[0] != "#a" {
+		t.Errorf("topics - want: [#a], got: %v", got)
+	}
+
+	// the mention wins over the reply, and the reply gives its ID if it
+	// is the same user
+	for _, tt := range []struct {
+		replied bot.User
+		wantID  int64
+	}{
+		{bot.User{ID: 2, Username: "beltrano"}, 0},
+		{bot.User{ID: 3, Username: "Fulano"}, 3},
+	} {
+		replied := tt.replied
+		msg = textUpdate(1, "/suba @fulano #a").Message
+		msg.Entities = []bot.MessageEntity{{Type: "mention", Offset: 6, Length: 7}}
+		msg.ReplyToMessage = &bot.Message{From: &replied}
+		args, err = parseArgs(defs, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u := args.User("usuario"); u == nil || !strings.EqualFold(u.Username, "fulano") || u.ID != tt.wantID {
+			t.Errorf("reply to %+v: user - want fulano with ID %d, got: %+v", replied, tt.wantID, u)
+		}
+	}
+
+	args, err = parseArgs(defs, textUpdate(1, "/suba #a").Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.Has("usuario") {
+		t.Errorf("want no user, got: %+v", args.User("usuario"))
+	}
+}
+
+func TestEntityTextUTF16(t *testing.T) {
+	// "😀" takes 2 UTF-16 units
+	text := "😀 @fulano"
+	got := entityText(text, bot.MessageEntity{Type: "mention", Offset: 3, Length: 7})
+	if got != "@fulano" {
+		t.Fatalf("want: %s, got: %s", "@fulano", got)
+	}
+}
+
+func TestCommandRouter(t *testing.T) {
+	source := make(chan bot.Update)
+	b := &fakeBot{}
+	uh := NewUpdateHandler(b, source)
+	r := &recorder{}
+
+	var topic string
+	cmds := NewCommandRouter()
+	cmds.Guard(Admin, r.middleware("admin"))
+	cmds.Add(CommandDef{
+		Name:        "bora",
+		Description: "chama os inscritos",
+		Args:        []Arg{{Name: "topico", Type: ArgTopic}},
+		Handler: func(ctx context.Context, s bot.Service, u bot.Update) error {
+			topic = ArgsFrom(ctx).Topic("topico")
+			r.record("bora")
+			return nil
+		},
+	})
+	cmds.Add(CommandDef{
+		Name:        "start",
+		Description: "ativa o bot",
+		Permission:  Admin,
+		Handler:     r.handler("start"),
+	})
+	cmds.Add(CommandDef{
+		Name:    "segredo",
+		Hidden:  true,
+		Handler: r.handler("segredo"),
+	})
+	cmds.Register(uh)
+
+	handleAll(uh, source,
+		textUpdate(1, "/bora #futebol"),
+		textUpdate(2, "/bora"),
+		textUpdate(3, "/start"),
+		textUpdate(4, "/help"),
+	)
+
+	assertCalls(t, []string{"bora", "admin", "start"}, r.calls)
+	if topic != "#futebol" {
+		t.Errorf("topic - want: %s, got: %s", "#futebol", topic)
+	}
+
+	if len(b.sent) != 2 {
+		t.Fatalf("want 2 replies, got: %d", len(b.sent))
+	}
+	if want := "faltou <#topico>\nuso: /bora <#topico>"; b.sent[0].Text != want {
+		t.Errorf("usage - want: %q, got: %q", want, b.sent[0].Text)
+	}
+
+	help := b.sent[1].Text
+	for _, want := range []string{"/bora <#topico> - chama os inscritos", "admins:\n/start - ativa o bot"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help - want to contain %q, got: %q", want, help)
+		}
+	}
+	if strings.Contains(help, "segredo") {
+		t.Errorf("help - want hidden commands left out, got: %q", help)
+	}
+}
+
+func TestRegisterWithoutGuardPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic")
+		}
+	}()
+
+	cmds := NewCommandRouter()
+	cmds.Add(CommandDef{Name: "backup", Permission: God})
+	cmds.Register(NewUpdateHandler(&fakeBot{}, nil))
+}
+
+func TestCommandRouterFeature(t *testing.T) {
+	source := make(chan bot.Update)
+	b := &fakeBot{}
+	uh := NewUpdateHandler(b, source)
+	r := &recorder{}
+
+	cmds := NewCommandRouter()
+	cmds.Features(func(ctx context.Context, chatID int64, key string) (bool, error) {
+		return key == "ligado", nil
+	})
+	cmds.Add(CommandDef{
+		Name:    "ask",
+		Args:    []Arg{{Name: "pergunta", Type: ArgText}},
+		Feature: "desligado",
+		Handler: r.handler("ask"),
+	})
+	cmds.Add(CommandDef{
+		Name:     "cask",
+		Args:     []Arg{{Name: "pergunta", Type: ArgText}},
+		Feature:  "desligado",
+		Disabled: "comando desativado",
+		Handler:  r.handler("cask"),
+	})
+	cmds.Add(CommandDef{
+		Name:    "resumo",
+		Args:    []Arg{{Name: "janela", Type: ArgDuration, Optional: true}},
+		Feature: "ligado",
+		Handler: r.handler("resumo"),
+	})
+	cmds.Register(uh)
+
+	handleAll(uh, source,
+		textUpdate(1, "/ask"),
+		textUpdate(2, "/cask"),
+		textUpdate(3, "/resumo 6h"),
+	)
+
+	// the disabled commands don't complain about the arguments
+	assertCalls(t, []string{"resumo"}, r.calls)
+	assertCalls(t, []string{"comando desativado"}, sentTexts(b))
+}
+
+func TestRegisterWithoutFeaturesPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic")
+		}
+	}()
+
+	cmds := NewCommandRouter()
+	cmds.Add(CommandDef{Name: "ask", Feature: "ask"})
+	cmds.Register(NewUpdateHandler(&fakeBot{}, nil))
+}
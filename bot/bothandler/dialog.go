@@ -0,0 +1,339 @@
+package bothandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// DefaultDialogTimeout is how long a dialog waits for each answer.
+const DefaultDialogTimeout = 5 * time.Minute
+
+// dialogPrefix marks the callback data of the buttons sent by Ask
+const dialogPrefix = "dlg:"
+
+// DialogState is where a user is in a dialog. It is kept by a DialogStore
+// between updates, so dialogs survive restarts.
+type DialogState struct {
+	ChatID int64
+	UserID int64
+	// MessageID is the message that started the dialog
+	MessageID int
+	// PromptID is the last question of the dialog. Only the messages
+	// replying to it are answers, the others are handled as usual.
+	PromptID  int
+	Dialog    string
+	Step      string
+	Data      map[string]string
+	ExpiresAt time.Time
+}
+
+// DialogStore keeps the dialogs in progress, one per user in each chat.
+// FindDialog returns nil when there is none.
+type DialogStore interface {
+	FindDialog(ctx context.Context, chatID int64, userID int64) (*DialogState, error)
+	SaveDialog(ctx context.Context, state DialogState) error
+	DeleteDialog(ctx context.Context, chatID int64, userID int64) error
+}
+
+// StepFunc handles the answer of the user to a step of a dialog. The dialog
+// ends after the step unless it calls Conversation.Next.
+type StepFunc func(ctx context.Context, s bot.Service, u bot.Update, c *Conversation) error
+
+type Dialog struct {
+	Name string
+	// Timeout is how long to wait for each answer, DefaultDialogTimeout if
+	// zero
+	Timeout time.Duration
+	// Steps by name. The "start" step runs with the update that began the
+	// dialog.
+	Steps map[string]StepFunc
+}
+
+// Conversation is the dialog state as seen by the steps.
+type Conversation struct {
+	DialogState
+	next string
+}
+
+// Next makes the following answer of the user go to step.
+func (c *Conversation) Next(step string) {
+	c.next = step
+}
+
+func (c *Conversation) Get(key string) string {
+	return c.Data[key]
+}
+
+func (c *Conversation) Set(key string, value string) {
+	if c.Data == nil {
+		c.Data = map[string]string{}
+	}
+	c.Data[key] = value
+}
+
+// Ask sends a question to the chat, with a button for each option. Options
+// are answered to the next step, which must be set before calling Ask, and
+// so are the replies to the question.
+func (c *Conversation) Ask(ctx context.Context, s bot.Service, text string, options ...string) error {
+	params := bot.SendMessageParams{
+		ChatID:                   c.ChatID,
+		ReplyToMessageID:         c.MessageID,
+		AllowSendingWithoutReply: true,
+		Text:                     text,
+	}
+
+	var rows [][]bot.InlineKeyboardButton
+	for i, option := range options {
+		data := dialogPrefix + c.next + ":" + option
+		if len(data) > 64 {
+			// doesn't fit the callback data, can still be typed
+			continue
+		}
+		if i%3 == 0 {
+			rows = append(rows, nil)
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], bot.InlineKeyboardButton{
+			Text:         option,
+			CallbackData: data,
+		})
+	}
+	if len(rows) > 0 {
+		params.ReplyMarkup = &bot.InlineKeyboardMarkup{InlineKeyboard: rows}
+	}
+
+	msg, err := s.SendMessage(ctx, params)
+	if err != nil {
+		return err
+	}
+	c.PromptID = msg.MessageID
+	return nil
+}
+
+// Answer is what the user answered: the text of the message or the option
+// chosen with Ask.
+func Answer(u bot.Update) string {
+	if u.CallbackQuery != nil {
+		_, option, _ := parseDialogData(u.CallbackQuery.Data)
+		return option
+	}
+	if u.Message != nil {
+		return strings.TrimSpace(u.Message.Text)
+	}
+	return ""
+}
+
+func parseDialogData(data string) (step string, option string, ok bool) {
+	data, ok = strings.CutPrefix(data, dialogPrefix)
+	if !ok {
+		return "", "", false
+	}
+	step, option, ok = strings.Cut(data, ":")
+	return
+}
+
+// Dialogs runs multi-step conversations. Its Middleware sends the answers
+// of a user in a dialog to the current step, until the dialog ends, times
+// out or is cancelled with /cancelar. Answers are the buttons of Ask and the
+// replies to its question.
+type Dialogs struct {
+	store   DialogStore
+	dialogs map[string]Dialog
+	now     func() time.Time
+}
+
+func NewDialogs(store DialogStore) *Dialogs {
+	return &Dialogs{
+		store:   store,
+		dialogs: map[string]Dialog{},
+		now:     time.Now,
+	}
+}
+
+func (d *Dialogs) Add(dialog Dialog) {
+	if _, ok := dialog.Steps["start"]; !ok {
+		panic(fmt.Sprintf("dialog %s has no start step", dialog.Name))
+	}
+	d.dialogs[dialog.Name] = dialog
+}
+
+// Begin starts the dialog name for the author of the message u, replacing
+// any dialog in progress, and runs its start step with data.
+func (d *Dialogs) Begin(ctx context.Context, s bot.Service, u bot.Update, name string, data map[string]string) error {
+	if u.Message == nil || u.Message.From == nil {
+		return fmt.Errorf("dialog %s must begin with a message", name)
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+
+	c := &Conversation{
+		DialogState: DialogState{
+			ChatID:    u.Message.Chat.ID,
+			UserID:    u.Message.From.ID,
+			MessageID: u.Message.MessageID,
+			Dialog:    name,
+			Step:      "start",
+			Data:      data,
+		},
+	}
+	return d.step(ctx, s, u, c)
+}
+
+// Cancel ends the dialog of the author of u.
+func (d *Dialogs) Cancel(ctx context.Context, s bot.Service, u bot.Update) error {
+	state, err := d.store.FindDialog(ctx, u.Message.Chat.ID, u.Message.From.ID)
+	if err != nil {
+		return err
+	}
+	if state == nil || d.expired(*state) {
+		return Reply{Text: "não tem nada pra cancelar"}
+	}
+
+	err = d.store.DeleteDialog(ctx, state.ChatID, state.UserID)
+	if err != nil {
+		return err
+	}
+	return Reply{Text: "cancelado"}
+}
+
+func (d *Dialogs) Middleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, s bot.Service, u bot.Update) error {
+		chatID, userID, ok := dialogKey(u)
+		if !ok {
+			return next(ctx, s, u)
+		}
+
+		var dialogStep string
+		if u.CallbackQuery != nil {
+			dialogStep, _, ok = parseDialogData(u.CallbackQuery.Data)
+			if !ok {
+				return next(ctx, s, u)
+			}
+		}
+
+		state, err := d.store.FindDialog(ctx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		if state != nil && d.expired(*state) {
+			err = d.store.DeleteDialog(ctx, chatID, userID)
+			if err != nil {
+				return err
+			}
+			state = nil
+		}
+
+		if u.CallbackQuery != nil {
+			if state == nil || state.Step != dialogStep {
+				return answerCallback(ctx, s, u, "essa conversa não é sua ou já acabou")
+			}
+			err = answerCallback(ctx, s, u, "")
+			if err != nil {
+				return err
+			}
+		} else {
+			if state == nil {
+				return next(ctx, s, u)
+			}
+			if Command("cancelar")(s, u) {
+				return d.Cancel(ctx, s, u)
+			}
+			if AnyCommand(s, u) || !repliesTo(u.Message, state.PromptID) {
+				// other commands and messages work as usual while the
+				// dialog waits
+				return next(ctx, s, u)
+			}
+		}
+
+		return d.step(ctx, s, u, &Conversation{DialogState: *state})
+	}
+}
+
+// step runs the current step of c and saves or ends the dialog.
+func (d *Dialogs) step(ctx context.Context, s bot.Service, u bot.Update, c *Conversation) error {
+	dialog, ok := d.dialogs[c.Dialog]
+	fn := dialog.Steps[c.Step]
+	if !ok || fn == nil {
+		// left over from an older version of the bot
+		return d.store.DeleteDialog(ctx, c.ChatID, c.UserID)
+	}
+
+	stepErr := fn(ctx, s, u, c)
+
+	var reply Reply
+	if c.next != "" && errors.As(stepErr, &reply) {
+		// asking again, like after a wrong answer, so the reply is the
+		// question now
+		stepErr = d.ask(ctx, s, u, c, reply)
+	}
+
+	var err error
+	if c.next == "" {
+		err = d.store.DeleteDialog(ctx, c.ChatID, c.UserID)
+	} else {
+		timeout := dialog.Timeout
+		if timeout == 0 {
+			timeout = DefaultDialogTimeout
+		}
+		c.Step = c.next
+		c.ExpiresAt = d.now().Add(timeout)
+		err = d.store.SaveDialog(ctx, c.DialogState)
+	}
+
+	if stepErr != nil {
+		return stepErr
+	}
+	return err
+}
+
+// ask sends reply to the update as the question of c.
+func (d *Dialogs) ask(ctx context.Context, s bot.Service, u bot.Update, c *Conversation, reply Reply) error {
+	msg := replyTo(u)
+	if msg == nil {
+		return reply
+	}
+	sent, err := s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:                   msg.Chat.ID,
+		ReplyToMessageID:         msg.MessageID,
+		AllowSendingWithoutReply: true,
+		Text:                     reply.Text,
+		ParseMode:                reply.ParseMode,
+	})
+	if err != nil {
+		return err
+	}
+	c.PromptID = sent.MessageID
+	return nil
+}
+
+func (d *Dialogs) expired(state DialogState) bool {
+	return !d.now().Before(state.ExpiresAt)
+}
+
+// repliesTo tells if msg replies to the message promptID.
+func repliesTo(msg *bot.Message, promptID int) bool {
+	return msg.ReplyToMessage != nil && msg.ReplyToMessage.MessageID == promptID
+}
+
+// dialogKey identifies the dialog the update may belong to
+func dialogKey(u bot.Update) (chatID int64, userID int64, ok bool) {
+	switch {
+	case u.Message != nil && u.Message.Chat != nil && u.Message.From != nil:
+		return u.Message.Chat.ID, u.Message.From.ID, true
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil && u.CallbackQuery.Message.Chat != nil && u.CallbackQuery.From != nil:
+		return u.CallbackQuery.Message.Chat.ID, u.CallbackQuery.From.ID, true
+	}
+	return 0, 0, false
+}
+
+func answerCallback(ctx context.Context, s bot.Service, u bot.Update, text string) error {
+	return s.AnswerCallbackQuery(ctx, bot.AnswerCallbackQueryParams{
+		CallbackQueryID: u.CallbackQuery.ID,
+		Text:            text,
+	})
+}
@@ -0,0 +1,207 @@
+package bothandler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+type memDialogStore struct {
+	mut     sync.Mutex
+	dialogs map[[2]int64]DialogState
+}
+
+func (m *memDialogStore) FindDialog(ctx context.Context, chatID int64, userID int64) (*DialogState, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	state, ok := m.dialogs[[2]int64{chatID, userID}]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (m *memDialogStore) SaveDialog(ctx context.Context, state DialogState) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.dialogs[[2]int64{state.ChatID, state.UserID}] = state
+	return nil
+}
+
+func (m *memDialogStore) DeleteDialog(ctx context.Context, chatID int64, userID int64) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.dialogs, [2]int64{chatID, userID})
+	return nil
+}
+
+func callbackUpdate(id int, data string) bot.Update {
+	return bot.Update{
+		UpdateID: id,
+		CallbackQuery: &bot.CallbackQuery{
+			ID:      "cb",
+			From:    &bot.User{ID: 1},
+			Message: &bot.Message{MessageID: 100, Chat: &bot.Chat{ID: 1}},
+			Data:    data,
+		},
+	}
+}
+
+// replyUpdate is the text of textUpdate replying to the message to.
+func replyUpdate(id int, text string, to int) bot.Update {
+	u := textUpdate(id, text)
+	u.Message.ReplyToMessage = &bot.Message{MessageID: to}
+	return u
+}
+
+// newDialogTest handles /cadastro with a dialog that asks the name and
+// then the age, recording the other texts as "text".
+func newDialogTest() (*UpdateController, chan bot.Update, *fakeBot, *Dialogs, *recorder) {
+	source := make(chan bot.Update)
+	b := &fakeBot{}
+	uh := NewUpdateHandler(b, source)
+	r := &recorder{}
+
+	dialogs := NewDialogs(&memDialogStore{dialogs: map[[2]int64]DialogState{}})
+	dialogs.Add(Dialog{
+		Name:    "cadastro",
+		Timeout: time.Minute,
+		Steps: map[string]StepFunc{
+			"start": func(ctx context.Context, s bot.Service, u bot.Update, c *Conversation) error {
+				c.Next("nome")
+				return c.Ask(ctx, s, "nome?")
+			},
+			"nome": func(ctx context.Context, s bot.Service, u bot.Update, c *Conversation) error {
+				c.Set("nome", Answer(u))
+				c.Next("idade")
+				return c.Ask(ctx, s, "idade?", "20", "30")
+			},
+			"idade": func(ctx context.Context, s bot.Service, u bot.Update, c *Conversation) error {
+				if strings.Trim(Answer(u), "0123456789") != "" {
+					c.Next("idade")
+					return Reply{Text: "idade inválida"}
+				}
+				return Reply{Text: c.Get("nome") + " tem " + Answer(u)}
+			},
+		},
+	})
+
+	uh.Middleware(dialogs.Middleware)
+	uh.Handle(Command("cadastro"), func(ctx context.Context, s bot.Service, u bot.Update) error {
+		return dialogs.Begin(ctx, s, u, "cadastro", nil)
+	})
+	uh.Handle(Command("cancelar"), dialogs.Cancel)
+	uh.Handle(AnyText, r.handler("text"))
+	uh.Handle(AnyCallbackQuery, r.handler("callback"))
+
+	return uh, source, b, dialogs, r
+}
+
+func sentTexts(b *fakeBot) []string {
+	texts := []string{}
+	for _, params := range b.sent {
+		texts = append(texts, params.Text)
+	}
+	return texts
+}
+
+func TestDialog(t *testing.T) {
+	uh, source, b, _, r := newDialogTest()
+
+	handleAll(uh, source,
+		textUpdate(1, "/cadastro"),
+		// not a reply to the question, so not an answer
+		textUpdate(2, "oi"),
+		replyUpdate(3, "fulano", 1001),
+		callbackUpdate(4, "dlg:idade:30"),
+		textUpdate(5, "oi"),
+	)
+
+	assertCalls(t, []string{"nome?", "idade?", "fulano tem 30"}, sentTexts(b))
+	assertCalls(t, []string{"text", "text"}, r.calls)
+
+	buttons := b.sent[1].ReplyMarkup.InlineKeyboard[0]
+	if len(buttons) != 2 || buttons[1].CallbackData != "dlg:idade:30" {
+		t.Fatalf("buttons - want 20 and 30, got: %+v", buttons)
+	}
+	if len(b.answered) != 1 || b.answered[0].Text != "" {
+		t.Fatalf("want callback answered, got: %+v", b.answered)
+	}
+}
+
+func TestDialogAskAgain(t *testing.T) {
+	uh, source, b, _, r := newDialogTest()
+
+	handleAll(uh, source,
+		textUpdate(1, "/cadastro"),
+		replyUpdate(2, "fulano", 1001),
+		replyUpdate(3, "trinta", 1002),
+		// the first question is not the last one anymore
+		replyUpdate(4, "30", 1002),
+		replyUpdate(5, "30", 1003),
+	)
+
+	assertCalls(t, []string{"nome?", "idade?", "idade inválida", "fulano tem 30"}, sentTexts(b))
+	assertCalls(t, []string{"text"}, r.calls)
+}
+
+func TestDialogCancel(t *testing.T) {
+	uh, source, b, _, r := newDialogTest()
+
+	handleAll(uh, source,
+		textUpdate(1, "/cadastro"),
+		textUpdate(2, "/cancelar"),
+		textUpdate(3, "fulano"),
+		textUpdate(4, "/cancelar"),
+	)
+
+	assertCalls(t, []string{"nome?", "cancelado", "não tem nada pra cancelar"}, sentTexts(b))
+	assertCalls(t, []string{"text"}, r.calls)
+}
+
+func TestDialogTimeout(t *testing.T) {
+	uh, source, b, dialogs, r := newDialogTest()
+
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	dialogs.now = func() time.Time { return now }
+
+	handleAll(uh, source, textUpdate(1, "/cadastro"))
+
+	now = now.Add(time.Minute)
+	source = make(chan bot.Update)
+	uh.Source = source
+	handleAll(uh, source,
+		replyUpdate(2, "fulano", 1001),
+		callbackUpdate(3, "dlg:idade:30"),
+	)
+
+	assertCalls(t, []string{"nome?"}, sentTexts(b))
+	assertCalls(t, []string{"text"}, r.calls)
+	if len(b.answered) != 1 || b.answered[0].Text == "" {
+		t.Fatalf("want callback answered with an error, got: %+v", b.answered)
+	}
+}
+
+func TestDialogIgnoresOtherUsersAndOldButtons(t *testing.T) {
+	uh, source, b, _, r := newDialogTest()
+
+	other := replyUpdate(2, "sou outro", 1001)
+	other.Message.From.ID = 2
+
+	handleAll(uh, source,
+		textUpdate(1, "/cadastro"),
+		other,
+		callbackUpdate(3, "dlg:idade:30"),
+		callbackUpdate(4, "0"),
+	)
+
+	assertCalls(t, []string{"nome?"}, sentTexts(b))
+	assertCalls(t, []string{"text", "callback"}, r.calls)
+	if len(b.answered) != 1 || b.answered[0].Text == "" {
+		t.Fatalf("want old button answered with an error, got: %+v", b.answered)
+	}
+}
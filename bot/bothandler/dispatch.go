@@ -0,0 +1,196 @@
+package bothandler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// Stats describes how long updates wait in the queue before being handled.
+type Stats struct {
+	// Queued is how many updates are waiting for a worker
+	Queued int
+	// Handled is how many updates were taken from the queue
+	Handled int
+	// LastLag is the queue time of the last handled update
+	LastLag time.Duration
+	// MaxLag is the longest queue time so far
+	MaxLag time.Duration
+	// TotalLag is the sum of every queue time, see AvgLag
+	TotalLag time.Duration
+}
+
+func (s Stats) AvgLag() time.Duration {
+	if s.Handled == 0 {
+		return 0
+	}
+	return s.TotalLag / time.Duration(s.Handled)
+}
+
+// Stats returns the queue metrics since Start was called.
+func (uh *UpdateController) Stats() Stats {
+	uh.mut.Lock()
+	defer uh.mut.Unlock()
+	return uh.stats
+}
+
+type queuedUpdate struct {
+	update bot.Update
+	at     time.Time
+}
+
+// chatQueues holds the updates of each chat in order, and which chats have
+// updates waiting for a worker. A chat is handed to one worker at a time,
+// so its updates keep their order, while the other chats are served by the
+// rest of the workers.
+type chatQueues struct {
+	mut  sync.Mutex
+	cond *sync.Cond
+	// chats has the updates of each chat not handled yet, the first one
+	// being handled if the chat is not in ready
+	chats  map[int64][]queuedUpdate
+	ready  []int64
+	closed bool
+	// slots limits the updates waiting for a worker
+	slots chan struct{}
+}
+
+func newChatQueues(size int) *chatQueues {
+	q := &chatQueues{
+		chats: map[int64][]queuedUpdate{},
+		slots: make(chan struct{}, size),
+	}
+	q.cond = sync.NewCond(&q.mut)
+	return q
+}
+
+// push queues u after the other updates of its chat. It blocks while the
+// queue is full, returning false if ctx is done first.
+func (q *chatQueues) push(ctx context.Context, u queuedUpdate) bool {
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	key := chatKey(u.update)
+	pending, busy := q.chats[key]
+	q.chats[key] = append(pending, u)
+	if !busy {
+		q.ready = append(q.ready, key)
+		q.cond.Signal()
+	}
+	return true
+}
+
+// next waits for a chat with updates and returns its first one. The chat
+// is not given to other workers until done is called. It returns false
+// once the queues are closed and empty.
+func (q *chatQueues) next() (int64, queuedUpdate, bool) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	for len(q.ready) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.ready) == 0 {
+		return 0, queuedUpdate{}, false
+	}
+
+	key := q.ready[0]
+	q.ready = q.ready[1:]
+	<-q.slots
+	return key, q.chats[key][0], true
+}
+
+// done drops the update of key given by next, and puts the chat back in
+// the end of the line if it has more.
+func (q *chatQueues) done(key int64) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	pending := q.chats[key][1:]
+	if len(pending) == 0 {
+		delete(q.chats, key)
+		return
+	}
+	q.chats[key] = pending
+	q.ready = append(q.ready, key)
+	q.cond.Signal()
+}
+
+// close makes next return false once every update was taken.
+func (q *chatQueues) close() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// work handles updates from queues until they are closed, one chat at a
+// time.
+func (uh *UpdateController) work(ctx context.Context, queues *chatQueues) {
+	for {
+		key, q, ok := queues.next()
+		if !ok {
+			return
+		}
+
+		lag := time.Since(q.at)
+		uh.dequeued(lag)
+		if uh.LagWarning > 0 && lag > uh.LagWarning {
+			log.Printf("update %d waited %s in the queue", q.update.UpdateID, lag)
+		}
+
+		if ctx.Err() == nil {
+			fn := uh.handlerFor(q.update)
+			if fn != nil {
+				uh.run(ctx, fn, q.update)
+			}
+			uh.done(q.update.UpdateID)
+		}
+		// else shutdown timed out, leave the rest pending
+		queues.done(key)
+	}
+}
+
+func (uh *UpdateController) enqueued(n int) {
+	uh.mut.Lock()
+	defer uh.mut.Unlock()
+	uh.stats.Queued += n
+}
+
+func (uh *UpdateController) dequeued(lag time.Duration) {
+	uh.mut.Lock()
+	defer uh.mut.Unlock()
+	uh.stats.Queued--
+	uh.stats.Handled++
+	uh.stats.LastLag = lag
+	uh.stats.TotalLag += lag
+	if lag > uh.stats.MaxLag {
+		uh.stats.MaxLag = lag
+	}
+}
+
+// chatKey identifies where the update comes from, to keep updates from the
+// same chat in order. Updates not tied to a chat use the user ID.
+func chatKey(u bot.Update) int64 {
+	switch {
+	case u.Message != nil && u.Message.Chat != nil:
+		return u.Message.Chat.ID
+	case u.EditedMessage != nil && u.EditedMessage.Chat != nil:
+		return u.EditedMessage.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil && u.CallbackQuery.Message.Chat != nil:
+		return u.CallbackQuery.Message.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.From != nil:
+		return u.CallbackQuery.From.ID
+	case u.InlineQuery != nil && u.InlineQuery.From != nil:
+		return u.InlineQuery.From.ID
+	case u.PollAnswer != nil:
+		return u.PollAnswer.User.ID
+	}
+	return 0
+}
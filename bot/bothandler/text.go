@@ -0,0 +1,81 @@
+package bothandler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// TextFunc processes a text message. It is true when it consumed the
+// message, so that the processors after it don't see it. A processor that
+// fails consumes the message too.
+type TextFunc func(ctx context.Context, s bot.Service, u bot.Update) (bool, error)
+
+// TextPipeline runs the processors of the text messages in the order they
+// were added, until one consumes the message. Then it runs the ones added
+// with Always, which see every message.
+type TextPipeline struct {
+	processors []textProcessor
+	always     []textProcessor
+}
+
+type textProcessor struct {
+	name string
+	fn   TextFunc
+}
+
+func NewTextPipeline() *TextPipeline {
+	return &TextPipeline{}
+}
+
+// Add adds fn after the processors added before it. The name shows in
+// its errors.
+func (p *TextPipeline) Add(name string, fn TextFunc) {
+	p.processors = append(p.processors, textProcessor{name, fn})
+}
+
+// Always adds fn to run on every message, consumed or not, like one that
+// keeps the history of the chat.
+func (p *TextPipeline) Always(name string, fn HandlerFunc) {
+	p.always = append(p.always, textProcessor{name, func(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+		return false, fn(ctx, s, u)
+	}})
+}
+
+// Register adds the pipeline to h as the handler of every text message.
+func (p *TextPipeline) Register(h Handler) {
+	h.Handle(AnyText, p.HandleText)
+}
+
+// HandleText runs the pipeline on u. The error is the one of the processor
+// that consumed u, so that its Reply is sent, or else the first one of
+// the others.
+func (p *TextPipeline) HandleText(ctx context.Context, s bot.Service, u bot.Update) error {
+	var err error
+	for _, proc := range p.processors {
+		var consumed bool
+		consumed, err = proc.fn(ctx, s, u)
+		if err != nil {
+			err = fmt.Errorf("text %s: %w", proc.name, err)
+			break
+		}
+		if consumed {
+			break
+		}
+	}
+
+	for _, proc := range p.always {
+		_, alwaysErr := proc.fn(ctx, s, u)
+		if alwaysErr == nil {
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("text %s: %w", proc.name, alwaysErr)
+		} else {
+			log.Print(fmt.Errorf("text %s: %w", proc.name, alwaysErr))
+		}
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package bothandler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestTextPipeline(t *testing.T) {
+	var got []string
+	processor := func(name string, trigger string, err error) TextFunc {
+		return func(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+			got = append(got, name)
+			if u.Message.Text != trigger {
+				return false, nil
+			}
+			return true, err
+		}
+	}
+
+	texts := NewTextPipeline()
+	texts.Add("sed", processor("sed", "s/a/b/", nil))
+	texts.Add("mention", processor("mention", "#futebol", Reply{Text: "@alice"}))
+	texts.Add("trigger", processor("trigger", "", nil))
+	texts.Always("history", func(ctx context.Context, s bot.Service, u bot.Update) error {
+		got = append(got, "history")
+		if u.Message.Text == "falha" {
+			return errors.New("full disk")
+		}
+		return nil
+	})
+
+	for _, tc := range []struct {
+		text  string
+		calls []string
+		err   string
+	}{
+		{"s/a/b/", []string{"sed", "history"}, ""},
+		{"oi", []string{"sed", "mention", "trigger", "history"}, ""},
+		{"falha", []string{"sed", "mention", "trigger", "history"}, "text history: full disk"},
+	} {
+		got = nil
+		err := texts.HandleText(context.Background(), &fakeBot{}, textUpdate(1, tc.text))
+		assertCalls(t, tc.calls, got)
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+			t.Fatalf("%q - err want: %q, got: %v", tc.text, tc.err, err)
+		}
+	}
+
+	// the reply of the processor that consumed it is sent
+	got = nil
+	err := texts.HandleText(context.Background(), &fakeBot{}, textUpdate(1, "#futebol"))
+	assertCalls(t, []string{"sed", "mention", "history"}, got)
+	var reply Reply
+	if !errors.As(err, &reply) || reply.Text != "@alice" {
+		t.Fatalf("want the reply of mention, got: %v", err)
+	}
+}
+
+func TestTextPipelineStopsAtError(t *testing.T) {
+	var got []string
+	texts := NewTextPipeline()
+	texts.Add("sed", func(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+		got = append(got, "sed")
+		return false, errors.New("broken")
+	})
+	texts.Add("mention", func(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+		got = append(got, "mention")
+		return false, nil
+	})
+	texts.Always("history", func(ctx context.Context, s bot.Service, u bot.Update) error {
+		got = append(got, "history")
+		return errors.New("full disk")
+	})
+
+	err := texts.HandleText(context.Background(), &fakeBot{}, textUpdate(1, "oi"))
+	if err == nil || err.Error() != "text sed: broken" {
+		t.Fatalf("want the error of sed, got: %v", err)
+	}
+	assertCalls(t, []string{"sed", "history"}, got)
+}
@@ -0,0 +1,236 @@
+package bottest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// ReadUpdates reads one update per line, skipping empty lines and lines
+// starting with "//".
+func ReadUpdates(r io.Reader) ([]bot.Update, error) {
+	updates := []bot.Update{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		var u bot.Update
+		err := json.Unmarshal([]byte(text), &u)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		updates = append(updates, u)
+	}
+	return updates, scanner.Err()
+}
+
+// Anonymizer replaces the IDs and names of users and chats with fake ones,
+// consistent along a session, so real chats can become fixtures. Users
+// get IDs from 1 in the order they appear, groups from -1001.
+type Anonymizer struct {
+	users     map[int64]int64
+	groups    map[int64]int64
+	usernames map[string]string
+}
+
+func NewAnonymizer() *Anonymizer {
+	return &Anonymizer{
+		users:     map[int64]int64{},
+		groups:    map[int64]int64{},
+		usernames: map[string]string{},
+	}
+}
+
+// Update returns a copy of u with the users and chats anonymized. Message
+// texts are kept, except for @mentions.
+func (a *Anonymizer) Update(u bot.Update) bot.Update {
+	u.Message = a.message(u.Message)
+	if u.CallbackQuery != nil {
+		cq := *u.CallbackQuery
+		cq.From = a.user(cq.From)
+		cq.Message = a.message(cq.Message)
+		u.CallbackQuery = &cq
+	}
+	if u.InlineQuery != nil {
+		iq := *u.InlineQuery
+		iq.From = a.user(iq.From)
+		u.InlineQuery = &iq
+	}
+	if u.PollAnswer != nil {
+		pa := *u.PollAnswer
+		pa.User = *a.user(&pa.User)
+		u.PollAnswer = &pa
+	}
+	return u
+}
+
+func (a *Anonymizer) message(msg *bot.Message) *bot.Message {
+	if msg == nil {
+		return nil
+	}
+
+	m := *msg
+	m.From = a.user(m.From)
+	m.FowardFrom = a.user(m.FowardFrom)
+	if m.ForwardSenderName != "" {
+		m.ForwardSenderName = "Forwarded"
+	}
+	m.Chat = a.chat(m.Chat)
+	if m.MigrateToChatID != 0 {
+		m.MigrateToChatID = a.chatID(m.MigrateToChatID)
+	}
+	m.ReplyToMessage = a.message(m.ReplyToMessage)
+	m.Text, m.Entities = a.entities(m.Text, m.Entities)
+	return &m
+}
+
+func (a *Anonymizer) user(user *bot.User) *bot.User {
+	if user == nil {
+		return nil
+	}
+
+	u := *user
+	if u.IsBot {
+		// bots are public, keep them recognizable
+		return &u
+	}
+
+	u.ID = a.userID(u.ID)
+	u.FirstName = fmt.Sprintf("User %d", u.ID)
+	if u.Username != "" {
+		u.Username = a.username(u.Username, u.ID)
+	}
+	return &u
+}
+
+func (a *Anonymizer) userID(id int64) int64 {
+	fake, ok := a.users[id]
+	if !ok {
+		fake = int64(len(a.users) + 1)
+		a.users[id] = fake
+	}
+	return fake
+}
+
+func (a *Anonymizer) username(username string, id int64) string {
+	fake, ok := a.usernames[username]
+	if !ok {
+		fake = fmt.Sprintf("user%d", id)
+		a.usernames[username] = fake
+	}
+	return fake
+}
+
+func (a *Anonymizer) chat(chat *bot.Chat) *bot.Chat {
+	if chat == nil {
+		return nil
+	}
+
+	c := *chat
+	c.ID = a.chatID(c.ID)
+	if c.Title != "" {
+		c.Title = fmt.Sprintf("Chat %d", c.ID)
+	}
+	if c.FirstName != "" {
+		c.FirstName = fmt.Sprintf("User %d", c.ID)
+	}
+	return &c
+}
+
+// chatID keeps private chats with the same ID as their user
+func (a *Anonymizer) chatID(id int64) int64 {
+	if id > 0 {
+		return a.userID(id)
+	}
+
+	fake, ok := a.groups[id]
+	if !ok {
+		fake = int64(-1001 - len(a.groups))
+		a.groups[id] = fake
+	}
+	return fake
+}
+
+// entities replaces the @mentions of text, moving the entities after
+// them. Offsets are in UTF-16 units.
+func (a *Anonymizer) entities(text string, entities []bot.MessageEntity) (string, []bot.MessageEntity) {
+	type replacement struct {
+		start, end int
+		text       []uint16
+	}
+
+	units := utf16.Encode([]rune(text))
+	replacements := []replacement{}
+	for _, e := range entities {
+		if e.Type != "mention" || e.Offset < 0 || e.Offset+e.Length > len(units) {
+			continue
+		}
+		username := strings.TrimPrefix(string(utf16.Decode(units[e.Offset:e.Offset+e.Length])), "@")
+		replacements = append(replacements, replacement{
+			start: e.Offset,
+			end:   e.Offset + e.Length,
+			text:  utf16.Encode([]rune("@" + a.mentioned(username))),
+		})
+	}
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start < replacements[j].start
+	})
+
+	out := []uint16{}
+	last := 0
+	for _, r := range replacements {
+		if r.start < last {
+			continue
+		}
+		out = append(out, units[last:r.start]...)
+		out = append(out, r.text...)
+		last = r.end
+	}
+	out = append(out, units[last:]...)
+
+	// where pos of the original text is in the new one
+	move := func(pos int) int {
+		shift := 0
+		for _, r := range replacements {
+			if pos >= r.end {
+				shift += len(r.text) - (r.end - r.start)
+			} else if pos > r.start {
+				return r.start + shift + len(r.text)
+			}
+		}
+		return pos + shift
+	}
+
+	anonymized := []bot.MessageEntity{}
+	for _, e := range entities {
+		start, end := move(e.Offset), move(e.Offset+e.Length)
+		e.Offset = start
+		e.Length = end - start
+		e.User = a.user(e.User)
+		anonymized = append(anonymized, e)
+	}
+
+	return string(utf16.Decode(out)), anonymized
+}
+
+// mentioned anonymizes the username of a mention, which may be of a user
+// not seen yet
+func (a *Anonymizer) mentioned(username string) string {
+	fake, ok := a.usernames[username]
+	if !ok {
+		fake = fmt.Sprintf("mentioned%d", len(a.usernames)+1)
+		a.usernames[username] = fake
+	}
+	return fake
+}
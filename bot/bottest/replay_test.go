@@ -0,0 +1,72 @@
+package bottest
+
+import (
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+func TestAnonymizer(t *testing.T) {
+	anon := NewAnonymizer()
+
+	alice := &bot.User{ID: 555, FirstName: "Alice", Username: "alice"}
+	group := &bot.Chat{ID: -100777, Type: "supergroup", Title: "Família"}
+
+	// "😀" takes 2 UTF-16 units, so @bob starts at 7
+	got := anon.Update(bot.Update{
+		Message: &bot.Message{
+			Text: "oi 😀 @bob, #futebol?",
+			From: alice,
+			Chat: group,
+			Entities: []bot.MessageEntity{
+				{Type: "mention", Offset: 6, Length: 4},
+				{Type: "hashtag", Offset: 12, Length: 8},
+			},
+			ReplyToMessage: &bot.Message{
+				From: &bot.User{ID: 999, FirstName: "Bob", Username: "bob"},
+				Chat: group,
+			},
+		},
+	})
+
+	msg := got.Message
+	if msg.From.ID != 1 || msg.From.Username != "user1" || msg.From.FirstName != "User 1" {
+		t.Errorf("from - want user 1, got: %+v", msg.From)
+	}
+	if msg.Chat.ID != -1001 || msg.Chat.Title != "Chat -1001" {
+		t.Errorf("chat - want -1001, got: %+v", msg.Chat)
+	}
+	if want := "oi 😀 @user2, #futebol?"; msg.Text != want {
+		t.Errorf("text - want: %q, got: %q", want, msg.Text)
+	}
+	if e := msg.Entities[0]; e.Offset != 6 || e.Length != 6 {
+		t.Errorf("mention - want offset 6 and length 6, got: %+v", e)
+	}
+	if e := msg.Entities[1]; e.Offset != 14 || e.Length != 8 {
+		t.Errorf("hashtag - want offset 14, got: %+v", e)
+	}
+	if reply := msg.ReplyToMessage.From; reply.ID != 2 || reply.Username != "user2" {
+		t.Errorf("reply from - want user 2, got: %+v", reply)
+	}
+
+	// the same user keeps the same ID along the session
+	again := anon.Update(bot.Update{
+		CallbackQuery: &bot.CallbackQuery{
+			From: alice,
+			Message: &bot.Message{
+				Text:     "@carol",
+				Chat:     &bot.Chat{ID: 555, Type: "private", FirstName: "Alice"},
+				Entities: []bot.MessageEntity{{Type: "mention", Offset: 0, Length: 6}},
+			},
+		},
+	})
+	if got := again.CallbackQuery.Message.Text; got != "@mentioned3" {
+		t.Errorf("unknown mention - want: %s, got: %s", "@mentioned3", got)
+	}
+	if again.CallbackQuery.From.ID != 1 || again.CallbackQuery.Message.Chat.ID != 1 {
+		t.Errorf("want user 1 and their private chat 1, got: %+v", again.CallbackQuery)
+	}
+	if alice.ID != 555 {
+		t.Error("want the original update untouched")
+	}
+}
@@ -0,0 +1,574 @@
+// Package bottest provides a fake Bot API server for end-to-end tests of
+// the handlers. It records everything the bot sends, so tests can inject
+// updates and assert on the replies.
+package bottest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+)
+
+// Request is a call to the Bot API. Body is empty when it isn't JSON.
+type Request struct {
+	Method string          `json:"method"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Document is a file sent with sendDocument.
+type Document struct {
+	ChatID   int64
+	FileName string
+	Size     int
+}
+
+type Server struct {
+	// URL is the base URL to create the service with, see Service
+	URL   string
+	Token string
+	// Me is the bot, as returned by getMe
+	Me bot.User
+
+	srv     *httptest.Server
+	closing chan struct{}
+
+	mut           sync.Mutex
+	newUpdate     chan struct{}
+	updates       []bot.Update
+	lastUpdateID  int
+	lastMessageID int
+	offset        int
+	members       map[[2]int64]string
+	texts         map[[2]int64]string
+	failures      map[string][]failure
+
+	requests        []Request
+	sent            []bot.SendMessageParams
+	messages        []bot.Message
+	edits           []bot.EditMessageTextParams
+	polls           []bot.SendPollParams
+	voices          []bot.SendVoiceParams
+	documents       []Document
+	inlineAnswers   []bot.AnswerInlineQueryParams
+	callbackAnswers []bot.AnswerCallbackQueryParams
+	commands        []bot.SetMyCommandsParams
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Token: "123:test",
+		Me: bot.User{
+			ID:        123,
+			IsBot:     true,
+			FirstName: "Bot",
+			Username:  "test_bot",
+		},
+		closing:   make(chan struct{}),
+		newUpdate: make(chan struct{}),
+		members:   map[[2]int64]string{},
+		texts:     map[[2]int64]string{},
+		failures:  map[string][]failure{},
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL + "/bot"
+	return s
+}
+
+// Close stops the server, ending pending long polls.
+func (s *Server) Close() {
+	close(s.closing)
+	s.srv.Close()
+}
+
+// Service returns a bot.Service that calls s without rate limits.
+func (s *Server) Service() bot.Service {
+	return bot.NewService(s.Token, bot.WithBaseURL(s.URL), bot.WithLimits(bot.Limits{}))
+}
+
+// AddUpdate queues u for getUpdates, setting its ID.
+func (s *Server) AddUpdate(u bot.Update) bot.Update {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.lastUpdateID++
+	u.UpdateID = s.lastUpdateID
+	s.updates = append(s.updates, u)
+
+	close(s.newUpdate)
+	s.newUpdate = make(chan struct{})
+	return u
+}
+
+// SendText queues a text message from the user to the chat. The returned
+// message can be replied to or passed to Press.
+func (s *Server) SendText(chat bot.Chat, from bot.User, text string) bot.Message {
+	return s.SendMessage(bot.Message{
+		Chat: &chat,
+		From: &from,
+		Text: text,
+	})
+}
+
+// SendMessage queues msg as sent by a user, setting its ID and date.
+func (s *Server) SendMessage(msg bot.Message) bot.Message {
+	s.mut.Lock()
+	s.lastMessageID++
+	msg.MessageID = s.lastMessageID
+	msg.Date = time.Now().Unix()
+	s.mut.Unlock()
+
+	s.AddUpdate(bot.Update{Message: &msg})
+	return msg
+}
+
+// EditText queues the edit of msg, a message sent by a user, to text.
+func (s *Server) EditText(msg bot.Message, text string) bot.Message {
+	msg.Text = text
+	msg.EditDate = time.Now().Unix()
+	s.AddUpdate(bot.Update{EditedMessage: &msg})
+	return msg
+}
+
+// Press queues a callback query as if the user pressed a button with data
+// on msg.
+func (s *Server) Press(msg bot.Message, from bot.User, data string) {
+	s.mut.Lock()
+	id := strconv.Itoa(s.lastUpdateID + 1)
+	s.mut.Unlock()
+
+	s.AddUpdate(bot.Update{
+		CallbackQuery: &bot.CallbackQuery{
+			ID:      id,
+			From:    &from,
+			Message: &msg,
+			Data:    data,
+		},
+	})
+}
+
+// SetChatMember sets the status returned by getChatMember, like
+// "administrator". Unknown users are "member".
+func (s *Server) SetChatMember(chatID int64, userID int64, status string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.members[[2]int64{chatID, userID}] = status
+}
+
+// failure is a Bot API error to answer a call with, see Fail. The zero
+// value lets the call go through.
+type failure struct {
+	code        int
+	description string
+}
+
+// Fail makes the next n calls to method fail with the Bot API error code
+// and description, like 403 and "Forbidden: bot was kicked from the group
+// chat".
+func (s *Server) Fail(method string, n int, code int, description string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures[method] = append(s.failures[method], failure{code, description})
+	}
+}
+
+// FailAfter is like Fail, but the n calls fail after ok others go through.
+func (s *Server) FailAfter(method string, ok int, n int, code int, description string) {
+	s.mut.Lock()
+	for i := 0; i < ok; i++ {
+		s.failures[method] = append(s.failures[method], failure{})
+	}
+	s.mut.Unlock()
+
+	s.Fail(method, n, code, description)
+}
+
+// nextFailure pops the failure for a call to method, if any. s.mut must
+// be held.
+func (s *Server) nextFailure(method string) (failure, bool) {
+	failures := s.failures[method]
+	if len(failures) == 0 {
+		return failure{}, false
+	}
+	s.failures[method] = failures[1:]
+	return failures[0], failures[0].code != 0
+}
+
+// WaitFor checks cond until it's true or the timeout expires, returning
+// the last result.
+func (s *Server) WaitFor(cond func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+// Offset is the offset the bot confirmed updates with.
+func (s *Server) Offset() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.offset
+}
+
+// Requests are the calls made so far, in order.
+func (s *Server) Requests() []Request {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+func (s *Server) Sent() []bot.SendMessageParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.SendMessageParams{}, s.sent...)
+}
+
+// Messages are the messages created by sendMessage, in the order of Sent.
+func (s *Server) Messages() []bot.Message {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.Message{}, s.messages...)
+}
+
+// SentTexts are the texts of Sent.
+func (s *Server) SentTexts() []string {
+	texts := []string{}
+	for _, params := range s.Sent() {
+		texts = append(texts, params.Text)
+	}
+	return texts
+}
+
+func (s *Server) Edits() []bot.EditMessageTextParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.EditMessageTextParams{}, s.edits...)
+}
+
+func (s *Server) Polls() []bot.SendPollParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.SendPollParams{}, s.polls...)
+}
+
+func (s *Server) Voices() []bot.SendVoiceParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.SendVoiceParams{}, s.voices...)
+}
+
+func (s *Server) Documents() []Document {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]Document{}, s.documents...)
+}
+
+func (s *Server) InlineAnswers() []bot.AnswerInlineQueryParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.AnswerInlineQueryParams{}, s.inlineAnswers...)
+}
+
+func (s *Server) CallbackAnswers() []bot.AnswerCallbackQueryParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.AnswerCallbackQueryParams{}, s.callbackAnswers...)
+}
+
+func (s *Server) Commands() []bot.SetMyCommandsParams {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]bot.SetMyCommandsParams{}, s.commands...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+s.Token+"/")
+	if !ok {
+		fail(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req := Request{Method: method}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			fail(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if len(body) > 0 {
+			req.Body = body
+		}
+	}
+
+	s.mut.Lock()
+	s.requests = append(s.requests, req)
+	f, failing := s.nextFailure(method)
+	s.mut.Unlock()
+
+	if failing {
+		fail(w, f.code, f.description)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		respond(w, s.Me)
+	case "getUpdates":
+		s.getUpdates(w, r)
+	case "getChatMember":
+		s.getChatMember(w, r)
+	case "sendMessage":
+		s.sendMessage(w, r)
+	case "editMessageText":
+		s.editMessageText(w, r)
+	case "sendPoll":
+		s.sendPoll(w, r)
+	case "sendVoice":
+		s.sendVoice(w, r)
+	case "sendDocument":
+		s.sendDocument(w, r)
+	case "answerInlineQuery":
+		record(w, r, &s.mut, &s.inlineAnswers)
+	case "answerCallbackQuery":
+		record(w, r, &s.mut, &s.callbackAnswers)
+	case "setMyCommands":
+		record(w, r, &s.mut, &s.commands)
+	case "setWebhook", "deleteWebhook":
+		respond(w, true)
+	default:
+		fail(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	var params bot.GetUpdatesParams
+	if !decode(w, r, &params) {
+		return
+	}
+
+	if params.Limit == 0 {
+		// the default of Telegram
+		params.Limit = 100
+	}
+
+	deadline := time.After(time.Duration(params.Timeout) * time.Second)
+	for {
+		s.mut.Lock()
+		if params.Offset > s.offset {
+			s.offset = params.Offset
+		}
+		updates := []bot.Update{}
+		for _, u := range s.updates {
+			if u.UpdateID >= s.offset && len(updates) < params.Limit {
+				updates = append(updates, u)
+			}
+		}
+		newUpdate := s.newUpdate
+		s.mut.Unlock()
+
+		if len(updates) > 0 || params.Timeout == 0 {
+			respond(w, updates)
+			return
+		}
+
+		select {
+		case <-newUpdate:
+		case <-deadline:
+			respond(w, updates)
+			return
+		case <-s.closing:
+			respond(w, updates)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) getChatMember(w http.ResponseWriter, r *http.Request) {
+	var params bot.GetChatMemberParams
+	if !decode(w, r, &params) {
+		return
+	}
+
+	s.mut.Lock()
+	status, ok := s.members[[2]int64{params.ChatID, params.UserID}]
+	s.mut.Unlock()
+	if !ok {
+		status = "member"
+	}
+	respond(w, bot.ChatMember{Status: status})
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	var params bot.SendMessageParams
+	if !decode(w, r, &params) {
+		return
+	}
+
+	s.mut.Lock()
+	s.sent = append(s.sent, params)
+	msg := s.botMessage(params.ChatID)
+	msg.Text = params.Text
+	s.messages = append(s.messages, msg)
+	s.texts[[2]int64{params.ChatID, int64(msg.MessageID)}] = params.Text
+	s.mut.Unlock()
+
+	respond(w, msg)
+}
+
+func (s *Server) editMessageText(w http.ResponseWriter, r *http.Request) {
+	var params bot.EditMessageTextParams
+	if !decode(w, r, &params) {
+		return
+	}
+
+	s.mut.Lock()
+	key := [2]int64{params.ChatID, int64(params.MessageID)}
+	old, ok := s.texts[key]
+	if ok && old == params.Text {
+		s.mut.Unlock()
+		fail(w, http.StatusBadRequest, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message")
+		return
+	}
+	s.edits = append(s.edits, params)
+	s.texts[key] = params.Text
+	s.mut.Unlock()
+
+	respond(w, bot.Message{
+		MessageID: params.MessageID,
+		Chat:      &bot.Chat{ID: params.ChatID},
+		From:      &s.Me,
+		Text:      params.Text,
+	})
+}
+
+func (s *Server) sendPoll(w http.ResponseWriter, r *http.Request) {
+	var params bot.SendPollParams
+	if !decode(w, r, &params) {
+		return
+	}
+
+	s.mut.Lock()
+	s.polls = append(s.polls, params)
+	msg := s.botMessage(params.ChatID)
+	msg.Poll = &bot.Poll{ID: strconv.Itoa(msg.MessageID)}
+	s.mut.Unlock()
+
+	respond(w, msg)
+}
+
+func (s *Server) sendVoice(w http.ResponseWriter, r *http.Request) {
+	var params bot.SendVoiceParams
+	if !decode(w, r, &params) {
+		return
+	}
+
+	s.mut.Lock()
+	s.voices = append(s.voices, params)
+	msg := s.botMessage(params.ChatID)
+	msg.Voice = &bot.Voice{FileID: params.Voice}
+	s.mut.Unlock()
+
+	respond(w, msg)
+}
+
+func (s *Server) sendDocument(w http.ResponseWriter, r *http.Request) {
+	f, header, err := r.FormFile("document")
+	if err != nil {
+		fail(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	chatID, err := strconv.ParseInt(r.FormValue("chat_id"), 10, 64)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "Bad Request: chat_id is empty")
+		return
+	}
+
+	s.mut.Lock()
+	s.documents = append(s.documents, Document{
+		ChatID:   chatID,
+		FileName: header.Filename,
+		Size:     len(content),
+	})
+	msg := s.botMessage(chatID)
+	s.mut.Unlock()
+
+	respond(w, msg)
+}
+
+// botMessage is a new message sent by the bot. s.mut must be held.
+func (s *Server) botMessage(chatID int64) bot.Message {
+	s.lastMessageID++
+	return bot.Message{
+		MessageID: s.lastMessageID,
+		Date:      time.Now().Unix(),
+		Chat:      &bot.Chat{ID: chatID},
+		From:      &s.Me,
+	}
+}
+
+// record appends the params of the request to list.
+func record[T any](w http.ResponseWriter, r *http.Request, mut *sync.Mutex, list *[]T) {
+	var params T
+	if !decode(w, r, &params) {
+		return
+	}
+
+	mut.Lock()
+	*list = append(*list, params)
+	mut.Unlock()
+
+	respond(w, true)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, params any) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	err := json.NewDecoder(r.Body).Decode(params)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func respond(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(bot.Result[any]{
+		Ok:     true,
+		Result: result,
+	})
+}
+
+func fail(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(bot.Result[any]{
+		ErrorCode:   code,
+		Description: description,
+	})
+}
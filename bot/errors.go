@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by BotError, so callers can use errors.Is
+// instead of looking at the description.
+var (
+	ErrTooManyRequests    = errors.New("too many requests")
+	ErrChatMigrated       = errors.New("group chat was upgraded to a supergroup chat")
+	ErrMessageNotModified = errors.New("message is not modified")
+	ErrMessageNotFound    = errors.New("message to edit not found")
+	ErrReplyNotFound      = errors.New("message to reply not found")
+	ErrChatNotFound       = errors.New("chat not found")
+	ErrBotBlocked         = errors.New("bot was blocked by the user")
+	ErrBotKicked          = errors.New("bot was kicked")
+)
+
+type BotError struct {
+	Path         string
+	Status       int
+	RequestBody  []byte
+	ResponseBody []byte
+	ErrorCode    int
+	Description  string
+	Parameters   *ResponseParameters
+}
+
+func (e BotError) Error() string {
+	return fmt.Sprintf(
+		"POST %s\n%s\n\nStatus %s\n\n%s",
+		e.Path,
+		string(e.RequestBody),
+		http.StatusText(e.Status),
+		string(e.ResponseBody),
+	)
+}
+
+func (e BotError) Is(target error) bool {
+	switch target {
+	case ErrTooManyRequests:
+		return e.ErrorCode == http.StatusTooManyRequests
+	case ErrChatMigrated:
+		return e.Parameters != nil && e.Parameters.MigrateToChatID != 0
+	case ErrMessageNotModified,
+		ErrMessageNotFound,
+		ErrReplyNotFound,
+		ErrChatNotFound,
+		ErrBotBlocked,
+		ErrBotKicked:
+		return strings.Contains(e.Description, target.Error())
+	}
+	return false
+}
+
+// RetryAfter is how many seconds to wait before repeating the request,
+// when Telegram says so.
+func (e BotError) RetryAfter() int {
+	if e.Parameters == nil {
+		return 0
+	}
+	return e.Parameters.RetryAfter
+}
+
+// MigrateToChatID is the new ID of a group that became a supergroup.
+func (e BotError) MigrateToChatID() int64 {
+	if e.Parameters == nil {
+		return 0
+	}
+	return e.Parameters.MigrateToChatID
+}
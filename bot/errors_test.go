@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+func TestBotErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{400, `{"ok":false,"error_code":400,"description":"Bad Request: message is not modified: specified new message content and reply markup are exactly the same"}`, ErrMessageNotModified},
+		{400, `{"ok":false,"error_code":400,"description":"Bad Request: message to reply not found"}`, ErrReplyNotFound},
+		{400, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, ErrChatNotFound},
+		{403, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`, ErrBotBlocked},
+		{400, `{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1001234}}`, ErrChatMigrated},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			_, _ = w.Write([]byte(tt.body))
+		}))
+
+		s := &service{
+			baseURL:   srv.URL + "/bot",
+			retry:     util.Retry{MaxAttempts: 1},
+			scheduler: newScheduler(Limits{}),
+		}
+
+		_, err := s.SendMessage(context.Background(), SendMessageParams{ChatID: 1, Text: "oi"})
+		srv.Close()
+
+		if !errors.Is(err, tt.want) {
+			t.Errorf("want: %v, got: %v", tt.want, err)
+			continue
+		}
+
+		var botErr BotError
+		if !errors.As(err, &botErr) {
+			t.Fatalf("want BotError, got: %T", err)
+		}
+		if botErr.ErrorCode != tt.status {
+			t.Errorf("error code - want: %d, got: %d", tt.status, botErr.ErrorCode)
+		}
+		if tt.want == ErrChatMigrated && botErr.MigrateToChatID() != -1001234 {
+			t.Errorf("migrate to chat id - want: %d, got: %d", -1001234, botErr.MigrateToChatID())
+		}
+		if tt.want != ErrMessageNotModified && errors.Is(err, ErrMessageNotModified) {
+			t.Errorf("%s matched %v", botErr.Description, ErrMessageNotModified)
+		}
+	}
+}
+
+func TestTooManyRequests(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(429)
+			_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"username":"bot"}}`))
+	}))
+	defer srv.Close()
+
+	s := &service{
+		token:     "123:abc",
+		baseURL:   srv.URL + "/bot",
+		retry:     util.Retry{MaxAttempts: 1},
+		scheduler: newScheduler(DefaultLimits),
+	}
+
+	// waiting is not an attempt
+	_, err := s.GetMe(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("want the request repeated, got %d calls", calls)
+	}
+	// the request has no chat, the chats can go on
+	if !s.scheduler.global.blocked.IsZero() {
+		t.Fatalf("want the chats not held, got held until %s", s.scheduler.global.blocked)
+	}
+}
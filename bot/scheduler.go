@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+// Rate allows one request every Interval, with bursts of up to Burst
+// requests. The zero value means no limit.
+type Rate struct {
+	Interval time.Duration
+	Burst    int
+}
+
+// Limits are the outbound budgets enforced by the bot before sending
+// anything to Telegram.
+// See https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+type Limits struct {
+	// Global applies to every chat combined
+	Global Rate
+	// Chat applies to each chat individually
+	Chat Rate
+	// Group applies to each group and channel, on top of Chat
+	Group Rate
+}
+
+var DefaultLimits = Limits{
+	Global: Rate{Interval: time.Second / 30, Burst: 30},
+	Chat:   Rate{Interval: time.Second, Burst: 1},
+	Group:  Rate{Interval: 3 * time.Second, Burst: 20},
+}
+
+// bucket implements GCRA (generic cell rate algorithm) on top of Rate.
+type bucket struct {
+	Rate
+	tat     time.Time // theoretical arrival time
+	blocked time.Time // set when Telegram asks us to retry after a while
+}
+
+func (b *bucket) allowAt(t time.Time) time.Time {
+	if t.Before(b.blocked) {
+		t = b.blocked
+	}
+	if b.Interval == 0 {
+		return t
+	}
+
+	tat := b.tat
+	if tat.Before(t) {
+		tat = t
+	}
+	allow := tat.Add(-time.Duration(b.Burst-1) * b.Interval)
+	if allow.Before(t) {
+		return t
+	}
+	return allow
+}
+
+func (b *bucket) reserve(t time.Time) {
+	if b.Interval == 0 {
+		return
+	}
+	if b.tat.Before(t) {
+		b.tat = t
+	}
+	b.tat = b.tat.Add(b.Interval)
+}
+
+func (b *bucket) idle(t time.Time) bool {
+	return b.tat.Before(t) && b.blocked.Before(t)
+}
+
+// scheduler queues outbound requests so the bot stays inside Limits.
+// Each request reserves the first slot allowed by every budget it counts
+// against, so requests to the same chat are sent in the order they arrived.
+type scheduler struct {
+	mut    sync.Mutex
+	limits Limits
+	global *bucket
+	chats  map[int64]*chatBuckets
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+}
+
+type chatBuckets struct {
+	chat  *bucket
+	group *bucket
+}
+
+func newScheduler(limits Limits) *scheduler {
+	return &scheduler{
+		limits: limits,
+		global: &bucket{Rate: limits.Global},
+		chats:  map[int64]*chatBuckets{},
+		now:    time.Now,
+		sleep:  util.Sleep,
+	}
+}
+
+// wait blocks until a request to chatID can be sent or ctx is done.
+func (s *scheduler) wait(ctx context.Context, chatID int64) error {
+	d := s.reserve(chatID).Sub(s.now())
+	if d <= 0 {
+		return nil
+	}
+	return s.sleep(ctx, d)
+}
+
+// reserve books the next slot available for chatID and returns its time.
+func (s *scheduler) reserve(chatID int64) time.Time {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	now := s.now()
+	buckets := s.buckets(chatID, now)
+
+	at := now
+	for _, b := range buckets {
+		if t := b.allowAt(at); t.After(at) {
+			at = t
+		}
+	}
+	for _, b := range buckets {
+		b.reserve(at)
+	}
+	return at
+}
+
+// hold stops sending to chatID for d.
+func (s *scheduler) hold(chatID int64, d time.Duration) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	now := s.now()
+	until := now.Add(d)
+
+	b := s.buckets(chatID, now)[1]
+	if b.blocked.Before(until) {
+		b.blocked = until
+	}
+}
+
+// buckets returns the budgets a request to chatID counts against, with the
+// global one first and the chat one second.
+func (s *scheduler) buckets(chatID int64, now time.Time) []*bucket {
+	c, ok := s.chats[chatID]
+	if !ok {
+		s.prune(now)
+		c = &chatBuckets{chat: &bucket{Rate: s.limits.Chat}}
+		if isGroup(chatID) {
+			c.group = &bucket{Rate: s.limits.Group}
+		}
+		s.chats[chatID] = c
+	}
+
+	buckets := []*bucket{s.global, c.chat}
+	if c.group != nil {
+		buckets = append(buckets, c.group)
+	}
+	return buckets
+}
+
+// prune forgets chats that have no pending reservations
+func (s *scheduler) prune(now time.Time) {
+	if len(s.chats) < 1000 {
+		return
+	}
+	for id, c := range s.chats {
+		if c.chat.idle(now) && (c.group == nil || c.group.idle(now)) {
+			delete(s.chats, id)
+		}
+	}
+}
+
+// groups, supergroups and channels have negative IDs
+func isGroup(chatID int64) bool {
+	return chatID < 0
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(limits Limits) (*scheduler, *time.Time) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newScheduler(limits)
+	s.now = func() time.Time { return now }
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return nil
+	}
+	return s, &now
+}
+
+func TestSchedulerChat(t *testing.T) {
+	s, now := newTestScheduler(Limits{
+		Chat: Rate{Interval: time.Second, Burst: 1},
+	})
+	start := *now
+
+	for i := 0; i < 3; i++ {
+		got := s.reserve(1).Sub(start)
+		want := time.Duration(i) * time.Second
+		if got != want {
+			t.Errorf("reserve %d - want: %s, got: %s", i, want, got)
+		}
+	}
+
+	// other chats are not affected
+	if got := s.reserve(2); !got.Equal(start) {
+		t.Errorf("other chat - want: %s, got: %s", start, got)
+	}
+}
+
+func TestSchedulerGroup(t *testing.T) {
+	s, now := newTestScheduler(Limits{
+		Group: Rate{Interval: 3 * time.Second, Burst: 20},
+	})
+	start := *now
+
+	for i := 0; i < 20; i++ {
+		if got := s.reserve(-1); !got.Equal(start) {
+			t.Fatalf("reserve %d - want: %s, got: %s", i, start, got)
+		}
+	}
+
+	// burst exhausted: 20 per minute means one every 3 seconds
+	if got := s.reserve(-1).Sub(start); got != 3*time.Second {
+		t.Fatalf("want: 3s, got: %s", got)
+	}
+
+	// private chats have no group limit
+	if got := s.reserve(1); !got.Equal(start) {
+		t.Fatalf("private chat - want: %s, got: %s", start, got)
+	}
+}
+
+func TestSchedulerGlobal(t *testing.T) {
+	s, now := newTestScheduler(Limits{
+		Global: Rate{Interval: time.Second / 30, Burst: 30},
+	})
+	start := *now
+
+	for i := 0; i < 30; i++ {
+		if got := s.reserve(int64(i + 1)); !got.Equal(start) {
+			t.Fatalf("reserve %d - want: %s, got: %s", i, start, got)
+		}
+	}
+
+	if got := s.reserve(100).Sub(start); got != time.Second/30 {
+		t.Fatalf("want: %s, got: %s", time.Second/30, got)
+	}
+}
+
+func TestSchedulerHold(t *testing.T) {
+	s, now := newTestScheduler(Limits{})
+	start := *now
+
+	s.hold(1, 5*time.Second)
+
+	if got := s.reserve(1).Sub(start); got != 5*time.Second {
+		t.Fatalf("held chat - want: 5s, got: %s", got)
+	}
+	if got := s.reserve(2); !got.Equal(start) {
+		t.Fatalf("other chat - want: %s, got: %s", start, got)
+	}
+
+	err := s.wait(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := now.Sub(start); got != 5*time.Second {
+		t.Fatalf("wait - want: 5s, got: %s", got)
+	}
+}
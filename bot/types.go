@@ -3,16 +3,26 @@ package bot
 import "encoding/json"
 
 type Message struct {
-	MessageID         int      `json:"message_id"`
-	Date              int64    `json:"date"`
-	Text              string   `json:"text,omitempty"`
-	ForwardSenderName string   `json:"forward_sender_name,omitempty"`
-	From              *User    `json:"from,omitempty"`
-	FowardFrom        *User    `json:"forward_from,omitempty"`
-	Chat              *Chat    `json:"chat,omitempty"`
-	ReplyToMessage    *Message `json:"reply_to_message,omitempty"`
-	Poll              *Poll    `json:"poll,omitempty"`
-	Voice             *Voice   `json:"voice,omitempty"`
+	MessageID         int             `json:"message_id"`
+	Date              int64           `json:"date"`
+	EditDate          int64           `json:"edit_date,omitempty"`
+	Text              string          `json:"text,omitempty"`
+	ForwardSenderName string          `json:"forward_sender_name,omitempty"`
+	From              *User           `json:"from,omitempty"`
+	FowardFrom        *User           `json:"forward_from,omitempty"`
+	Chat              *Chat           `json:"chat,omitempty"`
+	ReplyToMessage    *Message        `json:"reply_to_message,omitempty"`
+	Poll              *Poll           `json:"poll,omitempty"`
+	Voice             *Voice          `json:"voice,omitempty"`
+	MigrateToChatID   int64           `json:"migrate_to_chat_id,omitempty"`
+	Entities          []MessageEntity `json:"entities,omitempty"`
+}
+
+type MessageEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	User   *User  `json:"user,omitempty"`
 }
 
 type Voice struct {
@@ -95,6 +105,7 @@ func (c Chat) Name() string {
 type Update struct {
 	UpdateID      int            `json:"update_id"`
 	Message       *Message       `json:"message,omitempty"`
+	EditedMessage *Message       `json:"edited_message,omitempty"`
 	PollAnswer    *PollAnswer    `json:"poll_answer,omitempty"`
 	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
 	InlineQuery   *InlineQuery   `json:"inline_query,omitempty"`
@@ -132,6 +143,12 @@ type AnswerInlineQueryParams struct {
 	Results       []InlineQueryResult `json:"results"`
 }
 
+type AnswerCallbackQueryParams struct {
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+}
+
 type SendDocumentParams struct {
 	ChatID   int64
 	FileName string
@@ -156,11 +173,45 @@ type GetChatMemberParams struct {
 
 type GetUpdatesParams struct {
 	Offset         int      `json:"offset,omitempty"`
+	Limit          int      `json:"limit,omitempty"`
 	Timeout        int      `json:"timeout,omitempty"`
 	AllowedUpdates []string `json:"allowed_updates,omitempty"`
 }
 
+type SetWebhookParams struct {
+	URL                string   `json:"url"`
+	SecretToken        string   `json:"secret_token,omitempty"`
+	AllowedUpdates     []string `json:"allowed_updates,omitempty"`
+	DropPendingUpdates bool     `json:"drop_pending_updates,omitempty"`
+}
+
+type DeleteWebhookParams struct {
+	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"`
+}
+
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+type BotCommandScope struct {
+	Type string `json:"type"`
+}
+
+type SetMyCommandsParams struct {
+	Commands []BotCommand     `json:"commands"`
+	Scope    *BotCommandScope `json:"scope,omitempty"`
+}
+
 type Result[T any] struct {
-	Ok     bool `json:"ok"`
-	Result T    `json:"result"`
+	Ok          bool                `json:"ok"`
+	Result      T                   `json:"result"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+}
+
+type ResponseParameters struct {
+	MigrateToChatID int64 `json:"migrate_to_chat_id,omitempty"`
+	RetryAfter      int   `json:"retry_after,omitempty"`
 }
@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateSize is way more than any update Telegram sends.
+const maxUpdateSize = 1 << 20
+
+// WebhookHandler receives the updates Telegram POSTs to the webhook URL
+// and sends them to Updates, the same way GetUpdatesChannel does when polling.
+// Without a Secret every request is refused, since anyone could send updates.
+type WebhookHandler struct {
+	Secret  string
+	Updates chan<- Update
+}
+
+var _ http.Handler = WebhookHandler{}
+
+func (h WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get(secretTokenHeader)
+	if h.Secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(h.Secret)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	var u Update
+	body := http.MaxBytesReader(w, r.Body, maxUpdateSize)
+	err := json.NewDecoder(body).Decode(&u)
+	if err != nil {
+		log.Print("webhook: invalid update: ", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.Updates <- u:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram retries updates that were not answered with 2xx
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
+}
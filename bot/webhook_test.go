@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	updates := make(chan Update, 1)
+	h := WebhookHandler{
+		Secret:  "secret",
+		Updates: updates,
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		wantStatus int
+	}{
+		{"wrong method", "GET", "secret", "", http.StatusMethodNotAllowed},
+		{"missing secret", "POST", "", `{"update_id": 1}`, http.StatusUnauthorized},
+		{"wrong secret", "POST", "wrong", `{"update_id": 1}`, http.StatusUnauthorized},
+		{"invalid body", "POST", "secret", `{`, http.StatusBadRequest},
+		{"body too large", "POST", "secret", `{"update_id": 1, "message": {"text": "` + strings.Repeat("a", maxUpdateSize) + `"}}`, http.StatusBadRequest},
+		{"valid update", "POST", "secret", `{"update_id": 42, "message": {"message_id": 1, "text": "oi"}}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+		if tt.secret != "" {
+			req.Header.Set(secretTokenHeader, tt.secret)
+		}
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status - want: %d, got: %d", tt.name, tt.wantStatus, rec.Code)
+		}
+	}
+
+	if len(updates) != 1 {
+		t.Fatalf("updates - want: 1, got: %d", len(updates))
+	}
+	u := <-updates
+	if u.UpdateID != 42 || u.Message == nil || u.Message.Text != "oi" {
+		t.Fatalf("unexpected update: %s", u)
+	}
+}
+
+func TestWebhookHandlerWithoutSecret(t *testing.T) {
+	updates := make(chan Update, 1)
+	h := WebhookHandler{Updates: updates}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"update_id": 1}`))
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status - want: %d, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+	if len(updates) != 0 {
+		t.Fatalf("updates - want: 0, got: %d", len(updates))
+	}
+}
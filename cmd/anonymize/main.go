@@ -0,0 +1,49 @@
+// Command anonymize turns the updates logged by the bot into a replay
+// fixture, replacing the IDs and names of users and chats.
+//
+//	grep update_id bot.log | go run ./cmd/anonymize > testdata/replay/session.jsonl
+//
+// Each line may have a log prefix, the update starts at the first "{".
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/bot/bottest"
+)
+
+func main() {
+	anon := bottest.NewAnonymizer()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 1024*1024)
+	out := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "{")
+		if i == -1 {
+			continue
+		}
+
+		var u bot.Update
+		err := json.Unmarshal([]byte(line[i:]), &u)
+		if err != nil || u.UpdateID == 0 {
+			continue
+		}
+
+		err = out.Encode(anon.Update(u))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
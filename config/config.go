@@ -3,13 +3,68 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"time"
+)
+
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
 )
 
 type Config struct {
-	GodID     int64
-	GPTUserID int64 `json:"gptUserID"`
-	BotToken  string
-	OpenAIKey string
+	GodID      int64
+	GPTUserID  int64 `json:"gptUserID"`
+	BotToken   string
+	OpenAIKey  string
+	UpdateMode string
+	Webhook    WebhookConfig
+	Schedule   ScheduleConfig
+	Updates    UpdatesConfig
+}
+
+type WebhookConfig struct {
+	// URL is the public address Telegram will POST updates to
+	URL string `json:"url"`
+	// Addr is the address the webhook HTTP server listens on, like ":8080"
+	Addr string
+	// Secret is sent by Telegram in the X-Telegram-Bot-Api-Secret-Token
+	// header. Required in webhook mode
+	Secret string
+}
+
+// ScheduleConfig tunes the sending of the /agenda mentions. Zero values
+// are the defaults of topic.Runner.
+type ScheduleConfig struct {
+	// CatchUp is how late a mention is still sent, as after the bot was
+	// down, like "15m"
+	CatchUp Duration
+	// MaxAttempts to send a mention before giving up
+	MaxAttempts int
+	// RetryDelay is the wait after the first failed attempt, like "30s"
+	RetryDelay Duration
+}
+
+// UpdatesConfig tunes the handling of updates. Values below 1 are the
+// defaults of bothandler.UpdateController.
+type UpdatesConfig struct {
+	// Workers is how many updates are handled in parallel
+	Workers int
+	// QueueSize is how many updates wait for a worker before polling stops
+	QueueSize int
+}
+
+// Duration is a time.Duration written like "1h30m" in the JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	*d = Duration(parsed)
+	return err
 }
 
 func Load() (c Config, err error) {
@@ -18,5 +73,8 @@ func Load() (c Config, err error) {
 		return
 	}
 	err = json.Unmarshal(b, &c)
+	if c.UpdateMode == "" {
+		c.UpdateMode = UpdateModePolling
+	}
 	return
 }
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -10,9 +9,6 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
-	"os/exec"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -21,18 +17,21 @@ import (
 	"github.com/igoracmelo/euperturbot/config"
 	"github.com/igoracmelo/euperturbot/openai"
 	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/sed"
+	"github.com/igoracmelo/euperturbot/settings"
 	"github.com/igoracmelo/euperturbot/util"
 )
 
 type Controller struct {
-	Repo    repo.Repo
-	OpenAI  openai.Service
-	BotInfo *bot.User
-	Config  *config.Config
+	Repo     repo.Repo
+	OpenAI   openai.Service
+	BotInfo  *bot.User
+	Config   *config.Config
+	Settings settings.Service
 }
 
-func (h Controller) Start(s bot.Service, u bot.Update) error {
-	err := h.Repo.SaveChat(context.TODO(), repo.Chat{
+func (h Controller) Start(ctx context.Context, s bot.Service, u bot.Update) error {
+	err := h.Repo.SaveChat(ctx, repo.Chat{
 		ID:    u.Message.Chat.ID,
 		Title: u.Message.Chat.Name(),
 	})
@@ -40,7 +39,7 @@ func (h Controller) Start(s bot.Service, u bot.Update) error {
 		return err
 	}
 
-	_, err = s.SendMessage(bot.SendMessageParams{
+	_, err = s.SendMessage(ctx, bot.SendMessageParams{
 		ChatID:                   u.Message.Chat.ID,
 		ReplyToMessageID:         u.Message.MessageID,
 		Text:                     "vamo que vamo",
@@ -49,62 +48,64 @@ func (h Controller) Start(s bot.Service, u bot.Update) error {
 	return err
 }
 
-func (h Controller) CreatePoll(s bot.Service, u bot.Update) error {
-	log.Print(username(u.Message.From) + ": " + u.Message.Text)
-
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	question := ""
-	if len(fields) > 1 {
-		question = strings.TrimSpace(fields[1])
+// MigrateChat moves the chat data to its new ID when a group is upgraded
+// to a supergroup.
+func (h Controller) MigrateChat(ctx context.Context, s bot.Service, u bot.Update) error {
+	err := h.Repo.MigrateChat(ctx, u.Message.Chat.ID, u.Message.MigrateToChatID)
+	if err != nil {
+		return err
 	}
 
-	if question == "" {
-		return fmt.Errorf("cade o titulo joe")
-	}
+	log.Printf("chat %d migrated to %d", u.Message.Chat.ID, u.Message.MigrateToChatID)
+	return nil
+}
 
-	_, err := s.SendPoll(bot.SendPollParams{
+func (h Controller) CreatePoll(ctx context.Context, s bot.Service, u bot.Update) error {
+	log.Print(username(u.Message.From) + ": " + u.Message.Text)
+
+	_, err := s.SendPoll(ctx, bot.SendPollParams{
 		ChatID:      u.Message.Chat.ID,
-		Question:    question,
+		Question:    bh.ArgsFrom(ctx).Text("pergunta"),
 		Options:     []string{"👍🏿", "👎🏻"},
 		IsAnonymous: util.ToPtr(false),
 	})
 	return err
 }
 
-func (h Controller) CallSubs(s bot.Service, u bot.Update) error {
+func (h Controller) CallSubs(ctx context.Context, s bot.Service, u bot.Update) error {
 	log.Print(username(u.Message.From) + ": " + u.Message.Text)
 
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	topic := ""
-	if len(fields) > 1 {
-		topic = fields[1]
+	maxLength, err := h.Settings.Int(ctx, u.Message.Chat.ID, settings.TopicMaxLength)
+	if err != nil {
+		return err
 	}
 
-	if err := validateTopic(topic); err != nil {
+	topic := bh.ArgsFrom(ctx).Topic("topico")
+	if err := validateTopic(topic, maxLength); err != nil {
 		return bh.Reply{
 			Text: err.Error(),
 		}
 	}
 
-	return h.callSubs(s, u, topic, false)
+	return h.callSubs(ctx, s, u, topic)
 }
 
-func (h Controller) ListSubs(s bot.Service, u bot.Update) error {
+func (h Controller) ListSubs(ctx context.Context, s bot.Service, u bot.Update) error {
 	log.Print(u.Message.Text)
 
-	fields := strings.SplitN(u.Message.Text, " ", 2)
-	topic := ""
-	if len(fields) > 1 {
-		topic = fields[1]
+	maxLength, err := h.Settings.Int(ctx, u.Message.Chat.ID, settings.TopicMaxLength)
+	if err != nil {
+		return err
 	}
 
-	if err := validateTopic(topic); err != nil {
+	topic := bh.ArgsFrom(ctx).Topic("topico")
+	if err := validateTopic(topic, maxLength); err != nil {
 		return bh.Reply{
 			Text: err.Error(),
 		}
 	}
 
-	users, err := h.Repo.FindUsersByTopic(u.Message.Chat.ID, topic)
+	users, err := h.Repo.FindUsersByTopic(ctx, u.Message.Chat.ID, topic)
 	if err != nil {
 		return bh.Reply{
 			Text: "falha ao listar usuários",
@@ -127,10 +128,10 @@ func (h Controller) ListSubs(s bot.Service, u bot.Update) error {
 	}
 }
 
-func (h Controller) ListChatTopics(s bot.Service, u bot.Update) error {
+func (h Controller) ListChatTopics(ctx context.Context, s bot.Service, u bot.Update) error {
 	log.Print(u.Message.Text)
 
-	topics, err := h.Repo.FindChatTopics(u.Message.Chat.ID)
+	topics, err := h.Repo.FindChatTopics(ctx, u.Message.Chat.ID)
 	if err != nil {
 		log.Print(err)
 		return bh.Reply{
@@ -154,14 +155,7 @@ func (h Controller) ListChatTopics(s bot.Service, u bot.Update) error {
 	}
 }
 
-func (h Controller) SaveAudio(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "audio")
-	if !enables {
-		return bh.Reply{
-			Text: "comando desativado. ative com /enable_audio",
-		}
-	}
-
+func (h Controller) SaveAudio(ctx context.Context, s bot.Service, u bot.Update) error {
 	if u.Message.ReplyToMessage == nil {
 		return bh.Reply{
 			Text: "responda ao audio que quer salvar",
@@ -174,7 +168,7 @@ func (h Controller) SaveAudio(s bot.Service, u bot.Update) error {
 		}
 	}
 
-	err := h.Repo.SaveVoice(repo.Voice{
+	err := h.Repo.SaveVoice(ctx, repo.Voice{
 		FileID: u.Message.ReplyToMessage.Voice.FileID,
 		UserID: u.Message.ReplyToMessage.From.ID,
 		ChatID: u.Message.Chat.ID,
@@ -188,15 +182,8 @@ func (h Controller) SaveAudio(s bot.Service, u bot.Update) error {
 	}
 }
 
-func (h Controller) SendRandomAudio(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "audio")
-	if !enables {
-		return bh.Reply{
-			Text: "comando desativado. ative com /enable_audio",
-		}
-	}
-
-	voice, err := h.Repo.FindRandomVoice(u.Message.Chat.ID)
+func (h Controller) SendRandomAudio(ctx context.Context, s bot.Service, u bot.Update) error {
+	voice, err := h.Repo.FindRandomVoice(ctx, u.Message.Chat.ID)
 	if errors.Is(err, sql.ErrNoRows) {
 		return bh.Reply{
 			Text: "nenhum áudio salvo para mandar",
@@ -205,7 +192,7 @@ func (h Controller) SendRandomAudio(s bot.Service, u bot.Update) error {
 	if err != nil {
 		return err
 	}
-	_, err = s.SendVoice(bot.SendVoiceParams{
+	_, err = s.SendVoice(ctx, bot.SendVoiceParams{
 		ChatID:           u.Message.Chat.ID,
 		Voice:            voice.FileID,
 		ReplyToMessageID: u.Message.MessageID,
@@ -213,8 +200,21 @@ func (h Controller) SendRandomAudio(s bot.Service, u bot.Update) error {
 	return err
 }
 
-func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Message) error {
-	msg, err := s.SendMessage(bot.SendMessageParams{
+func (h Controller) gptCompletion(ctx context.Context, s bot.Service, u bot.Update, msgs []openai.Message) error {
+	prompt, err := h.Settings.Value(ctx, u.Message.Chat.ID, settings.AskPrompt)
+	if err != nil {
+		return err
+	}
+	if prompt != "" {
+		msgs = append([]openai.Message{{Role: "system", Content: prompt}}, msgs...)
+	}
+
+	model, err := h.Settings.Value(ctx, u.Message.Chat.ID, settings.AskModel)
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.SendMessage(ctx, bot.SendMessageParams{
 		ChatID:           u.Message.Chat.ID,
 		ReplyToMessageID: u.Message.MessageID,
 		Text:             "Carregando...",
@@ -223,29 +223,35 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 		return err
 	}
 
-	resp, err := h.OpenAI.Completion(&openai.CompletionParams{
+	content, err := h.streamCompletion(ctx, s, msg, &openai.CompletionParams{
+		Model:    model,
 		Messages: msgs,
 	})
 
 	var rateErr openai.ErrRateLimit
 	if errors.As(err, &rateErr) {
-		_, err = s.EditMessageText(bot.EditMessageTextParams{
+		_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
 			ChatID:    u.Message.Chat.ID,
 			MessageID: msg.MessageID,
 			Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", int(rateErr)),
 		})
 		go func() {
 			deadline := time.Now().Add(time.Duration(rateErr) * time.Second)
+
+			// the countdown outlives the handler, so it can't use its context
+			ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(time.Minute))
+			defer cancel()
+
 			for time.Now().Before(deadline) {
 				time.Sleep(time.Second)
 				secs := int(time.Until(deadline).Seconds())
-				_, _ = s.EditMessageText(bot.EditMessageTextParams{
+				_, _ = s.EditMessageText(ctx, bot.EditMessageTextParams{
 					ChatID:    u.Message.Chat.ID,
 					MessageID: msg.MessageID,
 					Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", secs),
 				})
 			}
-			_, _ = s.EditMessageText(bot.EditMessageTextParams{
+			_, _ = s.EditMessageText(ctx, bot.EditMessageTextParams{
 				ChatID:    u.Message.Chat.ID,
 				MessageID: msg.MessageID,
 				Text:      "manda de novo ae",
@@ -254,20 +260,14 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 		return err
 	}
 	if err != nil {
-		_, _ = s.EditMessageText(bot.EditMessageTextParams{
-			ChatID:    u.Message.Chat.ID,
-			MessageID: msg.MessageID,
-			Text:      "vish deu ruim",
-		})
-		return err
-	}
-
-	msg, err = s.EditMessageText(bot.EditMessageTextParams{
-		ChatID:    u.Message.Chat.ID,
-		MessageID: msg.MessageID,
-		Text:      resp.Choices[0].Message.Content,
-	})
-	if err != nil {
+		// the content received is left in the message
+		if strings.TrimSpace(content) == "" {
+			_, _ = s.EditMessageText(ctx, bot.EditMessageTextParams{
+				ChatID:    u.Message.Chat.ID,
+				MessageID: msg.MessageID,
+				Text:      "vish deu ruim",
+			})
+		}
 		return err
 	}
 
@@ -277,7 +277,7 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 	if u.Message.ReplyToMessage != nil {
 		replyTo = u.Message.ReplyToMessage.MessageID
 	}
-	err = h.Repo.SaveMessage(context.TODO(), repo.Message{
+	err = h.Repo.SaveMessage(ctx, repo.Message{
 		ID:               u.Message.MessageID,
 		ChatID:           u.Message.Chat.ID,
 		Text:             txt,
@@ -289,10 +289,10 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 		return err
 	}
 
-	err = h.Repo.SaveMessage(context.TODO(), repo.Message{
+	err = h.Repo.SaveMessage(ctx, repo.Message{
 		ID:               msg.MessageID,
 		ChatID:           msg.Chat.ID,
-		Text:             msg.Text,
+		Text:             content,
 		Date:             time.Unix(msg.Date, 0),
 		UserID:           h.Config.GPTUserID,
 		ReplyToMessageID: u.Message.MessageID,
@@ -300,18 +300,8 @@ func (h Controller) gptCompletion(s bot.Service, u bot.Update, msgs []openai.Mes
 	return err
 }
 
-func (h Controller) GPTCompletion(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "ask")
-	if !enables {
-		return nil
-	}
-
-	chunks := strings.SplitN(u.Message.Text, " ", 2)
-	if len(chunks) != 2 {
-		return bh.Reply{
-			Text: "faltou a pergunta",
-		}
-	}
+func (h Controller) GPTCompletion(ctx context.Context, s bot.Service, u bot.Update) error {
+	question := bh.ArgsFrom(ctx).Text("pergunta")
 
 	name := username(u.Message.From)
 
@@ -320,35 +310,36 @@ func (h Controller) GPTCompletion(s bot.Service, u bot.Update) error {
 			Content: fmt.Sprintf(
 				"%s: %s",
 				name,
-				chunks[1],
+				question,
 			),
 		},
 	}
 
-	return h.gptCompletion(s, u, msgs)
+	return h.gptCompletion(ctx, s, u, msgs)
 }
 
-func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "cask")
-	if !enables {
-		return bh.Reply{
-			Text: "comando desativado. ative com /enable_cask\nATENÇÃO! Ao ativar essa opção, as mensagens de texto serão salvas no banco de dados do s",
-		}
-	}
-
-	chunks := strings.SplitN(u.Message.Text, " ", 2)
-	if len(chunks) != 2 {
-		return bh.Reply{
-			Text: "faltou a pergunta",
-		}
-	}
+func (h Controller) GPTChatCompletion(ctx context.Context, s bot.Service, u bot.Update) error {
+	question := bh.ArgsFrom(ctx).Text("pergunta")
 
 	date := time.Unix(u.Message.Date, 0)
 	if u.Message.ReplyToMessage != nil {
 		date = time.Unix(u.Message.ReplyToMessage.Date, 0)
 	}
 
-	msgs, err := h.Repo.FindMessagesBeforeDate(context.TODO(), u.Message.Chat.ID, date, 100)
+	count, err := h.Settings.Int(ctx, u.Message.Chat.ID, settings.CAskMessages)
+	if err != nil {
+		return err
+	}
+	maxChars, err := h.Settings.Int(ctx, u.Message.Chat.ID, settings.CAskChars)
+	if err != nil {
+		return err
+	}
+	model, err := h.Settings.Value(ctx, u.Message.Chat.ID, settings.AskModel)
+	if err != nil {
+		return err
+	}
+
+	msgs, err := h.Repo.FindMessagesBeforeDate(ctx, u.Message.Chat.ID, date, count)
 	if err != nil {
 		return err
 	}
@@ -359,7 +350,7 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 		title = u.Message.Chat.FirstName
 	}
 
-	prepMsgs := prepareMessagesForGPT(msgs)
+	prepMsgs := prepareMessagesForGPT(msgs, maxChars)
 	if len(prepMsgs) == 0 {
 		return bh.Reply{
 			Text: "ainda não há mensagens salvas para usar o /cask",
@@ -380,12 +371,12 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 				name,
 				title,
 				name,
-				chunks[1],
+				question,
 			),
 		},
 	}
 
-	msg, err := s.SendMessage(bot.SendMessageParams{
+	msg, err := s.SendMessage(ctx, bot.SendMessageParams{
 		ChatID:           u.Message.Chat.ID,
 		ReplyToMessageID: u.Message.MessageID,
 		Text:             fmt.Sprintf("Carregando... (usando últimas %d mensagens de contexto)", len(prepMsgs)),
@@ -394,23 +385,29 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 		return err
 	}
 
-	resp, err := h.OpenAI.Completion(&openai.CompletionParams{
+	_, err = h.streamCompletion(ctx, s, msg, &openai.CompletionParams{
+		Model:       model,
 		Messages:    prompts,
 		Temperature: 0.5,
 	})
 	var rateErr openai.ErrRateLimit
 	if errors.As(err, &rateErr) {
-		_, err = s.EditMessageText(bot.EditMessageTextParams{
+		_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
 			ChatID:    u.Message.Chat.ID,
 			MessageID: msg.MessageID,
 			Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", int(rateErr)),
 		})
 		go func() {
 			deadline := time.Now().Add(time.Duration(rateErr) * time.Second)
+
+			// the countdown outlives the handler, so it can't use its context
+			ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(time.Minute))
+			defer cancel()
+
 			for time.Now().Before(deadline) {
 				time.Sleep(time.Second)
 				secs := int(time.Until(deadline).Seconds())
-				_, _ = s.EditMessageText(bot.EditMessageTextParams{
+				_, _ = s.EditMessageText(ctx, bot.EditMessageTextParams{
 					ChatID:    u.Message.Chat.ID,
 					MessageID: msg.MessageID,
 					Text:      fmt.Sprintf("ignorated kk rate limit (%ds)", secs),
@@ -419,53 +416,18 @@ func (h Controller) GPTChatCompletion(s bot.Service, u bot.Update) error {
 		}()
 		return err
 	}
-	if err != nil {
-		return err
-	}
-
-	_, err = s.EditMessageText(bot.EditMessageTextParams{
-		ChatID:    u.Message.Chat.ID,
-		MessageID: msg.MessageID,
-		Text:      resp.Choices[0].Message.Content,
-	})
 	return err
 }
 
-func (h Controller) Enable(opt string) bh.HandlerFunc {
-	return func(s bot.Service, u bot.Update) error {
-		err := h.Repo.ChatEnable(context.TODO(), u.Message.Chat.ID, opt)
-		if err != nil {
-			return err
-		}
-
-		return bh.Reply{
-			Text: "ativado",
-		}
-	}
-}
-
-func (h Controller) Disable(opt string) bh.HandlerFunc {
-	return func(s bot.Service, u bot.Update) error {
-		err := h.Repo.ChatDisable(context.TODO(), u.Message.Chat.ID, opt)
-		if err != nil {
-			return err
-		}
-
-		return bh.Reply{
-			Text: "desativado",
-		}
-	}
-}
-
-func (h Controller) Backup(s bot.Service, u bot.Update) error {
-	return s.SendDocument(bot.SendDocumentParams{
+func (h Controller) Backup(ctx context.Context, s bot.Service, u bot.Update) error {
+	return s.SendDocument(ctx, bot.SendDocumentParams{
 		ChatID:   h.Config.GodID,
 		FileName: "./euperturbot.db",
 	})
 }
 
 // WIP
-func (h Controller) Xonotic(s bot.Service, u bot.Update) error {
+func (h Controller) Xonotic(ctx context.Context, s bot.Service, u bot.Update) error {
 	type XonoticResponse []struct {
 		Status        string
 		Name          string
@@ -513,7 +475,7 @@ func (h Controller) Xonotic(s bot.Service, u bot.Update) error {
 		players,
 	)
 
-	_, err = s.SendMessage(bot.SendMessageParams{
+	_, err = s.SendMessage(ctx, bot.SendMessageParams{
 		ChatID:           u.Message.Chat.ID,
 		ReplyToMessageID: u.Message.MessageID,
 		Text:             txt,
@@ -522,21 +484,27 @@ func (h Controller) Xonotic(s bot.Service, u bot.Update) error {
 	return err
 }
 
-func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
-	var err error
-
-	poll, err := h.Repo.FindPollByMessage(u.CallbackQuery.Message.MessageID)
+// PollVote handles the buttons of the polls sent by /bora. The arg is the
+// vote, repo.VoteUp or repo.VoteDown.
+func (h Controller) PollVote(ctx context.Context, s bot.Service, u bot.Update, args bh.CallbackArgs) error {
+	voteNum, err := args.Int(0)
 	if err != nil {
 		return err
 	}
+	if voteNum != repo.VoteUp && voteNum != repo.VoteDown {
+		return fmt.Errorf("invalid vote: %d", voteNum)
+	}
 
-	voteNum, err := strconv.Atoi(u.CallbackQuery.Data)
+	poll, err := h.Repo.FindPollByMessage(ctx, u.CallbackQuery.Message.MessageID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return bh.Toast{Text: "enquete não encontrada"}
+	}
 	if err != nil {
 		return err
 	}
 
 	// TODO: improve this logic
-	vote, err := h.Repo.FindPollVote(poll.ID, u.CallbackQuery.From.ID)
+	vote, err := h.Repo.FindPollVote(ctx, poll.ID, u.CallbackQuery.From.ID)
 	if errors.Is(err, sql.ErrNoRows) {
 		vote = nil
 	} else if err != nil {
@@ -544,9 +512,9 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 	}
 
 	if vote != nil && vote.Vote == voteNum {
-		err = h.Repo.DeletePollVote(vote.PollID, vote.UserID)
+		err = h.Repo.DeletePollVote(ctx, vote.PollID, vote.UserID)
 	} else {
-		err = h.Repo.SavePollVote(repo.PollVote{
+		err = h.Repo.SavePollVote(ctx, repo.PollVote{
 			PollID: poll.ID,
 			UserID: u.CallbackQuery.From.ID,
 			Vote:   voteNum,
@@ -557,7 +525,7 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 	}
 
 	if voteNum == repo.VoteUp {
-		err = h.Repo.SaveUserTopic(repo.UserTopic{
+		err = h.Repo.SaveUserTopic(ctx, repo.UserTopic{
 			ChatID: poll.ChatID,
 			UserID: u.CallbackQuery.From.ID,
 			Topic:  poll.Topic,
@@ -567,7 +535,7 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 		}
 	}
 
-	users, err := h.Repo.FindUsersByTopic(poll.ChatID, poll.Topic)
+	users, err := h.Repo.FindUsersByTopic(ctx, poll.ChatID, poll.Topic)
 	if err != nil {
 		return err
 	}
@@ -593,7 +561,7 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 	for _, user := range users {
 		mention := fmt.Sprintf("[%s](tg://user?id=%d)\n", user.Name(), user.ID)
 
-		vote, err := h.Repo.FindPollVote(poll.ID, user.ID)
+		vote, err := h.Repo.FindPollVote(ctx, poll.ID, user.ID)
 		if errors.Is(err, sql.ErrNoRows) {
 			remainings += mention
 			remainingCount++
@@ -624,158 +592,172 @@ func (h Controller) CallbackQuery(s bot.Service, u bot.Update) error {
 	up := "👍 " + fmt.Sprint(positiveCount)
 	down := "👎 " + fmt.Sprint(negativeCount)
 
-	_, err = s.EditMessageText(bot.EditMessageTextParams{
-		ChatID:    poll.ChatID,
-		MessageID: poll.ResultMessageID,
-		Text:      txt,
-		ParseMode: "MarkdownV2",
-		ReplyMarkup: &bot.InlineKeyboardMarkup{
-			InlineKeyboard: [][]bot.InlineKeyboardButton{{
-				bot.InlineKeyboardButton{
-					Text:         up,
-					CallbackData: "0",
-				},
-				bot.InlineKeyboardButton{
-					Text:         down,
-					CallbackData: "1",
-				},
-			}},
-		},
+	_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:      poll.ChatID,
+		MessageID:   poll.ResultMessageID,
+		Text:        txt,
+		ParseMode:   "MarkdownV2",
+		ReplyMarkup: pollKeyboard(up, down),
 	})
+	if errors.Is(err, bot.ErrMessageNotModified) {
+		// vote didn't change the tally
+		return nil
+	}
 	return err
 }
 
-func (h Controller) Text(s bot.Service, u bot.Update) error {
-	// sed commands
-	re := regexp.MustCompile(`^(s|y)\/.*\/`)
-	if re.MatchString(u.Message.Text) && u.Message.ReplyToMessage != nil {
-		enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "sed")
-		if !enables {
-			return nil
-		}
+// sedMaxOutput is the max length of a message
+const sedMaxOutput = 4096
 
-		cmd := exec.CommandContext(context.TODO(), "sed", "--sandbox", "-E", u.Message.Text)
-		buf := &bytes.Buffer{}
-		cmd.Stdout = buf
-		cmd.Stdin = strings.NewReader(u.Message.ReplyToMessage.Text)
+// Sed replies the message replied by u with the sed script in u run on
+// it. Other messages pass, and so do all when sed is disabled.
+func (h Controller) Sed(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+	if u.Message.ReplyToMessage == nil {
+		return false, nil
+	}
+	script, err := sed.Parse(u.Message.Text)
+	if err != nil {
+		return false, nil
+	}
 
-		err := cmd.Run()
-		if err != nil {
-			return err
-		}
+	enables, _ := h.Settings.Enabled(ctx, u.Message.Chat.ID, settings.Sed)
+	if !enables {
+		return false, nil
+	}
 
-		_, err = s.SendMessage(bot.SendMessageParams{
-			ChatID:           u.Message.Chat.ID,
-			ReplyToMessageID: u.Message.ReplyToMessage.MessageID,
-			Text:             buf.String(),
-		})
-		return err
+	text, err := script.Run(u.Message.ReplyToMessage.Text, sedMaxOutput)
+	if errors.Is(err, sed.ErrOutputTooLong) {
+		return true, bh.Reply{Text: "ficou grande demais"}
+	}
+	if err != nil {
+		return true, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return true, nil
 	}
 
-	// if reply to chatGPT, treat as /ask
-	if u.Message.ReplyToMessage != nil && u.Message.ReplyToMessage.From.ID == h.BotInfo.ID {
-		enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "ask")
-		if !enables {
-			return nil
-		}
+	_, err = s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:           u.Message.Chat.ID,
+		ReplyToMessageID: u.Message.ReplyToMessage.MessageID,
+		Text:             text,
+	})
+	return true, err
+}
 
-		msg, err := h.Repo.FindMessage(context.TODO(), u.Message.Chat.ID, u.Message.ReplyToMessage.MessageID)
-		if errors.Is(err, repo.ErrNotFound) {
-			return nil
-		}
-		if err != nil {
-			return nil
-		}
+// ContinueThread answers the replies to the answers of /ask like /ask,
+// with the thread of replies before. Other messages pass.
+func (h Controller) ContinueThread(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+	if u.Message.ReplyToMessage == nil || u.Message.ReplyToMessage.From.ID != h.BotInfo.ID {
+		return false, nil
+	}
 
-		if msg.UserID != h.Config.GPTUserID {
-			return nil
-		}
+	enables, _ := h.Settings.Enabled(ctx, u.Message.Chat.ID, settings.Ask)
+	if !enables {
+		return false, nil
+	}
 
-		msgs, err := h.Repo.FindMessageThread(context.TODO(), u.Message.Chat.ID, u.Message.ReplyToMessage.MessageID)
-		if err != nil {
-			return err
-		}
+	msg, err := h.Repo.FindMessage(ctx, u.Message.Chat.ID, u.Message.ReplyToMessage.MessageID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
 
-		oaiMsgs := []openai.Message{}
-		for _, msg := range msgs {
-			role := "user"
-			if msg.UserID == h.BotInfo.ID {
-				role = "assistant"
-			}
+	if msg.UserID != h.Config.GPTUserID {
+		return false, nil
+	}
 
-			oaiMsgs = append(oaiMsgs, openai.Message{
-				Role:    role,
-				Content: msg.Text,
-			})
+	msgs, err := h.Repo.FindMessageThread(ctx, u.Message.Chat.ID, u.Message.ReplyToMessage.MessageID)
+	if err != nil {
+		return true, err
+	}
+
+	oaiMsgs := []openai.Message{}
+	for _, msg := range msgs {
+		role := "user"
+		if msg.UserID == h.BotInfo.ID {
+			role = "assistant"
 		}
 
-		name := username(u.Message.From)
 		oaiMsgs = append(oaiMsgs, openai.Message{
-			Content: fmt.Sprintf(
-				"Meu nome é %s. Responda a seguinte mensagem se referindo a mim como @%s.\n%s",
-				name,
-				name,
-				u.Message.Text,
-			),
+			Role:    role,
+			Content: msg.Text,
 		})
-
-		return h.gptCompletion(s, u, oaiMsgs)
 	}
 
-	// call subscribers
-	txt := strings.TrimSpace(u.Message.Text)
-	if strings.HasPrefix(txt, "#") {
-		if err := validateTopic(txt); err != nil {
-			return nil
-		}
-		return h.callSubs(s, u, txt, true)
+	name := username(u.Message.From)
+	oaiMsgs = append(oaiMsgs, openai.Message{
+		Content: fmt.Sprintf(
+			"Meu nome é %s. Responda a seguinte mensagem se referindo a mim como @%s.\n%s",
+			name,
+			name,
+			u.Message.Text,
+		),
+	})
+
+	return true, h.gptCompletion(ctx, s, u, oaiMsgs)
+}
+
+// SaveMessage saves the message for /cask, when enabled in the chat.
+func (h Controller) SaveMessage(ctx context.Context, s bot.Service, u bot.Update) error {
+	enables, _ := h.Settings.Enabled(ctx, u.Message.Chat.ID, settings.CAsk)
+	if !enables {
+		return nil
 	}
+	return h.Repo.SaveMessage(ctx, historyMessage(u.Message))
+}
 
-	// save message
-	enables, _ := h.Repo.ChatEnables(context.TODO(), u.Message.Chat.ID, "cask")
+// SaveEdit saves the new text of an edited message for /cask, keeping the
+// ones it had, when enabled in the chat.
+func (h Controller) SaveEdit(ctx context.Context, s bot.Service, u bot.Update) error {
+	msg := u.EditedMessage
+	enables, _ := h.Settings.Enabled(ctx, msg.Chat.ID, settings.CAsk)
 	if !enables {
 		return nil
 	}
+	return h.Repo.SaveMessageEdit(ctx, historyMessage(msg), time.Unix(msg.EditDate, 0))
+}
 
-	name := username(u.Message.From)
-	id := u.Message.From.ID
+// historyMessage is msg as saved for /cask
+func historyMessage(msg *bot.Message) repo.Message {
+	name := username(msg.From)
+	id := msg.From.ID
 
-	if u.Message.FowardFrom != nil {
-		name = username(u.Message.FowardFrom) + "(forward)"
-		id = u.Message.FowardFrom.ID
+	if msg.FowardFrom != nil {
+		name = username(msg.FowardFrom) + "(forward)"
+		id = msg.FowardFrom.ID
 	}
 
-	if u.Message.ForwardSenderName != "" {
+	if msg.ForwardSenderName != "" {
 		id = 0
-		name = sanitizeUsername(u.Message.ForwardSenderName)
+		name = sanitizeUsername(msg.ForwardSenderName)
 	}
 
 	replyID := 0
-	if u.Message.ReplyToMessage != nil {
-		replyID = u.Message.ReplyToMessage.MessageID
+	if msg.ReplyToMessage != nil {
+		replyID = msg.ReplyToMessage.MessageID
 	}
 
-	err := h.Repo.SaveMessage(context.TODO(), repo.Message{
-		ID:               u.Message.MessageID,
+	return repo.Message{
+		ID:               msg.MessageID,
 		ReplyToMessageID: replyID,
-		ChatID:           u.Message.Chat.ID,
-		Text:             txt,
-		Date:             time.Unix(u.Message.Date, 0),
+		ChatID:           msg.Chat.ID,
+		Text:             strings.TrimSpace(msg.Text),
+		Date:             time.Unix(msg.Date, 0),
 		UserID:           id,
 		UserName:         name,
-	})
-
-	return err
+	}
 }
 
 // TODO:
-func (h Controller) InlineQuery(s bot.Service, u bot.Update) error {
+func (h Controller) InlineQuery(ctx context.Context, s bot.Service, u bot.Update) error {
 	var err error
 
 	// TODO: debounce by u.InlineQuery.ID
 	util.Debounce(5*time.Second, func() {
 		var resp *openai.CompletionResponse
-		resp, err = h.OpenAI.Completion(&openai.CompletionParams{
+		resp, err = h.OpenAI.Completion(ctx, &openai.CompletionParams{
 			WaitRateLimit: true,
 			Messages: []openai.Message{
 				{
@@ -785,7 +767,7 @@ func (h Controller) InlineQuery(s bot.Service, u bot.Update) error {
 		})
 
 		if err != nil {
-			_ = s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
+			_ = s.AnswerInlineQuery(ctx, bot.AnswerInlineQueryParams{
 				InlineQueryID: u.InlineQuery.ID,
 				Results: []bot.InlineQueryResult{
 					{
@@ -806,7 +788,7 @@ func (h Controller) InlineQuery(s bot.Service, u bot.Update) error {
 			title = title[:97] + "..."
 		}
 
-		err = s.AnswerInlineQuery(bot.AnswerInlineQueryParams{
+		err = s.AnswerInlineQuery(ctx, bot.AnswerInlineQueryParams{
 			InlineQueryID: u.InlineQuery.ID,
 			Results: []bot.InlineQueryResult{
 				{
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// DialogStore keeps the dialogs of bothandler.Dialogs in the repo.
+type DialogStore struct {
+	Repo repo.Repo
+}
+
+var _ bh.DialogStore = DialogStore{}
+
+func (d DialogStore) FindDialog(ctx context.Context, chatID int64, userID int64) (*bh.DialogState, error) {
+	dlg, err := d.Repo.FindDialog(ctx, chatID, userID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &bh.DialogState{
+		ChatID:    dlg.ChatID,
+		UserID:    dlg.UserID,
+		MessageID: dlg.MessageID,
+		PromptID:  dlg.PromptID,
+		Dialog:    dlg.Name,
+		Step:      dlg.Step,
+		Data:      dlg.Data,
+		ExpiresAt: dlg.ExpiresAt,
+	}, nil
+}
+
+func (d DialogStore) SaveDialog(ctx context.Context, state bh.DialogState) error {
+	return d.Repo.SaveDialog(ctx, repo.Dialog{
+		ChatID:    state.ChatID,
+		UserID:    state.UserID,
+		MessageID: state.MessageID,
+		PromptID:  state.PromptID,
+		Name:      state.Dialog,
+		Step:      state.Step,
+		Data:      state.Data,
+		ExpiresAt: state.ExpiresAt,
+	})
+}
+
+func (d DialogStore) DeleteDialog(ctx context.Context, chatID int64, userID int64) error {
+	return d.Repo.DeleteDialog(ctx, chatID, userID)
+}
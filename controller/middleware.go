@@ -11,37 +11,45 @@ import (
 
 func (h Controller) EnsureStarted() bh.Middleware {
 	return func(next bh.HandlerFunc) bh.HandlerFunc {
-		return func(s bot.Service, u bot.Update) error {
-			if u.Message.Text == "/start" {
-				return next(s, u)
+		return func(ctx context.Context, s bot.Service, u bot.Update) error {
+			if bh.Command("start")(s, u) {
+				return next(ctx, s, u)
 			}
 
-			_, err := h.Repo.FindChat(context.TODO(), u.Message.Chat.ID)
+			msg := u.Message
+			if msg == nil {
+				msg = u.EditedMessage
+			}
+			_, err := h.Repo.FindChat(ctx, msg.Chat.ID)
 			if errors.Is(err, repo.ErrNotFound) {
 				// chat not /start'ed. ignore
 				return nil
 			}
 
-			return next(s, u)
+			return next(ctx, s, u)
 		}
 	}
 }
 
 func (h Controller) IgnoreForwardedCommand() bh.Middleware {
 	return func(next bh.HandlerFunc) bh.HandlerFunc {
-		return func(s bot.Service, u bot.Update) error {
+		return func(ctx context.Context, s bot.Service, u bot.Update) error {
 			if u.Message.ForwardSenderName != "" || u.Message.FowardFrom != nil {
 				return nil
 			}
-			return next(s, u)
+			return next(ctx, s, u)
 		}
 	}
 }
 
 func (h Controller) RequireGod(next bh.HandlerFunc) bh.HandlerFunc {
-	return func(s bot.Service, u bot.Update) error {
-		if u.Message.Chat.Type == "private" && u.Message.From.ID == h.Config.GodID {
-			return next(s, u)
+	return func(ctx context.Context, s bot.Service, u bot.Update) error {
+		isGod, err := h.Allowed(ctx, s, u, bh.God)
+		if err != nil {
+			return err
+		}
+		if isGod {
+			return next(ctx, s, u)
 		}
 
 		return bh.Reply{
@@ -51,8 +59,8 @@ func (h Controller) RequireGod(next bh.HandlerFunc) bh.HandlerFunc {
 }
 
 func (h Controller) RequireAdmin(next bh.HandlerFunc) bh.HandlerFunc {
-	return func(s bot.Service, u bot.Update) error {
-		isAdmin, err := h.isAdmin(s, u)
+	return func(ctx context.Context, s bot.Service, u bot.Update) error {
+		isAdmin, err := h.Allowed(ctx, s, u, bh.Admin)
 		if err != nil {
 			return err
 		}
@@ -62,6 +70,6 @@ func (h Controller) RequireAdmin(next bh.HandlerFunc) bh.HandlerFunc {
 			}
 		}
 
-		return next(s, u)
+		return next(ctx, s, u)
 	}
 }
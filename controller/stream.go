@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/openai"
+)
+
+const (
+	// streamInterval is the least time between the edits of an answer
+	// being streamed in a private chat, where Telegram allows about one
+	// message per second
+	streamInterval = 1500 * time.Millisecond
+	// groupStreamInterval is the same for groups, where the bot scheduler
+	// allows one message every 3s after a burst of 20. Editing faster, a
+	// long answer would use up the burst of the whole group.
+	groupStreamInterval = 3 * time.Second
+	// maxMessageLength is how long a message of Telegram can be
+	maxMessageLength = 4096
+	// streamCursor ends the answer while it's being written
+	streamCursor = " ▍"
+)
+
+// streamCompletion writes the completion of params into msg, the
+// placeholder of the answer, editing it as the content arrives. When the
+// stream fails midway the content received is kept in msg with a note,
+// and returned with the error.
+func (h Controller) streamCompletion(ctx context.Context, s bot.Service, msg *bot.Message, params *openai.CompletionParams) (string, error) {
+	interval := streamInterval
+	if msg.Chat.ID < 0 {
+		interval = groupStreamInterval
+	}
+	// the placeholder was just sent
+	e := startStreamEditor(ctx, s, msg.Chat.ID, msg.MessageID, interval, time.Now())
+
+	resp, err := h.OpenAI.CompletionStream(ctx, params, e.write)
+	e.stop()
+
+	content := ""
+	if resp != nil && len(resp.Choices) > 0 {
+		content = resp.Choices[0].Message.Content
+	}
+	if err != nil {
+		if strings.TrimSpace(content) != "" {
+			_ = e.edit(ctx, content+"\n\n(resposta interrompida)")
+		}
+		return content, err
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return content, e.edit(ctx, "(sem resposta)")
+	}
+	return content, e.edit(ctx, content)
+}
+
+// streamEditor shows a text that is still arriving in a message. The edits
+// are made by another goroutine, at most every interval and with only the
+// latest text, so writing never waits for Telegram.
+type streamEditor struct {
+	s        bot.Service
+	chatID   int64
+	msgID    int
+	interval time.Duration
+
+	mut  sync.Mutex
+	text strings.Builder
+
+	// shown and last are only used by the goroutine until stop returns
+	shown string
+	last  time.Time
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// startStreamEditor starts editing the message msgID, the first edit
+// waiting for interval after last.
+func startStreamEditor(ctx context.Context, s bot.Service, chatID int64, msgID int, interval time.Duration, last time.Time) *streamEditor {
+	e := &streamEditor{
+		s:        s,
+		chatID:   chatID,
+		msgID:    msgID,
+		interval: interval,
+		last:     last,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go e.run(ctx)
+	return e
+}
+
+// write adds delta to the text, to be shown by the next edit.
+func (e *streamEditor) write(delta string) {
+	e.mut.Lock()
+	e.text.WriteString(delta)
+	e.mut.Unlock()
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+		// an edit is already due
+	}
+}
+
+// stop ends the edits, waiting for the one in progress.
+func (e *streamEditor) stop() {
+	close(e.done)
+	<-e.stopped
+}
+
+// run shows the text written so far, waiting interval between the edits.
+// Failed edits are logged, the next ones may work.
+func (e *streamEditor) run(ctx context.Context) {
+	defer close(e.stopped)
+	for {
+		select {
+		case <-e.wake:
+		case <-e.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		if wait := e.interval - time.Since(e.last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-e.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		e.mut.Lock()
+		text := e.text.String()
+		e.mut.Unlock()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		err := e.edit(ctx, text+streamCursor)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// edit shows text in the message, cut to fit, unless it's already shown.
+func (e *streamEditor) edit(ctx context.Context, text string) error {
+	if r := []rune(text); len(r) > maxMessageLength {
+		text = string(r[:maxMessageLength])
+	}
+	if text == e.shown {
+		return nil
+	}
+
+	_, err := e.s.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:    e.chatID,
+		MessageID: e.msgID,
+		Text:      text,
+	})
+	e.last = time.Now()
+	if errors.Is(err, bot.ErrMessageNotModified) {
+		err = nil
+	}
+	if err == nil {
+		e.shown = text
+	}
+	return err
+}
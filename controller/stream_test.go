@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/bot/bottest"
+	"github.com/igoracmelo/euperturbot/openai"
+)
+
+func editTexts(srv *bottest.Server) []string {
+	var texts []string
+	for _, edit := range srv.Edits() {
+		texts = append(texts, edit.Text)
+	}
+	return texts
+}
+
+func TestStreamEditor(t *testing.T) {
+	ctx := context.Background()
+	srv := bottest.NewServer()
+	defer srv.Close()
+
+	// too soon
+	e := startStreamEditor(ctx, srv.Service(), -1, 1, time.Hour, time.Now())
+	e.write("bom")
+	e.stop()
+	if edits := editTexts(srv); len(edits) != 0 {
+		t.Fatalf("want no edits, got: %q", edits)
+	}
+
+	// the writes while waiting are shown in one edit
+	e = startStreamEditor(ctx, srv.Service(), -1, 1, 50*time.Millisecond, time.Now())
+	e.write("bom")
+	e.write(" dia")
+	ok := srv.WaitFor(func() bool {
+		return len(srv.Edits()) == 1
+	}, time.Second)
+	e.write("!")
+	e.stop()
+	if !ok {
+		t.Fatal("want the text shown while written")
+	}
+
+	err := e.edit(ctx, "bom dia!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// already shown
+	err = e.edit(ctx, "bom dia!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edits := editTexts(srv)
+	if len(edits) != 2 || edits[0] != "bom dia"+streamCursor || edits[1] != "bom dia!" {
+		t.Fatalf("want the text while written and at the end, got: %q", edits)
+	}
+}
+
+// brokenStream sends some of the content and fails.
+type brokenStream struct {
+	openai.ServiceDouble
+}
+
+func (brokenStream) CompletionStream(ctx context.Context, params *openai.CompletionParams, onDelta func(string)) (*openai.CompletionResponse, error) {
+	onDelta("era uma vez")
+	return &openai.CompletionResponse{
+		Choices: []openai.Choice{{Message: openai.Message{Role: "assistant", Content: "era uma vez"}}},
+	}, openai.ErrStreamEnded
+}
+
+func TestStreamCompletionInterrupted(t *testing.T) {
+	srv := bottest.NewServer()
+	defer srv.Close()
+
+	h := Controller{OpenAI: brokenStream{}}
+	msg := &bot.Message{MessageID: 1, Chat: &bot.Chat{ID: -1}}
+	content, err := h.streamCompletion(context.Background(), srv.Service(), msg, &openai.CompletionParams{})
+	if !errors.Is(err, openai.ErrStreamEnded) {
+		t.Fatalf("want: %v, got: %v", openai.ErrStreamEnded, err)
+	}
+	if content != "era uma vez" {
+		t.Fatalf("want the partial content, got: %q", content)
+	}
+
+	edits := editTexts(srv)
+	if len(edits) != 1 || edits[0] != "era uma vez\n\n(resposta interrompida)" {
+		t.Fatalf("want the partial content kept, got: %q", edits)
+	}
+}
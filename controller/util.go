@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -12,21 +13,15 @@ import (
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
-func (h Controller) callSubs(s bot.Service, u bot.Update, topic string, quiet bool) error {
-	users, err := h.Repo.FindUsersByTopic(u.Message.Chat.ID, topic)
+func (h Controller) callSubs(ctx context.Context, s bot.Service, u bot.Update, topic string) error {
+	users, err := h.Repo.FindUsersByTopic(ctx, u.Message.Chat.ID, topic)
 	if err != nil {
-		if quiet {
-			return err
-		}
 		return bh.Reply{
 			Text: "falha ao listar usuários",
 		}
 	}
 
 	if len(users) == 0 {
-		if quiet {
-			return nil
-		}
 		return bh.Reply{
 			Text: "não tem ninguém inscrito nesse tópico",
 		}
@@ -46,29 +41,18 @@ func (h Controller) callSubs(s bot.Service, u bot.Update, topic string, quiet bo
 	up := "👍 0"
 	down := "👎 0"
 
-	msg, err := s.SendMessage(bot.SendMessageParams{
+	msg, err := s.SendMessage(ctx, bot.SendMessageParams{
 		ChatID:           u.Message.Chat.ID,
 		Text:             txt,
 		ParseMode:        "MarkdownV2",
 		ReplyToMessageID: u.Message.MessageID,
-		ReplyMarkup: &bot.InlineKeyboardMarkup{
-			InlineKeyboard: [][]bot.InlineKeyboardButton{{
-				bot.InlineKeyboardButton{
-					Text:         up,
-					CallbackData: "0",
-				},
-				bot.InlineKeyboardButton{
-					Text:         down,
-					CallbackData: "1",
-				},
-			}},
-		},
+		ReplyMarkup:      pollKeyboard(up, down),
 	})
 	if err != nil {
 		return err
 	}
 
-	err = h.Repo.SavePoll(repo.Poll{
+	err = h.Repo.SavePoll(ctx, repo.Poll{
 		ID:              strconv.Itoa(msg.MessageID),
 		ChatID:          u.Message.Chat.ID,
 		Topic:           topic,
@@ -78,7 +62,24 @@ func (h Controller) callSubs(s bot.Service, u bot.Update, topic string, quiet bo
 	return err
 }
 
-func prepareMessagesForGPT(msgs []repo.Message) []string {
+func pollKeyboard(up string, down string) *bot.InlineKeyboardMarkup {
+	return &bot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]bot.InlineKeyboardButton{{
+			bot.InlineKeyboardButton{
+				Text:         up,
+				CallbackData: bh.MustEncodeCallback("poll:vote", repo.VoteUp),
+			},
+			bot.InlineKeyboardButton{
+				Text:         down,
+				CallbackData: bh.MustEncodeCallback("poll:vote", repo.VoteDown),
+			},
+		}},
+	}
+}
+
+// prepareMessagesForGPT returns the last msgs that fit in maxChars, oldest
+// first.
+func prepareMessagesForGPT(msgs []repo.Message, maxChars int) []string {
 	msgTxts := []string{}
 	totalLen := 0
 
@@ -92,7 +93,7 @@ func prepareMessagesForGPT(msgs []repo.Message) []string {
 		txt = reURL.ReplaceAllString(txt, "")
 		txt = reMultiSpace.ReplaceAllString(txt, " ")
 		totalLen += len(txt)
-		if totalLen > 2000 {
+		if totalLen > maxChars {
 			break
 		}
 		msgTxts = append(msgTxts, txt)
@@ -125,12 +126,12 @@ func username(user *bot.User) string {
 	return sanitizeUsername(user.FirstName)
 }
 
-func validateTopic(topic string) error {
+func validateTopic(topic string, maxLength int) error {
 	topic = strings.TrimSpace(topic)
 	if len(topic) == 0 {
 		return fmt.Errorf("tópico vazio")
 	}
-	if len(topic) > 30 {
+	if len(topic) > maxLength {
 		return fmt.Errorf("tópico muito grande")
 	}
 	if strings.Contains(topic, "\n") {
@@ -142,18 +143,37 @@ func validateTopic(topic string) error {
 	return nil
 }
 
-func (h Controller) isAdmin(s bot.Service, u bot.Update) (bool, error) {
-	if u.Message.Chat.Type == "private" {
+// Allowed tells if the sender of the message or callback query u has the
+// permission p in its chat.
+func (h Controller) Allowed(ctx context.Context, s bot.Service, u bot.Update, p bh.Permission) (bool, error) {
+	chat, from := sender(u)
+	if chat == nil || from == nil {
+		return false, nil
+	}
+
+	switch p {
+	case bh.Anyone:
+		return true, nil
+	case bh.Admin:
+		return h.isAdmin(ctx, s, chat, from)
+	case bh.God:
+		return chat.Type == "private" && from.ID == h.Config.GodID, nil
+	}
+	return false, nil
+}
+
+func (h Controller) isAdmin(ctx context.Context, s bot.Service, chat *bot.Chat, user *bot.User) (bool, error) {
+	if chat.Type == "private" {
 		return true, nil
 	}
 
-	if u.Message.From.ID == h.Config.GodID {
+	if user.ID == h.Config.GodID {
 		return true, nil
 	}
 
-	member, err := s.GetChatMember(bot.GetChatMemberParams{
-		ChatID: u.Message.Chat.ID,
-		UserID: u.Message.From.ID,
+	member, err := s.GetChatMember(ctx, bot.GetChatMemberParams{
+		ChatID: chat.ID,
+		UserID: user.ID,
 	})
 	if err != nil {
 		return false, err
@@ -161,3 +181,17 @@ func (h Controller) isAdmin(s bot.Service, u bot.Update) (bool, error) {
 
 	return member.Status == "creator" || member.Status == "administrator", nil
 }
+
+// sender is the chat and the user behind a message or a button press
+func sender(u bot.Update) (*bot.Chat, *bot.User) {
+	if u.CallbackQuery != nil {
+		if u.CallbackQuery.Message == nil {
+			return nil, u.CallbackQuery.From
+		}
+		return u.CallbackQuery.Message.Chat, u.CallbackQuery.From
+	}
+	if u.Message != nil {
+		return u.Message.Chat, u.Message.From
+	}
+	return nil, nil
+}
@@ -0,0 +1,239 @@
+// Package counter keeps named counters per chat, like how many coffees
+// the group had, with who counted and when.
+package counter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+// MaxNameLength of a counter
+const MaxNameLength = 32
+
+var (
+	ErrInvalidName = errors.New("invalid counter name")
+	// ErrNothingCounted is for undoing when the user has no counts
+	ErrNothingCounted = errors.New("nothing counted")
+)
+
+var nameRegex = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+
+// Service counts with the Repo, at the timezone of the chat.
+type Service struct {
+	Repo     repo.Repo
+	Settings settings.Service
+}
+
+// Name is the counter named s, which may have a # before, in lowercase.
+func Name(s string) (string, error) {
+	name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+	if len([]rune(name)) > MaxNameLength || !nameRegex.MatchString(name) {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// Count saves c, counted by user, and returns the new total of c.Name.
+func (s Service) Count(ctx context.Context, c repo.Count, user repo.User) (int, error) {
+	err := s.Repo.SaveUser(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+
+	c.UserID = user.ID
+	_, err = s.Repo.SaveCount(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	return s.total(ctx, c.ChatID, c.Name)
+}
+
+// Uncount undoes the last count of userID, of any counter if name is
+// empty. It returns the undone count and the new total of its counter.
+func (s Service) Uncount(ctx context.Context, chatID int64, userID int64, name string) (repo.Count, int, error) {
+	c, err := s.Repo.FindLastCount(ctx, chatID, userID, name)
+	if errors.Is(err, repo.ErrNotFound) {
+		return repo.Count{}, 0, ErrNothingCounted
+	}
+	if err != nil {
+		return repo.Count{}, 0, err
+	}
+
+	err = s.Repo.DeleteCount(ctx, c.ID)
+	if err != nil {
+		return *c, 0, err
+	}
+
+	total, err := s.total(ctx, chatID, c.Name)
+	return *c, total, err
+}
+
+// Totals are the counters of the chat, the most counted first.
+func (s Service) Totals(ctx context.Context, chatID int64) ([]repo.CountTotal, error) {
+	return s.Repo.FindChatCountTotals(ctx, chatID)
+}
+
+func (s Service) total(ctx context.Context, chatID int64, name string) (int, error) {
+	totals, err := s.Repo.FindChatCountTotals(ctx, chatID)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range totals {
+		if t.Name == name {
+			return t.Total, nil
+		}
+	}
+	return 0, nil
+}
+
+// Report of the counter name at now.
+func (s Service) Report(ctx context.Context, chatID int64, name string, now time.Time) (Report, error) {
+	loc, err := s.Settings.Location(ctx, chatID)
+	if err != nil {
+		return Report{}, err
+	}
+
+	users, err := s.Repo.FindUserCounts(ctx, chatID, name)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// the weeks go further back than the days
+	times, err := s.Repo.FindCountTimes(ctx, chatID, name, firstWeek(now, loc))
+	if err != nil {
+		return Report{}, err
+	}
+	return NewReport(name, users, times, now, loc), nil
+}
+
+// Period starting at Start, a day or a week, and how many counts it had.
+type Period struct {
+	Start time.Time
+	Total int
+}
+
+// Report of a counter: who counted it and how it went lately.
+type Report struct {
+	Name  string
+	Total int
+	// Users that counted, the ones that counted the most first
+	Users []repo.UserCount
+	// Days are the last reportDays days, today last
+	Days []Period
+	// Weeks are the last reportWeeks weeks, from monday, this one last
+	Weeks []Period
+}
+
+// how far back a Report goes
+const (
+	reportDays  = 7
+	reportWeeks = 4
+)
+
+// NewReport of the counter name, counted by users and at times, as seen
+// at now in loc.
+func NewReport(name string, users []repo.UserCount, times []time.Time, now time.Time, loc *time.Location) Report {
+	r := Report{Name: name, Users: users}
+	for _, u := range users {
+		r.Total += u.Total
+	}
+
+	today := day(now, loc)
+	for i := reportDays - 1; i >= 0; i-- {
+		r.Days = append(r.Days, Period{Start: today.AddDate(0, 0, -i)})
+	}
+	first := firstWeek(now, loc)
+	for i := 0; i < reportWeeks; i++ {
+		r.Weeks = append(r.Weeks, Period{Start: first.AddDate(0, 0, 7*i)})
+	}
+
+	for _, t := range times {
+		d := day(t, loc)
+		add(r.Days, d)
+		add(r.Weeks, d)
+	}
+	return r
+}
+
+// day is the start of the day of t in loc
+func day(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// firstWeek is the monday that starts the weeks of a Report at now
+func firstWeek(now time.Time, loc *time.Location) time.Time {
+	today := day(now, loc)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	return monday.AddDate(0, 0, -7*(reportWeeks-1))
+}
+
+// add counts d in the last period of periods that started before it
+func add(periods []Period, d time.Time) {
+	for i := len(periods) - 1; i >= 0; i-- {
+		if !d.Before(periods[i].Start) {
+			periods[i].Total++
+			return
+		}
+	}
+}
+
+var weekdays = []string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"}
+
+// reportText is r as a message, with a bar for each period
+func reportText(r Report) string {
+	today := r.Days[len(r.Days)-1].Total
+	week := r.Weeks[len(r.Weeks)-1].Total
+	text := fmt.Sprintf("%s: %d (hoje %d, na semana %d)\n", r.Name, r.Total, today, week)
+
+	text += "\nquem contou:\n"
+	for _, u := range r.Users {
+		name := u.User.Name()
+		if name == "" {
+			name = "desconhecido"
+		}
+		text += fmt.Sprintf("- %s: %d\n", name, u.Total)
+	}
+
+	text += "\núltimos dias:\n"
+	max := maxTotal(r.Days)
+	for _, p := range r.Days {
+		text += fmt.Sprintf("%s %s %s%d\n", weekdays[p.Start.Weekday()], p.Start.Format("02/01"), bar(p.Total, max), p.Total)
+	}
+
+	text += "\núltimas semanas:\n"
+	max = maxTotal(r.Weeks)
+	for _, p := range r.Weeks {
+		text += fmt.Sprintf("desde %s %s%d\n", p.Start.Format("02/01"), bar(p.Total, max), p.Total)
+	}
+	return text
+}
+
+func maxTotal(periods []Period) int {
+	max := 0
+	for _, p := range periods {
+		if p.Total > max {
+			max = p.Total
+		}
+	}
+	return max
+}
+
+// barWidth is the width of the bar of the biggest total
+const barWidth = 10
+
+// bar of n out of max, with a space after, or nothing for 0
+func bar(n, max int) string {
+	if n == 0 {
+		return ""
+	}
+	width := (n*barWidth + max - 1) / max
+	return strings.Repeat("▇", width) + " "
+}
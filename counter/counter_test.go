@@ -0,0 +1,142 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings/settingstest"
+)
+
+func newService(t *testing.T) Service {
+	t.Helper()
+
+	s := settingstest.New(t)
+	return Service{Repo: s.Repo, Settings: s}
+}
+
+func TestName(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{"cafe", "cafe"},
+		{"#Café", "café"},
+		{"pão_de_queijo", "pão_de_queijo"},
+	} {
+		got, err := Name(tc.s)
+		if err != nil || got != tc.want {
+			t.Fatalf("%q - want: %q, got: %q, %v", tc.s, tc.want, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "#", "café!", "uma-coisa", "abcdefghijklmnopqrstuvwxyz0123456"} {
+		_, err := Name(s)
+		if !errors.Is(err, ErrInvalidName) {
+			t.Fatalf("%q - err want: %v, got: %v", s, ErrInvalidName, err)
+		}
+	}
+}
+
+func TestCountAndUncount(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+
+	alice := repo.User{ID: 1, Username: "alice"}
+	bob := repo.User{ID: 2, Username: "bob"}
+
+	for i, tc := range []struct {
+		user repo.User
+		name string
+		want int
+	}{
+		{alice, "cafe", 1},
+		{bob, "cafe", 2},
+		{alice, "pao", 1},
+		{alice, "cafe", 3},
+	} {
+		total, err := s.Count(ctx, repo.Count{
+			ChatID:    -1,
+			Name:      tc.name,
+			MessageID: i + 1,
+			Time:      time.Now(),
+		}, tc.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != tc.want {
+			t.Fatalf("count %d - want: %d, got: %d", i, tc.want, total)
+		}
+	}
+
+	// bob undoes only his own
+	c, total, err := s.Uncount(ctx, -1, bob.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "cafe" || c.MessageID != 2 || total != 2 {
+		t.Fatalf("want bob's cafe undone leaving 2, got: %+v, %d", c, total)
+	}
+	_, _, err = s.Uncount(ctx, -1, bob.ID, "")
+	if !errors.Is(err, ErrNothingCounted) {
+		t.Fatalf("err - want: %v, got: %v", ErrNothingCounted, err)
+	}
+
+	c, total, err = s.Uncount(ctx, -1, alice.ID, "pao")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "pao" || total != 0 {
+		t.Fatalf("want alice's pao undone leaving 0, got: %+v, %d", c, total)
+	}
+
+	r, err := s.Report(ctx, -1, "cafe", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != 2 || len(r.Users) != 1 || r.Users[0].Total != 2 || r.Days[len(r.Days)-1].Total != 2 {
+		t.Fatalf("want 2 coffees of alice today, got: %+v", r)
+	}
+}
+
+func TestReport(t *testing.T) {
+	// a sunday
+	now := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	times := []time.Time{
+		// before the first week, from monday 21/09
+		time.Date(2026, 9, 20, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 9, 27, 10, 0, 0, 0, time.UTC),
+		// last week, before the days
+		time.Date(2026, 10, 11, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC),
+	}
+	users := []repo.UserCount{
+		{User: repo.User{ID: 1, Username: "alice"}, Total: 5},
+		{User: repo.User{ID: 2}, Total: 2},
+	}
+
+	r := NewReport("cafe", users, times, now, time.UTC)
+	want := "cafe: 7 (hoje 2, na semana 4)\n" +
+		"\nquem contou:\n- alice: 5\n- desconhecido: 2\n" +
+		"\núltimos dias:\n" +
+		"seg 12/10 ▇▇▇▇▇ 1\n" +
+		"ter 13/10 0\n" +
+		"qua 14/10 0\n" +
+		"qui 15/10 0\n" +
+		"sex 16/10 0\n" +
+		"sáb 17/10 ▇▇▇▇▇ 1\n" +
+		"dom 18/10 ▇▇▇▇▇▇▇▇▇▇ 2\n" +
+		"\núltimas semanas:\n" +
+		"desde 21/09 ▇▇▇ 1\n" +
+		"desde 28/09 0\n" +
+		"desde 05/10 ▇▇▇ 1\n" +
+		"desde 12/10 ▇▇▇▇▇▇▇▇▇▇ 4\n"
+	if got := reportText(r); got != want {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+}
@@ -0,0 +1,113 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// Handler answers the counter commands with the Service.
+type Handler struct {
+	Service Service
+}
+
+var errInvalidName = bh.Reply{Text: fmt.Sprintf("nome inválido, use só letras, números e _, até %d", MaxNameLength)}
+
+// Count handles /conta, counting the message that called it.
+func (h Handler) Count(ctx context.Context, s bot.Service, u bot.Update) error {
+	name, err := Name(bh.ArgsFrom(ctx).Text("nome"))
+	if err != nil {
+		return errInvalidName
+	}
+
+	user := u.Message.From
+	total, err := h.Service.Count(ctx, repo.Count{
+		ChatID:    u.Message.Chat.ID,
+		Name:      name,
+		MessageID: u.Message.MessageID,
+		Time:      time.Now(),
+	}, repo.User{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		Username:  user.Username,
+	})
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	return bh.Reply{Text: fmt.Sprintf("%s: %d", name, total)}
+}
+
+// Uncount handles /desconta, undoing the last count of the user.
+func (h Handler) Uncount(ctx context.Context, s bot.Service, u bot.Update) error {
+	args := bh.ArgsFrom(ctx)
+	name := ""
+	if args.Has("nome") {
+		var err error
+		name, err = Name(args.Text("nome"))
+		if err != nil {
+			return errInvalidName
+		}
+	}
+
+	c, total, err := h.Service.Uncount(ctx, u.Message.Chat.ID, u.Message.From.ID, name)
+	if errors.Is(err, ErrNothingCounted) {
+		if name != "" {
+			return bh.Reply{Text: "você não contou " + name}
+		}
+		return bh.Reply{Text: "você não contou nada"}
+	}
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	return bh.Reply{Text: fmt.Sprintf("descontado, %s: %d", c.Name, total)}
+}
+
+// Report handles /contagem, with the report of a counter or the totals of
+// all of them.
+func (h Handler) Report(ctx context.Context, s bot.Service, u bot.Update) error {
+	args := bh.ArgsFrom(ctx)
+	chatID := u.Message.Chat.ID
+
+	if !args.Has("nome") {
+		totals, err := h.Service.Totals(ctx, chatID)
+		if err != nil {
+			log.Print(err)
+			return bh.Reply{Text: "vish deu ruim"}
+		}
+		if len(totals) == 0 {
+			return bh.Reply{Text: "nada contado ainda, conte com /conta nome"}
+		}
+
+		msg := "contagens:\n"
+		for _, t := range totals {
+			msg += fmt.Sprintf("- %s: %d\n", t.Name, t.Total)
+		}
+		return bh.Reply{Text: msg}
+	}
+
+	name, err := Name(args.Text("nome"))
+	if err != nil {
+		return errInvalidName
+	}
+
+	r, err := h.Service.Report(ctx, chatID, name, time.Now())
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+	if r.Total == 0 {
+		return bh.Reply{Text: "ninguém contou " + name + " ainda"}
+	}
+
+	return bh.Reply{Text: reportText(r)}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/controller"
+	"github.com/igoracmelo/euperturbot/counter"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/search"
+	"github.com/igoracmelo/euperturbot/settings"
+	"github.com/igoracmelo/euperturbot/summary"
+	"github.com/igoracmelo/euperturbot/topic"
+)
+
+// registerHandlers sets up the middlewares and handlers of the bot on uh.
+// The returned router is used to publish the commands to Telegram.
+func registerHandlers(uh *bh.UpdateController, c controller.Controller, r repo.Repo) *bh.CommandRouter {
+	uh.Middleware(c.EnsureStarted(), bh.AnyMessage)
+	uh.Middleware(c.EnsureStarted(), bh.AnyEditedText)
+	uh.Middleware(c.IgnoreForwardedCommand(), bh.AnyCommand)
+
+	dialogs := bh.NewDialogs(controller.DialogStore{Repo: r})
+	topics := topic.Handler{
+		Service: topic.Service{Repo: r, Settings: c.Settings},
+		Dialogs: dialogs,
+		Allowed: c.Allowed,
+	}
+	dialogs.Add(topics.ScheduleDialog())
+	uh.Middleware(dialogs.Middleware)
+
+	uh.Handle(bh.ChatMigrated, c.MigrateChat)
+
+	counters := counter.Handler{
+		Service: counter.Service{Repo: r, Settings: c.Settings},
+	}
+
+	searches := search.Handler{
+		Service: search.Service{Repo: r, Settings: c.Settings},
+	}
+
+	summaries := summary.Handler{
+		Service: summary.Service{Repo: r, OpenAI: c.OpenAI, Settings: c.Settings},
+	}
+
+	chatConfig := settings.Handler{
+		Service: c.Settings,
+		Allowed: c.Allowed,
+	}
+
+	cmds := bh.NewCommandRouter()
+	cmds.Guard(bh.Admin, c.RequireAdmin)
+	cmds.Guard(bh.God, c.RequireGod)
+	cmds.Features(c.Settings.Enabled)
+
+	cmds.Add(bh.CommandDef{
+		Name:        "start",
+		Description: "ativa o bot no grupo",
+		Permission:  bh.Admin,
+		Handler:     c.Start,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "suba",
+		Description: "se inscreve nos tópicos",
+		Args: []bh.Arg{
+			{Name: "usuario", Type: bh.ArgUser, Optional: true},
+			{Name: "topicos", Type: bh.ArgTopics},
+		},
+		Handler: topics.Subscribe,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "desca",
+		Description: "sai dos tópicos",
+		Args:        []bh.Arg{{Name: "topicos", Type: bh.ArgTopics}},
+		Handler:     topics.Unsubscribe,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "pollo",
+		Description: "cria uma enquete",
+		Args:        []bh.Arg{{Name: "pergunta", Type: bh.ArgText}},
+		Handler:     c.CreatePoll,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "bora",
+		Description: "chama os inscritos no tópico",
+		Args:        []bh.Arg{{Name: "topico", Type: bh.ArgTopic}},
+		Handler:     c.CallSubs,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "quem",
+		Description: "lista os inscritos no tópico",
+		Args:        []bh.Arg{{Name: "topico", Type: bh.ArgTopic}},
+		Handler:     c.ListSubs,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "lista",
+		Description: "lista as suas inscrições",
+		Handler:     topics.ListByUser,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "agenda",
+		Description: "chama os inscritos no tópico daqui a um tempo, numa data ou toda semana",
+		Args: []bh.Arg{
+			{Name: "topico", Type: bh.ArgTopic, Optional: true},
+			{Name: "quando", Type: bh.ArgText, Optional: true},
+		},
+		Handler: topics.Schedule,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "agendas",
+		Description: "lista as agendas do grupo",
+		Handler:     topics.ListScheduled,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "desagenda",
+		Description: "cancela uma agenda",
+		Args:        []bh.Arg{{Name: "id", Type: bh.ArgWord}},
+		Handler:     topics.Unschedule,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "evento",
+		Description: "marca um evento pros inscritos no tópico dizerem se vão",
+		Args: []bh.Arg{
+			{Name: "topico", Type: bh.ArgTopic},
+			{Name: "detalhes", Type: bh.ArgText},
+		},
+		Handler: topics.Event,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "cancelar",
+		Description: "cancela a conversa em andamento",
+		Handler:     dialogs.Cancel,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "listudo",
+		Description: "lista os tópicos do grupo",
+		Handler:     c.ListChatTopics,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "conta",
+		Description: "soma um no contador",
+		Args:        []bh.Arg{{Name: "nome", Type: bh.ArgWord}},
+		Handler:     counters.Count,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "desconta",
+		Description: "desfaz a sua última contagem",
+		Args:        []bh.Arg{{Name: "nome", Type: bh.ArgWord, Optional: true}},
+		Handler:     counters.Uncount,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "contagem",
+		Description: "mostra os contadores do grupo, ou quem contou e quando",
+		Args:        []bh.Arg{{Name: "nome", Type: bh.ArgWord, Optional: true}},
+		Handler:     counters.Report,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "busca",
+		Description: "busca nas mensagens salvas do grupo",
+		Args:        []bh.Arg{{Name: "termo", Type: bh.ArgText}},
+		Handler:     searches.Search,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "a",
+		Description: "salva o áudio respondido",
+		Feature:     settings.Audio,
+		Disabled:    "comando desativado. ative com /config",
+		Handler:     c.SaveAudio,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "arand",
+		Description: "manda um áudio aleatório",
+		Feature:     settings.Audio,
+		Disabled:    "comando desativado. ative com /config",
+		Handler:     c.SendRandomAudio,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "ask",
+		Description: "pergunta pro gpt",
+		Args:        []bh.Arg{{Name: "pergunta", Type: bh.ArgText}},
+		Feature:     settings.Ask,
+		Handler:     c.GPTCompletion,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "cask",
+		Description: "pergunta pro gpt com o contexto da conversa",
+		Args:        []bh.Arg{{Name: "pergunta", Type: bh.ArgText}},
+		Feature:     settings.CAsk,
+		Disabled:    "comando desativado. ative com /config\nATENÇÃO! Ao ativar essa opção, as mensagens de texto serão salvas no banco de dados do s",
+		Handler:     c.GPTChatCompletion,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "resumo",
+		Description: "resume a conversa das últimas horas, ou desde a mensagem respondida",
+		Args:        []bh.Arg{{Name: "janela", Type: bh.ArgDuration, Optional: true}},
+		Timeout:     summary.Timeout,
+		Feature:     settings.CAsk,
+		Disabled:    "o /resumo usa as mensagens salvas, ative o cask com /config",
+		Handler:     summaries.Summarize,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "config",
+		Description: "liga e desliga as funções do bot no grupo",
+		Handler:     chatConfig.Config,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:        "ajuste",
+		Description: "mostra e muda os ajustes do grupo",
+		Args: []bh.Arg{
+			{Name: "chave", Type: bh.ArgWord, Optional: true},
+			{Name: "valor", Type: bh.ArgText, Optional: true},
+		},
+		Permission: bh.Admin,
+		Handler:    chatConfig.Set,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:       "backup",
+		Permission: bh.God,
+		Hidden:     true,
+		Handler:    c.Backup,
+	})
+	cmds.Add(bh.CommandDef{
+		Name:    "xonotic",
+		Hidden:  true,
+		Handler: c.Xonotic,
+	})
+
+	cmds.Register(uh)
+
+	callbacks := bh.NewCallbackRouter()
+	callbacks.Handle("poll:vote", c.PollVote)
+	callbacks.Handle("cfg:toggle", chatConfig.Toggle)
+	callbacks.Handle("sched:cancel", topics.CancelButton)
+	callbacks.Handle("evt:rsvp", topics.EventAnswer)
+	callbacks.Handle("busca:page", searches.PageButton)
+	// polls sent before the routes have just the vote as data
+	callbacks.Fallback(c.PollVote)
+	callbacks.Register(uh)
+
+	uh.Handle(bh.AnyInlineQuery, c.InlineQuery)
+
+	texts := bh.NewTextPipeline()
+	texts.Add("sed", c.Sed)
+	texts.Add("thread", c.ContinueThread)
+	texts.Add("mention", topics.MentionSubscribers)
+	texts.Always("history", c.SaveMessage)
+	texts.Register(uh)
+
+	// edits are saved like the messages, but only call the topics they add
+	// and never answer sed nor the /ask threads again
+	edits := bh.NewTextPipeline()
+	edits.Add("mention", topics.MentionEdited)
+	edits.Always("history", c.SaveEdit)
+	uh.Handle(bh.AnyEditedText, edits.HandleText)
+
+	return cmds
+}
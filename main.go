@@ -2,8 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/igoracmelo/euperturbot/bot"
 	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
@@ -11,6 +17,8 @@ import (
 	"github.com/igoracmelo/euperturbot/controller"
 	"github.com/igoracmelo/euperturbot/openai"
 	"github.com/igoracmelo/euperturbot/repo/sqliterepo"
+	"github.com/igoracmelo/euperturbot/settings"
+	"github.com/igoracmelo/euperturbot/topic"
 	_ "modernc.org/sqlite"
 )
 
@@ -24,7 +32,10 @@ func main() {
 		panic(err)
 	}
 
-	repo, err := sqliterepo.Open(context.TODO(), "euperturbot.db", "./repo/sqliterepo/migrations")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err := sqliterepo.Open(ctx, "euperturbot.db", "./repo/sqliterepo/migrations")
 	if err != nil {
 		panic(err)
 	}
@@ -33,7 +44,7 @@ func main() {
 	oai := openai.NewService(conf.OpenAIKey, http.DefaultClient)
 	myBot := bot.NewService(conf.BotToken)
 
-	botInfo, err := myBot.GetMe()
+	botInfo, err := myBot.GetMe(ctx)
 	if err != nil {
 		panic(err)
 	}
@@ -43,65 +54,110 @@ func main() {
 		OpenAI:  oai,
 		BotInfo: botInfo,
 		Config:  &conf,
+		Settings: settings.Service{
+			Repo:     repo,
+			Registry: settings.New(),
+		},
+	}
+
+	uh := bh.NewUpdateHandler(myBot, nil)
+	uh.Workers = conf.Updates.Workers
+	uh.QueueSize = conf.Updates.QueueSize
+
+	// Start stops when startCtx is done or its source is closed
+	startCtx := ctx
+	switch conf.UpdateMode {
+	case config.UpdateModeWebhook:
+		if conf.Webhook.Secret == "" {
+			log.Fatal("webhook.secret is required in webhook mode")
+		}
+		err = myBot.SetWebhook(ctx, bot.SetWebhookParams{
+			URL:            conf.Webhook.URL,
+			SecretToken:    conf.Webhook.Secret,
+			AllowedUpdates: bot.AllowedUpdates,
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		updates := make(chan bot.Update)
+		uh.Source = updates
+		webhookServer := &http.Server{
+			Addr: conf.Webhook.Addr,
+			Handler: bot.WebhookHandler{
+				Secret:  conf.Webhook.Secret,
+				Updates: updates,
+			},
+		}
+		go func() {
+			err := webhookServer.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+
+		// the updates are answered with 200 once Start takes them, so it
+		// must take every one the server accepts, until it is shut down
+		var stopStart context.CancelFunc
+		startCtx, stopStart = context.WithCancel(context.Background())
+		defer stopStart()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := webhookServer.Shutdown(shutdownCtx)
+			if err != nil {
+				log.Print(err)
+				// requests may still be sending to updates, so it can't
+				// be closed. the ones left are answered with 503
+				_ = webhookServer.Close()
+				stopStart()
+				return
+			}
+			close(updates)
+		}()
+	case config.UpdateModePolling:
+		// getUpdates doesn't work while a webhook is set
+		err = myBot.DeleteWebhook(ctx, bot.DeleteWebhookParams{})
+		if err != nil {
+			panic(err)
+		}
+		// only the handled updates are confirmed, see Offset
+		uh.Source = myBot.GetUpdatesChannel(ctx, uh.Offset)
+	default:
+		log.Fatalf("invalid updateMode: %q", conf.UpdateMode)
+	}
+
+	workers := sync.WaitGroup{}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runner := topic.NewRunner(topic.Service{Repo: repo, Settings: c.Settings}, myBot)
+		runner.CatchUp = time.Duration(conf.Schedule.CatchUp)
+		runner.MaxAttempts = conf.Schedule.MaxAttempts
+		runner.RetryDelay = time.Duration(conf.Schedule.RetryDelay)
+		runner.Run(ctx)
+	}()
+
+	cmds := registerHandlers(uh, c, repo)
+
+	err = cmds.SetMyCommands(ctx, myBot)
+	if err != nil {
+		log.Print(err)
+	}
+
+	uh.Start(startCtx)
+	log.Print("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if offset := uh.Offset(); offset != 0 && conf.UpdateMode == config.UpdateModePolling {
+		err = myBot.CommitUpdates(shutdownCtx, offset)
+		if err != nil {
+			log.Print(err)
+		}
 	}
 
-	updates := myBot.GetUpdatesChannel()
-	uh := bh.NewUpdateHandler(myBot, updates)
-
-	go mentionScheduledTopicsWorker(context.TODO(), repo.DB(), myBot)
-
-	uh.Middleware(c.EnsureStarted(), bh.AnyMessage)
-	uh.Middleware(c.IgnoreForwardedCommand(), bh.AnyCommand)
-
-	uh.Handle(bh.Command("start"), c.RequireAdmin(c.Start))
-
-	uh.Handle(bh.Command("suba"), func(s bot.Service, u bot.Update) error {
-		return subscribeToTopic(context.TODO(), repo.DB(), u)
-	})
-
-	uh.Handle(bh.Command("desca"), func(s bot.Service, u bot.Update) error {
-		return unsubscribe(context.TODO(), repo.DB(), u)
-	})
-
-	uh.Handle(bh.Command("pollo"), c.CreatePoll)
-	uh.Handle(bh.Command("bora"), c.CallSubs)
-	uh.Handle(bh.Command("quem"), c.ListSubs)
-
-	uh.Handle(bh.Command("lista"), func(s bot.Service, u bot.Update) error {
-		return listByUser(context.TODO(), repo.DB(), u)
-	})
-
-	uh.Handle(bh.Command("agenda"), func(s bot.Service, u bot.Update) error {
-		return scheduleMentionSubscribers(context.TODO(), repo.DB(), s, u)
-	})
-
-	uh.Handle(bh.Command("listudo"), c.ListChatTopics)
-	// c.Handle(tgh.Command("conta"), h.CountEvent)
-	// c.Handle(tgh.Command("desconta"), h.UncountEvent)
-	uh.Handle(bh.Command("a"), c.SaveAudio)
-	uh.Handle(bh.Command("arand"), c.SendRandomAudio)
-	uh.Handle(bh.Command("ask"), c.GPTCompletion)
-	uh.Handle(bh.Command("cask"), c.GPTChatCompletion)
-	uh.Handle(bh.Command("backup"), c.RequireGod(c.Backup))
-	uh.Handle(bh.Command("xonotic"), c.Xonotic)
-	uh.Handle(bh.AnyCallbackQuery, c.CallbackQuery)
-	uh.Handle(bh.AnyInlineQuery, c.InlineQuery)
-
-	// switches
-	uh.Handle(bh.Command("enable_create_topics"), c.RequireAdmin(c.Enable("create_topics")))
-	uh.Handle(bh.Command("disable_create_topics"), c.RequireAdmin(c.Disable("create_topics")))
-	uh.Handle(bh.Command("enable_audio"), c.RequireAdmin(c.Enable("audio")))
-	uh.Handle(bh.Command("disable_audio"), c.RequireAdmin(c.Disable("audio")))
-	uh.Handle(bh.Command("enable_ask"), c.RequireAdmin(c.Enable("ask")))
-	uh.Handle(bh.Command("disable_ask"), c.RequireAdmin(c.Disable("ask")))
-	uh.Handle(bh.Command("enable_cask"), c.RequireAdmin(c.Enable("cask")))
-	uh.Handle(bh.Command("disable_cask"), c.RequireAdmin(c.Disable("cask")))
-	uh.Handle(bh.Command("enable_sed"), c.RequireAdmin(c.Enable("sed")))
-	uh.Handle(bh.Command("disable_sed"), c.RequireAdmin(c.Disable("sed")))
-
-	uh.Handle(bh.AnyText, func(s bot.Service, u bot.Update) error {
-		return mentionSubscribers(context.TODO(), repo.DB(), s, u)
-	})
-
-	uh.Start()
+	workers.Wait()
 }
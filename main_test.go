@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/bot/bottest"
+	"github.com/igoracmelo/euperturbot/config"
+	"github.com/igoracmelo/euperturbot/controller"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo"
+	"github.com/igoracmelo/euperturbot/search"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+var (
+	group  = bot.Chat{ID: -100, Type: "group", Title: "grupo"}
+	admin  = bot.User{ID: 1, FirstName: "Admin", Username: "admin"}
+	member = bot.User{ID: 2, FirstName: "Membro", Username: "membro"}
+)
+
+// newTestBot runs the bot against a fake Bot API server until the test
+// ends. admin is an administrator of group.
+func newTestBot(t *testing.T) *bottest.Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	srv := bottest.NewServer()
+	srv.SetChatMember(group.ID, admin.ID, "administrator")
+
+	// :memory: would give each connection of the pool its own database
+	repo, err := sqliterepo.Open(ctx, filepath.Join(t.TempDir(), "test.db"), "./repo/sqliterepo/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srv.Service()
+	me, err := s.GetMe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := controller.Controller{
+		Repo:    repo,
+		OpenAI:  openai.ServiceDouble{},
+		BotInfo: me,
+		Config:  &config.Config{},
+		Settings: settings.Service{
+			Repo:     repo,
+			Registry: settings.New(),
+		},
+	}
+
+	uh := bh.NewUpdateHandler(s, nil)
+	uh.Source = s.GetUpdatesChannel(ctx, uh.Offset)
+	registerHandlers(uh, c, repo)
+
+	stopped := make(chan struct{})
+	go func() {
+		uh.Start(ctx)
+		close(stopped)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+		srv.Close()
+		repo.Close()
+	})
+	return srv
+}
+
+// waitSent waits until the bot sent n messages and returns their texts.
+func waitSent(t *testing.T, srv *bottest.Server, n int) []string {
+	t.Helper()
+	ok := srv.WaitFor(func() bool {
+		return len(srv.Sent()) >= n
+	}, 2*time.Second)
+	if !ok {
+		t.Fatalf("want %d messages sent, got: %q", n, srv.SentTexts())
+	}
+	return srv.SentTexts()
+}
+
+func assertTexts(t *testing.T, want []string, got []string) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("texts - want: %q, got: %q", want, got)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("texts - want: %q, got: %q", want, got)
+		}
+	}
+}
+
+// subscribeMember has admin subscribe member to topic in a reply, since
+// members can't create topics by default.
+func subscribeMember(srv *bottest.Server, topic string) {
+	msg := srv.SendText(group, member, "eu jogo")
+	srv.SendMessage(bot.Message{
+		Chat:           &group,
+		From:           &admin,
+		Text:           "/suba " + topic,
+		ReplyToMessage: &msg,
+	})
+}
+
+func TestSubscribeAndList(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, member, "/suba #futebol")
+	srv.SendText(group, admin, "/suba #futebol #volei")
+	srv.SendText(group, member, "/suba #futebol #volei")
+	srv.SendText(group, member, "/desca #volei")
+	srv.SendText(group, member, "/quem #futebol")
+
+	assertTexts(t, []string{
+		"vamo que vamo",
+		"só admins criam tópicos novos, ative o create_topics com /config para liberar",
+		"inscrições adicionadas: #futebol, #volei",
+		"inscrições adicionadas: #futebol, #volei",
+		"feito meu querido",
+		"*inscritos \\(2\\)*\n\\- admin\n\\- membro\n",
+	}, waitSent(t, srv, 6))
+}
+
+func TestIgnoresChatNotStarted(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, member, "/suba #futebol")
+	srv.SendText(group, member, "/start")
+	srv.SendText(group, admin, "/start")
+
+	assertTexts(t, []string{
+		"você não tem permissão para isso",
+		"vamo que vamo",
+	}, waitSent(t, srv, 2))
+}
+
+func TestUsageError(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/quem futebol")
+
+	texts := waitSent(t, srv, 2)
+	if want := "tópico inválido: futebol\nuso: /quem <#topico>"; texts[1] != want {
+		t.Fatalf("want: %q, got: %q", want, texts[1])
+	}
+}
+
+func TestPollVote(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	subscribeMember(srv, "#futebol")
+	srv.SendText(group, admin, "/bora #futebol")
+
+	waitSent(t, srv, 3)
+	poll := srv.Sent()[2]
+	if !strings.Contains(poll.Text, "restam \\(1 votos\\)") {
+		t.Fatalf("want poll with 1 remaining vote, got: %q", poll.Text)
+	}
+
+	srv.Press(srv.Messages()[2], member, poll.ReplyMarkup.InlineKeyboard[0][0].CallbackData)
+
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want callback answered")
+	}
+
+	edits := srv.Edits()
+	if len(edits) != 1 || !strings.Contains(edits[0].Text, "sim \\(1 votos\\)") {
+		t.Fatalf("want poll edited with 1 vote, got: %+v", edits)
+	}
+}
+
+func TestScheduleDialog(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/suba #futebol")
+	srv.SendText(group, admin, "/agenda")
+
+	texts := waitSent(t, srv, 3)
+	if !strings.HasPrefix(texts[2], "qual tópico?") {
+		t.Fatalf("want topic question, got: %q", texts[2])
+	}
+	button := srv.Sent()[2].ReplyMarkup.InlineKeyboard[0][0]
+	if button.Text != "#futebol" {
+		t.Fatalf("want button for #futebol, got: %+v", button)
+	}
+
+	srv.Press(srv.Messages()[2], admin, button.CallbackData)
+	texts = waitSent(t, srv, 4)
+	if !strings.HasPrefix(texts[3], "quando?") {
+		t.Fatalf("want time question, got: %q", texts[3])
+	}
+
+	// only a reply to the question is an answer
+	srv.SendText(group, admin, "1h")
+	srv.SendMessage(bot.Message{Chat: &group, From: &admin, Text: "1h", ReplyToMessage: &srv.Messages()[3]})
+	texts = waitSent(t, srv, 5)
+	if texts[4] != "agendado para daqui a 1h0m0s" {
+		t.Fatalf("want scheduled, got: %q", texts[4])
+	}
+}
+
+func TestScheduleRecurring(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, member, "/agenda #futebol toda sexta 20:00")
+	srv.SendText(group, member, "/agendas")
+
+	texts := waitSent(t, srv, 3)
+	if !strings.HasPrefix(texts[1], "agendado toda sexta às 20:00, a próxima é sex ") {
+		t.Fatalf("want scheduled every friday, got: %q", texts[1])
+	}
+	if !strings.HasPrefix(texts[2], "agendas do grupo:\n(1) #futebol - toda sexta às 20:00, próxima sex ") {
+		t.Fatalf("want schedule listed, got: %q", texts[2])
+	}
+
+	// only who scheduled or an admin
+	srv.SendText(group, bot.User{ID: 3, FirstName: "Outro"}, "/desagenda 1")
+	texts = waitSent(t, srv, 4)
+	if texts[3] != "só quem agendou ou um admin pode cancelar" {
+		t.Fatalf("want not allowed, got: %q", texts[3])
+	}
+
+	button := srv.Sent()[2].ReplyMarkup.InlineKeyboard[0][0]
+	srv.Press(srv.Messages()[2], admin, button.CallbackData)
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want callback answered")
+	}
+	if answer := srv.CallbackAnswers()[0].Text; answer != "agenda cancelada: #futebol" {
+		t.Fatalf("want canceled, got: %q", answer)
+	}
+	edits := srv.Edits()
+	if len(edits) != 1 || edits[0].Text != "nenhuma agenda pendente" {
+		t.Fatalf("want list emptied, got: %+v", edits)
+	}
+}
+
+func TestEvent(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	subscribeMember(srv, "#futebol")
+	srv.SendText(group, admin, "/evento #futebol amanhã 20h 1 vaga pelada")
+
+	texts := waitSent(t, srv, 4)
+	if !strings.HasPrefix(texts[2], "📅 #futebol - pelada\n") {
+		t.Fatalf("want event, got: %q", texts[2])
+	}
+	if !strings.Contains(texts[3], "tg://user?id=2") {
+		t.Fatalf("want subscriber mentioned, got: %q", texts[3])
+	}
+
+	event := srv.Messages()[2]
+	yes := srv.Sent()[2].ReplyMarkup.InlineKeyboard[0][0].CallbackData
+	no := srv.Sent()[2].ReplyMarkup.InlineKeyboard[0][2].CallbackData
+
+	answered := func(n int) []string {
+		t.Helper()
+		ok := srv.WaitFor(func() bool {
+			return len(srv.CallbackAnswers()) == n
+		}, 2*time.Second)
+		if !ok {
+			t.Fatalf("want %d callbacks answered", n)
+		}
+		toasts := []string{}
+		for _, a := range srv.CallbackAnswers() {
+			toasts = append(toasts, a.Text)
+		}
+		return toasts
+	}
+
+	srv.Press(event, admin, yes)
+	answered(1)
+	srv.Press(event, member, yes)
+	answered(2)
+	srv.Press(event, admin, no)
+	assertTexts(t, []string{
+		"você vai",
+		"lotado, você está na lista de espera",
+		"você não vai",
+	}, answered(3))
+
+	texts = waitSent(t, srv, 5)
+	if !strings.HasPrefix(texts[4], "abriu vaga, agora você vai: [membro](tg://user?id=2)") {
+		t.Fatalf("want member promoted, got: %q", texts[4])
+	}
+	edits := srv.Edits()
+	if last := edits[len(edits)-1].Text; !strings.Contains(last, "vou (1/1):\n- membro\nnão vou (1):\n- admin\n") {
+		t.Fatalf("want member going and admin not, got: %q", last)
+	}
+}
+
+func TestCount(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/conta cafe")
+	srv.SendText(group, member, "/conta #Cafe")
+	srv.SendText(group, member, "/conta pao")
+	srv.SendText(group, member, "/desconta")
+	srv.SendText(group, member, "/desconta pao")
+	srv.SendText(group, member, "/contagem")
+
+	texts := waitSent(t, srv, 7)
+	assertTexts(t, []string{
+		"cafe: 1",
+		"cafe: 2",
+		"pao: 1",
+		"descontado, pao: 0",
+		"você não contou pao",
+		"contagens:\n- cafe: 2\n",
+	}, texts[1:])
+
+	srv.SendText(group, member, "/contagem cafe")
+	texts = waitSent(t, srv, 8)
+	if !strings.HasPrefix(texts[7], "cafe: 2 (hoje 2, na semana 2)\n\nquem contou:\n- admin: 1\n- membro: 1\n") {
+		t.Fatalf("want the report of cafe, got: %q", texts[7])
+	}
+}
+
+func TestSed(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/config")
+	waitSent(t, srv, 2)
+	srv.Press(srv.Messages()[1], admin, "cfg:toggle:sed")
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want sed enabled")
+	}
+
+	original := srv.SendText(group, member, "bom dia, grupo")
+	srv.SendMessage(bot.Message{
+		Chat:           &group,
+		From:           &admin,
+		Text:           "s|dia|noite|; y/o/0/",
+		ReplyToMessage: &original,
+	})
+
+	texts := waitSent(t, srv, 3)
+	if texts[2] != "b0m n0ite, grup0" {
+		t.Fatalf("want the message replaced, got: %q", texts[2])
+	}
+	if srv.Sent()[2].ReplyToMessageID != original.MessageID {
+		t.Fatalf("want a reply to the original, got: %+v", srv.Sent()[2])
+	}
+}
+
+func TestContinueThread(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/config")
+	waitSent(t, srv, 2)
+	srv.Press(srv.Messages()[1], admin, "cfg:toggle:ask")
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want ask enabled")
+	}
+
+	srv.SendText(group, member, "/ask oi")
+	waitSent(t, srv, 3)
+	answer := srv.Messages()[2]
+
+	// replies to the answer continue it, even with a #topic
+	srv.SendMessage(bot.Message{
+		Chat:           &group,
+		From:           &member,
+		Text:           "e o #futebol?",
+		ReplyToMessage: &answer,
+	})
+	texts := waitSent(t, srv, 4)
+	if texts[3] != "Carregando..." {
+		t.Fatalf("want the thread continued, got: %q", texts[3])
+	}
+}
+
+func TestEditedMessage(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	subscribeMember(srv, "#futebol")
+	original := srv.SendText(group, admin, "bora jogar?")
+	srv.SendText(group, admin, "/config")
+	waitSent(t, srv, 3)
+
+	// off by default
+	srv.EditText(original, "bora jogar? #futebol")
+	srv.SendText(group, admin, "/lista")
+	waitSent(t, srv, 4)
+
+	srv.Press(srv.Messages()[2], admin, "cfg:toggle:edit_mentions")
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want edit mentions enabled")
+	}
+
+	srv.EditText(original, "bora jogar? #futebol!")
+	// called already
+	srv.EditText(original, "bora jogar hoje? #futebol!")
+	srv.SendText(group, admin, "/lista")
+
+	texts := waitSent(t, srv, 6)
+	assertTexts(t, []string{
+		"voce nao ta inscrito em nenhum topico",
+		"[membro](tg://user?id=2) ",
+		"voce nao ta inscrito em nenhum topico",
+	}, texts[3:])
+	if reply := srv.Sent()[4].ReplyToMessageID; reply != original.MessageID {
+		t.Fatalf("want the mention replying the edited message, got reply to: %d", reply)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/busca churrasco")
+	srv.SendText(group, admin, "/config")
+	texts := waitSent(t, srv, 3)
+	if texts[1] != "nada encontrado, as mensagens só são salvas com o cask ligado no /config" {
+		t.Fatalf("want nothing found, got: %q", texts[1])
+	}
+
+	srv.Press(srv.Messages()[2], admin, "cfg:toggle:cask")
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want cask enabled")
+	}
+
+	for i := 1; i <= search.PageSize+1; i++ {
+		srv.SendText(group, member, fmt.Sprintf("Churrásco %d", i))
+	}
+	srv.SendText(group, admin, "churrasco também")
+	srv.SendText(group, admin, "/busca churrasco from:@membro")
+
+	texts = waitSent(t, srv, 4)
+	if !strings.HasPrefix(texts[3], "🔎 churrasco from:@membro\n6 mensagens, página 1/2\n\nmembro, ") ||
+		!strings.Contains(texts[3], "«Churrásco» 6") || strings.Contains(texts[3], "«Churrásco» 1") {
+		t.Fatalf("want the first page, got: %q", texts[3])
+	}
+
+	srv.Press(srv.Messages()[3], member, "busca:page:2")
+	ok = srv.WaitFor(func() bool {
+		// the first edit is of /config
+		return len(srv.Edits()) == 2
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want the second page")
+	}
+	edit := srv.Edits()[1]
+	if !strings.Contains(edit.Text, "página 2/2") || !strings.Contains(edit.Text, "«Churrásco» 1") {
+		t.Fatalf("want the second page, got: %q", edit.Text)
+	}
+	if buttons := edit.ReplyMarkup.InlineKeyboard[0]; len(buttons) != 1 || buttons[0].CallbackData != "busca:page:1" {
+		t.Fatalf("want only the previous page button, got: %+v", buttons)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	srv := newTestBot(t)
+
+	srv.SendText(group, admin, "/start")
+	srv.SendText(group, admin, "/resumo 1h")
+	srv.SendText(group, admin, "/config")
+	texts := waitSent(t, srv, 3)
+	if texts[1] != "o /resumo usa as mensagens salvas, ative o cask com /config" {
+		t.Fatalf("want the feature off, got: %q", texts[1])
+	}
+
+	srv.Press(srv.Messages()[2], admin, "cfg:toggle:cask")
+	ok := srv.WaitFor(func() bool {
+		return len(srv.CallbackAnswers()) == 1
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want cask enabled")
+	}
+
+	first := srv.SendText(group, member, "bora almoçar?")
+	srv.SendText(group, admin, "bora")
+	srv.SendText(group, admin, "/resumo")
+	srv.SendText(group, admin, "/resumo 72h")
+	srv.SendMessage(bot.Message{
+		Chat:           &group,
+		From:           &member,
+		Text:           "/resumo",
+		ReplyToMessage: &first,
+	})
+
+	texts = waitSent(t, srv, 6)
+	assertTexts(t, []string{
+		"use /resumo 6h, ou responda à mensagem de onde começar",
+		"o resumo vai até 2 dias atrás",
+		"Carregando...",
+	}, texts[3:])
+
+	ok = srv.WaitFor(func() bool {
+		// the first edit is of /config
+		return len(srv.Edits()) == 2
+	}, 2*time.Second)
+	if !ok {
+		t.Fatal("want the summary")
+	}
+	edit := srv.Edits()[1]
+	if edit.MessageID != srv.Messages()[5].MessageID || edit.Text != "📝 resumo de 2 mensagens:\n\nresponse from assistant" {
+		t.Fatalf("want the summary in the loading message, got: %+v", edit)
+	}
+}
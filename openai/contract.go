@@ -1,7 +1,16 @@
 package openai
 
+import (
+	"context"
+	"errors"
+)
+
 type Service interface {
-	Completion(params *CompletionParams) (*CompletionResponse, error)
+	Completion(ctx context.Context, params *CompletionParams) (*CompletionResponse, error)
+	// CompletionStream is like Completion, but calls onDelta with each piece
+	// of the content as it arrives. The response has the content received
+	// also when the stream fails midway.
+	CompletionStream(ctx context.Context, params *CompletionParams, onDelta func(delta string)) (*CompletionResponse, error)
 }
 
 type CompletionParams struct {
@@ -23,6 +32,9 @@ type Choice struct {
 	Message Message `json:"message"`
 }
 
+// ErrStreamEnded is when a stream ends before the completion is done
+var ErrStreamEnded = errors.New("completion stream ended early")
+
 type ErrRateLimit int
 
 func (err ErrRateLimit) Error() string {
@@ -1,11 +1,16 @@
 package openai
 
+import (
+	"context"
+	"strings"
+)
+
 var _ Service = ServiceDouble{}
 
 type ServiceDouble struct {
 }
 
-func (s ServiceDouble) Completion(params *CompletionParams) (*CompletionResponse, error) {
+func (s ServiceDouble) Completion(ctx context.Context, params *CompletionParams) (*CompletionResponse, error) {
 	return &CompletionResponse{
 		Choices: []Choice{
 			{
@@ -17,3 +22,17 @@ func (s ServiceDouble) Completion(params *CompletionParams) (*CompletionResponse
 		},
 	}, nil
 }
+
+// CompletionStream sends the content of Completion word by word.
+func (s ServiceDouble) CompletionStream(ctx context.Context, params *CompletionParams, onDelta func(delta string)) (*CompletionResponse, error) {
+	resp, err := s.Completion(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.SplitAfter(resp.Choices[0].Message.Content, " ")
+	for _, word := range words {
+		onDelta(word)
+	}
+	return resp, nil
+}
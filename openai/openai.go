@@ -1,9 +1,14 @@
 package openai
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,7 +34,83 @@ func NewService(key string, http *http.Client) Service {
 	}
 }
 
-func (s *service) Completion(params *CompletionParams) (*CompletionResponse, error) {
+func (s *service) Completion(ctx context.Context, params *CompletionParams) (*CompletionResponse, error) {
+	resp, err := s.request(ctx, params, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var completion CompletionResponse
+	err = json.NewDecoder(resp.Body).Decode(&completion)
+	return &completion, err
+}
+
+// streamChunk is each event of a stream
+type streamChunk struct {
+	Choices []struct {
+		Delta        Message `json:"delta"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *service) CompletionStream(ctx context.Context, params *CompletionParams, onDelta func(delta string)) (*CompletionResponse, error) {
+	resp, err := s.request(ctx, params, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	msg := Message{Role: "assistant"}
+	content := &strings.Builder{}
+	completion := func() *CompletionResponse {
+		msg.Content = content.String()
+		return &CompletionResponse{Choices: []Choice{{Message: msg}}}
+	}
+
+	// server-sent events, one "data: <chunk>" line each, until [DONE]
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return completion(), ErrStreamEnded
+		}
+		if err != nil && err != io.EOF {
+			return completion(), err
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return completion(), nil
+		}
+
+		var chunk streamChunk
+		err = json.Unmarshal([]byte(data), &chunk)
+		if err != nil {
+			return completion(), err
+		}
+		if chunk.Error != nil {
+			return completion(), errors.New("openai: " + chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+}
+
+// request posts the completion, returning the response if it's OK.
+func (s *service) request(ctx context.Context, params *CompletionParams, stream bool) (*http.Response, error) {
 	if params.Model == "" {
 		params.Model = "gpt-3.5-turbo"
 	}
@@ -49,6 +130,9 @@ func (s *service) Completion(params *CompletionParams) (*CompletionResponse, err
 		"messages":    params.Messages,
 		"temperature": params.Temperature,
 	}
+	if stream {
+		payload["stream"] = true
+	}
 
 	body := &bytes.Buffer{}
 	err := json.NewEncoder(body).Encode(payload)
@@ -56,7 +140,7 @@ func (s *service) Completion(params *CompletionParams) (*CompletionResponse, err
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", body)
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", body)
 	if err != nil {
 		return nil, err
 	}
@@ -67,16 +151,14 @@ func (s *service) Completion(params *CompletionParams) (*CompletionResponse, err
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode == 429 {
+		resp.Body.Close()
 		return nil, ErrRateLimit(30)
 	}
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		return nil, util.HTTPResponseError(resp)
 	}
-
-	var completion CompletionResponse
-	err = json.NewDecoder(resp.Body).Decode(&completion)
-	return &completion, err
+	return resp, nil
 }
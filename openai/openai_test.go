@@ -1,6 +1,7 @@
 package openai
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"strings"
@@ -38,7 +39,7 @@ func Test(t *testing.T) {
 
 	// Act
 
-	cmp, err := s.Completion(&CompletionParams{
+	cmp, err := s.Completion(context.Background(), &CompletionParams{
 		Messages: []Message{
 			{
 				Role:    "user",
@@ -63,3 +64,92 @@ func Test(t *testing.T) {
 		t.Fatalf("content - want: '%s', got: '%s'", wantContent, gotContent)
 	}
 }
+
+func streamService(t *testing.T, events string) Service {
+	t.Helper()
+
+	http := http.Client{
+		Transport: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), `"stream":true`) {
+				t.Errorf("want a stream requested, got: %s", body)
+			}
+
+			return &http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(strings.NewReader(events)),
+			}, nil
+		}),
+	}
+
+	return NewService("", &http)
+}
+
+func TestCompletionStream(t *testing.T) {
+	s := streamService(t, `data: {"choices":[{"delta":{"role":"assistant"}}]}
+
+data: {"choices":[{"delta":{"content":"hello"}}]}
+
+: keep alive
+
+data: {"choices":[{"delta":{"content":" there!"}}]}
+
+data: {"choices":[{"delta":{},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`)
+
+	var deltas []string
+	cmp, err := s.CompletionStream(context.Background(), &CompletionParams{
+		Messages: []Message{{Content: "hello"}},
+	}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deltas) != 2 || deltas[0] != "hello" || deltas[1] != " there!" {
+		t.Fatalf("deltas - want: [hello, there!], got: %q", deltas)
+	}
+	if got := cmp.Choices[0].Message; got.Role != "assistant" || got.Content != "hello there!" {
+		t.Fatalf("message - want the content, got: %+v", got)
+	}
+}
+
+func TestCompletionStreamErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		events string
+		want   string
+	}{
+		{
+			name:   "ended",
+			events: "data: {\"choices\":[{\"delta\":{\"content\":\"hel\"}}]}\n\n",
+			want:   ErrStreamEnded.Error(),
+		},
+		{
+			name:   "error event",
+			events: "data: {\"choices\":[{\"delta\":{\"content\":\"hel\"}}]}\n\ndata: {\"error\":{\"message\":\"overloaded\"}}\n\n",
+			want:   "openai: overloaded",
+		},
+	} {
+		s := streamService(t, tc.events)
+		cmp, err := s.CompletionStream(context.Background(), &CompletionParams{
+			Messages: []Message{{Content: "hello"}},
+		}, func(string) {})
+
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: want: %s, got: %v", tc.name, tc.want, err)
+			continue
+		}
+		// what arrived before is kept
+		if got := cmp.Choices[0].Message.Content; got != "hel" {
+			t.Errorf("%s: want the partial content, got: %q", tc.name, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/bot/bottest"
+	"github.com/igoracmelo/euperturbot/config"
+	"github.com/igoracmelo/euperturbot/controller"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the replay tests")
+
+// TestReplay feeds each testdata/replay/*.jsonl file of updates to the bot
+// and compares the calls it makes with the .golden file next to it. User 1
+// is the owner of the bot. Run with -update to accept new outputs.
+func TestReplay(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/replay/*.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		fixture := fixture
+		name := strings.TrimSuffix(filepath.Base(fixture), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			golden := strings.TrimSuffix(fixture, ".jsonl") + ".golden"
+			got := replay(t, fixture)
+
+			if *updateGolden {
+				err := os.WriteFile(golden, got, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, want, got)
+		})
+	}
+}
+
+// replay returns the calls made by the bot while handling the updates of
+// fixture, one JSON per line.
+func replay(t *testing.T, fixture string) []byte {
+	t.Helper()
+	ctx := context.Background()
+
+	f, err := os.Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	updates, err := bottest.ReadUpdates(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := bottest.NewServer()
+	defer srv.Close()
+
+	repo, err := sqliterepo.Open(ctx, ":memory:", "./repo/sqliterepo/migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	s := srv.Service()
+	me, err := s.GetMe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := controller.Controller{
+		Repo:    repo,
+		OpenAI:  openai.ServiceDouble{},
+		BotInfo: me,
+		Config:  &config.Config{GodID: 1},
+		Settings: settings.Service{
+			Repo:     repo,
+			Registry: settings.New(),
+		},
+	}
+
+	uh := bh.NewUpdateHandler(s, nil)
+	registerHandlers(uh, c, repo)
+
+	for _, u := range updates {
+		uh.HandleUpdate(ctx, u)
+	}
+
+	out := &bytes.Buffer{}
+	for _, req := range srv.Requests() {
+		if req.Method == "getMe" {
+			continue
+		}
+
+		// same bodies must give the same lines, whatever the field order
+		if req.Body != nil {
+			var body any
+			err = json.Unmarshal(req.Body, &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Body, err = json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		line, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+func assertGolden(t *testing.T, want []byte, got []byte) {
+	t.Helper()
+
+	wantLines := strings.Split(strings.TrimSpace(string(want)), "\n")
+	gotLines := strings.Split(strings.TrimSpace(string(got)), "\n")
+
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			t.Fatalf("call %d differs (run with -update to accept)\nwant: %s\ngot:  %s", i+1, w, g)
+		}
+	}
+}
@@ -3,50 +3,77 @@ package repo
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"time"
-
-	"github.com/jmoiron/sqlx"
 )
 
 type Repo interface {
-	DB() *sqlx.DB
 	Close() error
 	SaveChat(ctx context.Context, chat Chat) error
 	FindChat(ctx context.Context, chatID int64) (*Chat, error)
-	ChatEnables(ctx context.Context, chatID int64, action string) (bool, error)
-	ChatEnable(ctx context.Context, chatID int64, action string) error
-	ChatDisable(ctx context.Context, chatID int64, action string) error
+	SaveChatSetting(ctx context.Context, chatID int64, key string, value string) error
+	FindChatSetting(ctx context.Context, chatID int64, key string) (string, error)
+	FindChatSettings(ctx context.Context, chatID int64) (map[string]string, error)
+	DeleteChatSetting(ctx context.Context, chatID int64, key string) error
+	MigrateChat(ctx context.Context, fromID int64, toID int64) error
 	SaveMessage(ctx context.Context, msg Message) error
 	FindMessage(ctx context.Context, chatID int64, msgID int) (Message, error)
 	FindMessagesBeforeDate(ctx context.Context, chatID int64, date time.Time, count int) ([]Message, error)
 	FindMessageThread(ctx context.Context, chatID int64, msgID int) ([]Message, error)
-	SaveUser(u User) error
-	FindUser(id int64) (*User, error)
-	ExistsChatTopic(chatID int64, topic string) (bool, error)
-	SaveUserTopic(topic UserTopic) error
-	DeleteUserTopic(topic UserTopic) (int64, error)
-	FindUserChatTopics(chatID, userID int64) ([]UserTopic, error)
-	FindChatTopics(chatID int64) ([]UserTopic, error)
-	FindUsersByTopic(chatID int64, topic string) ([]User, error)
-	SavePoll(p Poll) error
-	FindPollByMessage(msgID int) (*Poll, error)
-	SavePollVote(v PollVote) error
-	DeletePollVote(pollID string, userID int64) error
-	FindPollVote(pollID string, userID int64) (*PollVote, error)
-	SaveVoice(v Voice) error
-	FindRandomVoice(chatID int64) (*Voice, error)
+	FindMessagesSince(ctx context.Context, chatID int64, since time.Time, count int) ([]Message, error)
+	SearchMessages(ctx context.Context, q MessageSearch) ([]MessageResult, int, error)
+	SaveMessageEdit(ctx context.Context, msg Message, editDate time.Time) error
+	FindMessageRevisions(ctx context.Context, chatID int64, msgID int) ([]MessageRevision, error)
+	SaveMessageTopics(ctx context.Context, chatID int64, msgID int, topics []string) error
+	FindMessageTopics(ctx context.Context, chatID int64, msgID int) ([]string, error)
+	SaveSummary(ctx context.Context, sum Summary) error
+	FindSummary(ctx context.Context, key SummaryKey) (*Summary, error)
+	DeleteSummariesBefore(ctx context.Context, t time.Time) error
+	SaveUser(ctx context.Context, u User) error
+	FindUser(ctx context.Context, id int64) (*User, error)
+	ExistsChatTopic(ctx context.Context, chatID int64, topic string) (bool, error)
+	SaveUserTopic(ctx context.Context, topic UserTopic) error
+	DeleteUserTopic(ctx context.Context, topic UserTopic) (int64, error)
+	FindUserChatTopics(ctx context.Context, chatID, userID int64) ([]UserTopic, error)
+	FindChatTopics(ctx context.Context, chatID int64) ([]UserTopic, error)
+	FindUsersByTopic(ctx context.Context, chatID int64, topic string) ([]User, error)
+	FindUsersByTopics(ctx context.Context, chatID int64, topics []string) ([]User, error)
+	SaveScheduledTopic(ctx context.Context, st ScheduledTopic) (int64, error)
+	UpdateScheduledTopic(ctx context.Context, st ScheduledTopic) error
+	FindScheduledTopic(ctx context.Context, id int64) (*ScheduledTopic, error)
+	FindChatScheduledTopics(ctx context.Context, chatID int64) ([]ScheduledTopic, error)
+	FindDueScheduledTopics(ctx context.Context, now time.Time) ([]ScheduledTopic, error)
+	SaveEvent(ctx context.Context, e Event) (int64, error)
+	UpdateEvent(ctx context.Context, e Event) error
+	FindEvent(ctx context.Context, id int64) (*Event, error)
+	FindDueEvents(ctx context.Context, now time.Time) ([]Event, error)
+	SaveEventAnswer(ctx context.Context, a EventAnswer) error
+	DeleteEventAnswer(ctx context.Context, eventID int64, userID int64) error
+	FindEventAnswers(ctx context.Context, eventID int64) ([]EventAnswer, error)
+	SaveCount(ctx context.Context, c Count) (int64, error)
+	DeleteCount(ctx context.Context, id int64) error
+	FindLastCount(ctx context.Context, chatID int64, userID int64, name string) (*Count, error)
+	FindChatCountTotals(ctx context.Context, chatID int64) ([]CountTotal, error)
+	FindUserCounts(ctx context.Context, chatID int64, name string) ([]UserCount, error)
+	FindCountTimes(ctx context.Context, chatID int64, name string, since time.Time) ([]time.Time, error)
+	SavePoll(ctx context.Context, p Poll) error
+	FindPollByMessage(ctx context.Context, msgID int) (*Poll, error)
+	SavePollVote(ctx context.Context, v PollVote) error
+	DeletePollVote(ctx context.Context, pollID string, userID int64) error
+	FindPollVote(ctx context.Context, pollID string, userID int64) (*PollVote, error)
+	SaveVoice(ctx context.Context, v Voice) error
+	FindRandomVoice(ctx context.Context, chatID int64) (*Voice, error)
+	SaveDialog(ctx context.Context, d Dialog) error
+	FindDialog(ctx context.Context, chatID int64, userID int64) (*Dialog, error)
+	DeleteDialog(ctx context.Context, chatID int64, userID int64) error
 }
 
 var (
-	ErrChatActionNotAllowed = errors.New("chat action not allowed")
-	ErrNotFound             = sql.ErrNoRows // FIXME
+	ErrNotFound = sql.ErrNoRows // FIXME
 )
 
 type Chat struct {
-	ID         int64
-	Title      string
-	EnableCAsk bool
+	ID    int64
+	Title string
 }
 
 type Message struct {
@@ -59,6 +86,110 @@ type Message struct {
 	ReplyToMessageID int    `db:"reply_to_message_id"`
 }
 
+// MessageSearch finds the messages of ChatID matching all the filters
+// set, the newest first.
+type MessageSearch struct {
+	ChatID int64
+	// Match is a full-text query of SQLite FTS5
+	Match string
+	// UserName of the sender, in any case
+	UserName string
+	// After and Before limit the date of the messages, when not zero. After
+	// is inclusive.
+	After  time.Time
+	Before time.Time
+	Offset int
+	Limit  int
+}
+
+// MessageResult of a MessageSearch, with the text around the match.
+type MessageResult struct {
+	Message
+	Snippet string
+}
+
+// SummaryKey tells the messages a Summary is of: Messages of ChatID, from
+// FirstMessageID to LastMessageID.
+type SummaryKey struct {
+	ChatID         int64 `db:"chat_id"`
+	FirstMessageID int   `db:"first_message_id"`
+	LastMessageID  int   `db:"last_message_id"`
+	Messages       int   `db:"message_count"`
+}
+
+// Summary is the Text /resumo wrote of the messages of the SummaryKey.
+type Summary struct {
+	SummaryKey
+	Text      string
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// MessageRevision is a Text an edited message had since Date.
+type MessageRevision struct {
+	ChatID    int64 `db:"chat_id"`
+	MessageID int   `db:"message_id"`
+	Text      string
+	Date      time.Time
+}
+
+// Event of a Topic at Time, which users answer if they go. When
+// Capacity is set, the ones going after it is full are in a waitlist.
+type Event struct {
+	ID          int64
+	ChatID      int64
+	UserID      int64
+	Topic       string
+	Description string
+	Time        time.Time
+	Capacity    int
+	// MessageID has the answers, 0 until sent
+	MessageID int
+	Status    string
+	// NextReminder to the ones going, zero for none
+	NextReminder time.Time
+}
+
+const (
+	EventOpen   = "open"
+	EventClosed = "closed"
+)
+
+// EventAnswer of User to an event, in the order they answered.
+type EventAnswer struct {
+	EventID int64
+	User    User
+	Answer  string
+}
+
+const (
+	AnswerYes   = "yes"
+	AnswerMaybe = "maybe"
+	AnswerNo    = "no"
+)
+
+// Count is one increment of the counter Name of a chat, made by the
+// message MessageID.
+type Count struct {
+	ID        int64
+	ChatID    int64
+	UserID    int64
+	Name      string
+	MessageID int
+	Time      time.Time
+}
+
+// CountTotal is how many times Name was counted.
+type CountTotal struct {
+	Name  string
+	Total int
+}
+
+// UserCount is how many times User counted a counter.
+type UserCount struct {
+	User  User
+	Total int
+}
+
 type Poll struct {
 	ID              string
 	ChatID          int64 `db:"chat_id"`
@@ -98,8 +229,44 @@ type UserTopic struct {
 	Subscribers int
 }
 
+// ScheduledTopic is a mention of the subscribers of Topic, due at Time.
+// When Rule is set, Time moves to the next mention after each one.
+type ScheduledTopic struct {
+	ID        int64
+	ChatID    int64
+	MessageID int
+	UserID    int64
+	Topic     string
+	Rule      string
+	Status    string
+	Time      time.Time
+	// Attempts to send the mention at Time that failed, with the error of
+	// the last one
+	Attempts  int
+	LastError string
+}
+
+const (
+	ScheduledCreated   = "created"
+	ScheduledFailed    = "failed"
+	ScheduledCompleted = "completed"
+	ScheduledCanceled  = "canceled"
+)
+
 type Voice struct {
 	FileID string `db:"file_id"`
 	UserID int64  `db:"user_id"`
 	ChatID int64  `db:"chat_id"`
 }
+
+// Dialog is a conversation in progress with a user, see bothandler.Dialogs.
+type Dialog struct {
+	ChatID    int64
+	UserID    int64
+	MessageID int
+	PromptID  int
+	Name      string
+	Step      string
+	Data      map[string]string
+	ExpiresAt time.Time
+}
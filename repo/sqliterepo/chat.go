@@ -4,100 +4,120 @@ import (
 	"context"
 
 	"github.com/igoracmelo/euperturbot/repo"
-	"github.com/igoracmelo/euperturbot/util"
 )
 
-type rawChat struct {
-	ID         int64  `db:"id"`
-	Title      string `db:"title"`
-	EnableCAsk int    `db:"enable_cask"`
-}
-
 func (db sqliteRepo) SaveChat(ctx context.Context, chat repo.Chat) error {
-	rawChat := rawChat{
-		ID:         chat.ID,
-		Title:      chat.Title,
-		EnableCAsk: util.BoolToInt(chat.EnableCAsk),
-	}
-
-	_, err := db.db.NamedExecContext(ctx, `
-		INSERT INTO chat (
-			id,
-			title,
-			enable_cask
-		) VALUES (
-			:id,
-			:title,
-			:enable_cask
-		)
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO chat (id, title)
+		VALUES ($1, $2)
 		ON CONFLICT DO UPDATE
-		SET
-			title           = :title,
-			enable_cask     = :enable_cask
-	`, rawChat)
+		SET title = $2
+	`, chat.ID, chat.Title)
 
 	return err
 }
 
 func (db sqliteRepo) FindChat(ctx context.Context, chatID int64) (*repo.Chat, error) {
-	var c rawChat
-
+	var c repo.Chat
 	err := db.db.GetContext(ctx, &c, `
-		SELECT * FROM chat
+		SELECT id, title FROM chat
 		WHERE id = $1
 	`, chatID)
+	return &c, err
+}
 
-	return &repo.Chat{
-		ID:         c.ID,
-		Title:      c.Title,
-		EnableCAsk: c.EnableCAsk == 1,
-	}, err
+func (db sqliteRepo) SaveChatSetting(ctx context.Context, chatID int64, key string, value string) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO chat_setting (chat_id, key, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO UPDATE
+		SET value = $3
+	`, chatID, key, value)
+	return err
 }
 
-func (db sqliteRepo) ChatEnables(ctx context.Context, chatID int64, action string) (bool, error) {
-	var iAllow int
-	err := db.db.GetContext(ctx, &iAllow, `SELECT enable_`+action+` FROM chat WHERE id = $1`, chatID)
-	return iAllow == 1, err
+func (db sqliteRepo) FindChatSetting(ctx context.Context, chatID int64, key string) (string, error) {
+	var value string
+	err := db.db.GetContext(ctx, &value, `
+		SELECT value FROM chat_setting
+		WHERE chat_id = $1 AND key = $2
+	`, chatID, key)
+	return value, err
 }
 
-func (db sqliteRepo) ChatEnable(ctx context.Context, chatID int64, action string) error {
-	res, err := db.db.ExecContext(ctx, `
-		UPDATE chat
-		SET enable_`+action+` = 1
-		WHERE id = $1
+func (db sqliteRepo) DeleteChatSetting(ctx context.Context, chatID int64, key string) error {
+	_, err := db.db.ExecContext(ctx, `
+		DELETE FROM chat_setting
+		WHERE chat_id = $1 AND key = $2
+	`, chatID, key)
+	return err
+}
+
+// FindChatSettings returns the settings of the chat by key. Settings never
+// changed are not there.
+func (db sqliteRepo) FindChatSettings(ctx context.Context, chatID int64) (map[string]string, error) {
+	rows, err := db.db.QueryContext(ctx, `
+		SELECT key, value FROM chat_setting
+		WHERE chat_id = $1
 	`, chatID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		settings[key] = value
 	}
+	return settings, rows.Err()
+}
 
-	n, err := res.RowsAffected()
+// MigrateChat moves everything stored for the chat fromID to toID, as
+// happens when a group is upgraded to a supergroup.
+func (db sqliteRepo) MigrateChat(ctx context.Context, fromID int64, toID int64) error {
+	tx, err := db.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if n == 0 {
-		return repo.ErrNotFound
-	}
-	return err
-}
-
-func (db sqliteRepo) ChatDisable(ctx context.Context, chatID int64, action string) error {
-	res, err := db.db.ExecContext(ctx, `
-		UPDATE chat
-		SET enable_`+action+` = 0
+	_, err = tx.ExecContext(ctx, `
+		UPDATE OR REPLACE chat
+		SET id = $2
 		WHERE id = $1
-	`, chatID)
+	`, fromID, toID)
 	if err != nil {
 		return err
 	}
 
-	n, err := res.RowsAffected()
+	// the messages replaced below wouldn't leave the search index, as
+	// REPLACE doesn't fire the delete triggers
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM message
+		WHERE chat_id = $2 AND id IN (
+			SELECT id FROM message WHERE chat_id = $1
+		)
+	`, fromID, toID)
 	if err != nil {
 		return err
 	}
 
-	if n == 0 {
-		return repo.ErrNotFound
+	tables := []string{"user_topic", "message", "poll", "voice", "scheduled_topic", "event", "dialog", "chat_setting", "topic_event", "message_revision", "message_topic", "chat_summary"}
+	for _, table := range tables {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE OR REPLACE `+table+`
+			SET chat_id = $2
+			WHERE chat_id = $1
+		`, fromID, toID)
+		if err != nil {
+			return err
+		}
 	}
-	return err
+
+	return tx.Commit()
 }
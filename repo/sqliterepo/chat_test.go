@@ -0,0 +1,154 @@
+package sqliterepo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestMigrateChat(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	const oldID, newID = -1, -1001
+
+	err := db.SaveChat(context.TODO(), repo.Chat{ID: oldID, Title: "group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SaveUserTopic(context.TODO(), repo.UserTopic{ChatID: oldID, UserID: 1, Topic: "#topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.MigrateChat(context.TODO(), oldID, newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.FindChat(context.TODO(), oldID)
+	if err != repo.ErrNotFound {
+		t.Fatalf("old chat - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	chat, err := db.FindChat(context.TODO(), newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat.Title != "group" {
+		t.Fatalf("title - want: %s, got: %s", "group", chat.Title)
+	}
+
+	exists, err := db.ExistsChatTopic(context.TODO(), newID, "#topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("want topic to be moved to the new chat")
+	}
+}
+
+func TestMigrateChatSearchIndex(t *testing.T) {
+	_db := newDB(t)
+	defer _db.Close()
+	db := _db.(*sqliteRepo)
+
+	const oldID, newID = -1, -1001
+
+	// the same message saved for both chats
+	for chatID, text := range map[int64]string{oldID: "texto novo", newID: "texto velho"} {
+		err := db.SaveMessage(context.TODO(), repo.Message{ID: 1, ChatID: chatID, Text: text, Date: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := db.MigrateChat(context.TODO(), oldID, newID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matches int
+	err = db.db.Get(&matches, `SELECT COUNT(*) FROM message_fts WHERE message_fts MATCH 'velho'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matches != 0 {
+		t.Fatalf("want the replaced message out of the index, got %d matches", matches)
+	}
+
+	_, err = db.db.Exec(`INSERT INTO message_fts (message_fts, rank) VALUES ('integrity-check', 1)`)
+	if err != nil {
+		t.Fatalf("want the index matching the messages, got: %v", err)
+	}
+}
+
+// openMigratedTo opens a database with the migrations up to n, to be
+// migrated after some old rows are inserted.
+func openMigratedTo(t *testing.T, n int) *sqliteRepo {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i := 1; i <= n; i++ {
+		name := fmt.Sprintf("%d.sql", i)
+		b, err := os.ReadFile(filepath.Join("migrations", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Open(context.TODO(), ":memory:", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+	})
+	return r.(*sqliteRepo)
+}
+
+func TestMigrateChatSwitches(t *testing.T) {
+	ctx := context.TODO()
+
+	// every migration before the switches became chat_setting rows
+	db := openMigratedTo(t, 13)
+
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO chat (id, title, enable_cask, enable_audio, enable_sed)
+		VALUES (-1, 'group', 1, 0, 1)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrate(ctx, "./migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := db.FindChatSettings(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 2 || settings["cask"] != "true" || settings["sed"] != "true" {
+		t.Fatalf("want cask and sed enabled, got: %v", settings)
+	}
+
+	chat, err := db.FindChat(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat.Title != "group" {
+		t.Fatalf("title - want: %s, got: %s", "group", chat.Title)
+	}
+}
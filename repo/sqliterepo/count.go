@@ -0,0 +1,134 @@
+package sqliterepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// the time of event is a TIMESTAMP, which the driver reads as time.Time
+type rawCount struct {
+	ID        int64     `db:"id"`
+	ChatID    int64     `db:"chat_id"`
+	UserID    int64     `db:"user_id"`
+	Name      string    `db:"name"`
+	MessageID int       `db:"msg_id"`
+	Time      time.Time `db:"time"`
+}
+
+func (raw rawCount) count() repo.Count {
+	return repo.Count{
+		ID:        raw.ID,
+		ChatID:    raw.ChatID,
+		UserID:    raw.UserID,
+		Name:      raw.Name,
+		MessageID: raw.MessageID,
+		Time:      raw.Time.UTC(),
+	}
+}
+
+func (db *sqliteRepo) SaveCount(ctx context.Context, c repo.Count) (int64, error) {
+	res, err := db.db.ExecContext(ctx, `
+		INSERT INTO event
+		(chat_id, user_id, name, msg_id, time)
+		VALUES ($1, $2, $3, $4, $5)
+	`, c.ChatID, c.UserID, c.Name, c.MessageID, c.Time.UTC().Format(timeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (db *sqliteRepo) DeleteCount(ctx context.Context, id int64) error {
+	res, err := db.db.ExecContext(ctx, `
+		DELETE FROM event
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repo.ErrNotFound
+	}
+	return nil
+}
+
+// FindLastCount finds the last count of the user in the chat, of any
+// counter if name is empty.
+func (db *sqliteRepo) FindLastCount(ctx context.Context, chatID int64, userID int64, name string) (*repo.Count, error) {
+	var raw rawCount
+	err := db.db.GetContext(ctx, &raw, `
+		SELECT id, chat_id, user_id, name, msg_id, time FROM event
+		WHERE chat_id = $1 AND user_id = $2 AND ($3 = '' OR name = $3)
+		ORDER BY id DESC
+		LIMIT 1
+	`, chatID, userID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c := raw.count()
+	return &c, nil
+}
+
+// FindChatCountTotals finds the counters of the chat, the most counted
+// first.
+func (db *sqliteRepo) FindChatCountTotals(ctx context.Context, chatID int64) ([]repo.CountTotal, error) {
+	var totals []repo.CountTotal
+	err := db.db.SelectContext(ctx, &totals, `
+		SELECT name, COUNT(*) AS total FROM event
+		WHERE chat_id = $1
+		GROUP BY name
+		ORDER BY total DESC, name
+	`, chatID)
+	return totals, err
+}
+
+// FindUserCounts finds how many times each user counted name in the chat,
+// the ones that counted the most first.
+func (db *sqliteRepo) FindUserCounts(ctx context.Context, chatID int64, name string) ([]repo.UserCount, error) {
+	var rows []struct {
+		Total int `db:"total"`
+		repo.User
+	}
+	// users that were never saved still count, without a name
+	err := db.db.SelectContext(ctx, &rows, `
+		SELECT
+			e.user_id AS id,
+			COALESCE(u.username, '') AS username,
+			COALESCE(u.first_name, '') AS first_name,
+			COUNT(*) AS total
+		FROM event e
+		LEFT JOIN user u ON u.id = e.user_id
+		WHERE e.chat_id = $1 AND e.name = $2
+		GROUP BY e.user_id
+		ORDER BY total DESC, MIN(e.id)
+	`, chatID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]repo.UserCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, repo.UserCount{User: row.User, Total: row.Total})
+	}
+	return counts, nil
+}
+
+// FindCountTimes finds when name was counted in the chat since since,
+// oldest first.
+func (db *sqliteRepo) FindCountTimes(ctx context.Context, chatID int64, name string, since time.Time) ([]time.Time, error) {
+	var times []time.Time
+	err := db.db.SelectContext(ctx, &times, `
+		SELECT time FROM event
+		WHERE chat_id = $1 AND name = $2 AND datetime(time) >= datetime($3)
+		ORDER BY time
+	`, chatID, name, since.UTC().Format(timeLayout))
+	return times, err
+}
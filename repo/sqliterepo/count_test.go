@@ -0,0 +1,94 @@
+package sqliterepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestCounts(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	t.Cleanup(func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	alice := repo.User{ID: 1, Username: "alice"}
+	err := db.SaveUser(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	for i, c := range []repo.Count{
+		{ChatID: -1, UserID: 1, Name: "cafe", Time: at},
+		// bob was never saved
+		{ChatID: -1, UserID: 2, Name: "cafe", Time: at.Add(time.Hour)},
+		{ChatID: -1, UserID: 2, Name: "cafe", Time: at.Add(2 * time.Hour)},
+		{ChatID: -1, UserID: 1, Name: "pao", Time: at.Add(3 * time.Hour)},
+		// other chat
+		{ChatID: -2, UserID: 1, Name: "cafe", Time: at},
+	} {
+		c.MessageID = i + 1
+		_, err = db.SaveCount(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last, err := db.FindLastCount(ctx, -1, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := repo.Count{ID: 4, ChatID: -1, UserID: 1, Name: "pao", MessageID: 4, Time: at.Add(3 * time.Hour)}
+	if *last != want {
+		t.Fatalf("want: %+v, got: %+v", want, *last)
+	}
+	last, err = db.FindLastCount(ctx, -1, 1, "cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.ID != 1 {
+		t.Fatalf("want the count of cafe, got: %+v", *last)
+	}
+
+	totals, err := db.FindChatCountTotals(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTotals := []repo.CountTotal{{Name: "cafe", Total: 3}, {Name: "pao", Total: 1}}
+	if len(totals) != 2 || totals[0] != wantTotals[0] || totals[1] != wantTotals[1] {
+		t.Fatalf("want: %+v, got: %+v", wantTotals, totals)
+	}
+
+	users, err := db.FindUserCounts(ctx, -1, "cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUsers := []repo.UserCount{{User: repo.User{ID: 2}, Total: 2}, {User: alice, Total: 1}}
+	if len(users) != 2 || users[0] != wantUsers[0] || users[1] != wantUsers[1] {
+		t.Fatalf("want: %+v, got: %+v", wantUsers, users)
+	}
+
+	times, err := db.FindCountTimes(ctx, -1, "cafe", at.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 || !times[0].Equal(at.Add(time.Hour)) || !times[1].Equal(at.Add(2*time.Hour)) {
+		t.Fatalf("want the last 2 times, got: %v", times)
+	}
+
+	err = db.DeleteCount(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.DeleteCount(ctx, 4)
+	if err != repo.ErrNotFound {
+		t.Fatalf("err - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+}
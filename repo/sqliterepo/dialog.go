@@ -0,0 +1,99 @@
+package sqliterepo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+type rawDialog struct {
+	ChatID    int64     `db:"chat_id"`
+	UserID    int64     `db:"user_id"`
+	MessageID int       `db:"message_id"`
+	PromptID  int       `db:"prompt_id"`
+	Name      string    `db:"name"`
+	Step      string    `db:"step"`
+	Data      string    `db:"data"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func (db *sqliteRepo) SaveDialog(ctx context.Context, d repo.Dialog) error {
+	data, err := json.Marshal(d.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.db.NamedExecContext(ctx, `
+		INSERT INTO dialog (
+			chat_id,
+			user_id,
+			message_id,
+			prompt_id,
+			name,
+			step,
+			data,
+			expires_at
+		) VALUES (
+			:chat_id,
+			:user_id,
+			:message_id,
+			:prompt_id,
+			:name,
+			:step,
+			:data,
+			:expires_at
+		)
+		ON CONFLICT DO UPDATE
+		SET
+			message_id = :message_id,
+			prompt_id  = :prompt_id,
+			name       = :name,
+			step       = :step,
+			data       = :data,
+			expires_at = :expires_at
+	`, rawDialog{
+		ChatID:    d.ChatID,
+		UserID:    d.UserID,
+		MessageID: d.MessageID,
+		PromptID:  d.PromptID,
+		Name:      d.Name,
+		Step:      d.Step,
+		Data:      string(data),
+		ExpiresAt: d.ExpiresAt.UTC(),
+	})
+	return err
+}
+
+func (db *sqliteRepo) FindDialog(ctx context.Context, chatID int64, userID int64) (*repo.Dialog, error) {
+	var raw rawDialog
+	err := db.db.GetContext(ctx, &raw, `
+		SELECT chat_id, user_id, message_id, prompt_id, name, step, data, expires_at
+		FROM dialog
+		WHERE chat_id = $1 AND user_id = $2
+	`, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &repo.Dialog{
+		ChatID:    raw.ChatID,
+		UserID:    raw.UserID,
+		MessageID: raw.MessageID,
+		PromptID:  raw.PromptID,
+		Name:      raw.Name,
+		Step:      raw.Step,
+		ExpiresAt: raw.ExpiresAt,
+	}
+	err = json.Unmarshal([]byte(raw.Data), &d.Data)
+	return d, err
+}
+
+func (db *sqliteRepo) DeleteDialog(ctx context.Context, chatID int64, userID int64) error {
+	_, err := db.db.ExecContext(ctx, `
+		DELETE FROM dialog
+		WHERE chat_id = $1 AND user_id = $2
+	`, chatID, userID)
+	return err
+}
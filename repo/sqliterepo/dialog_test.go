@@ -0,0 +1,57 @@
+package sqliterepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestDialog(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	want := repo.Dialog{
+		ChatID:    -1,
+		UserID:    2,
+		MessageID: 3,
+		PromptID:  4,
+		Name:      "agenda",
+		Step:      "topico",
+		Data:      map[string]string{"topico": "#futebol"},
+		ExpiresAt: time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	err := db.SaveDialog(context.TODO(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want.Step = "duracao"
+	err = db.SaveDialog(context.TODO(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindDialog(context.TODO(), -1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Step != "duracao" || got.MessageID != 3 || got.PromptID != 4 || got.Data["topico"] != "#futebol" {
+		t.Fatalf("want: %+v, got: %+v", want, got)
+	}
+	if !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Fatalf("expires at - want: %s, got: %s", want.ExpiresAt, got.ExpiresAt)
+	}
+
+	err = db.DeleteDialog(context.TODO(), -1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.FindDialog(context.TODO(), -1, 2)
+	if err != repo.ErrNotFound {
+		t.Fatalf("want: %v, got: %v", repo.ErrNotFound, err)
+	}
+}
@@ -4,15 +4,29 @@ import (
 	"context"
 	"time"
 
+	"github.com/jmoiron/sqlx"
+
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
-func (db *sqliteRepo) SaveMessage(ctx context.Context, msg repo.Message) error {
-	if len(msg.Text) > 500 {
-		msg.Text = msg.Text[:497] + "..."
+// maxMessageText is how much of the text of a message is kept
+const maxMessageText = 500
+
+func truncateText(text string) string {
+	if len(text) > maxMessageText {
+		return text[:maxMessageText-3] + "..."
 	}
+	return text
+}
 
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) SaveMessage(ctx context.Context, msg repo.Message) error {
+	return saveMessage(ctx, db.db, msg)
+}
+
+func saveMessage(ctx context.Context, db sqlx.ExecerContext, msg repo.Message) error {
+	msg.Text = truncateText(msg.Text)
+
+	_, err := db.ExecContext(ctx, `
 		INSERT INTO message (
 			id,
 			chat_id,
@@ -27,7 +41,8 @@ func (db *sqliteRepo) SaveMessage(ctx context.Context, msg repo.Message) error {
 	`,
 		msg.ID,
 		msg.ChatID,
-		msg.Date,
+		// in UTC and in timeLayout, so that the dates compare as text
+		msg.Date.UTC().Format(timeLayout),
 		msg.Text,
 		msg.UserID,
 		msg.UserName,
@@ -47,7 +62,7 @@ func (db *sqliteRepo) FindMessage(ctx context.Context, chatID int64, msgID int)
 
 func (db *sqliteRepo) FindMessagesBeforeDate(ctx context.Context, chatID int64, date time.Time, count int) ([]repo.Message, error) {
 	msgs := []repo.Message{}
-	err := db.db.SelectContext(context.TODO(), &msgs, `
+	err := db.db.SelectContext(ctx, &msgs, `
 	 	SELECT * FROM (
 			SELECT *
 			FROM message
@@ -58,7 +73,27 @@ func (db *sqliteRepo) FindMessagesBeforeDate(ctx context.Context, chatID int64,
 			LIMIT $3
 		)
 		ORDER BY date ASC
-	`, chatID, date, count)
+	`, chatID, date.UTC().Format(timeLayout), count)
+
+	return msgs, err
+}
+
+// FindMessagesSince returns the last count messages of chatID from since
+// on, oldest first.
+func (db *sqliteRepo) FindMessagesSince(ctx context.Context, chatID int64, since time.Time, count int) ([]repo.Message, error) {
+	msgs := []repo.Message{}
+	err := db.db.SelectContext(ctx, &msgs, `
+		SELECT * FROM (
+			SELECT *
+			FROM message
+			WHERE
+				chat_id = $1 AND
+				date >= $2
+			ORDER BY date DESC, id DESC
+			LIMIT $3
+		)
+		ORDER BY date ASC, id ASC
+	`, chatID, since.UTC().Format(timeLayout), count)
 
 	return msgs, err
 }
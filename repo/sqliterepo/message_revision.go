@@ -0,0 +1,111 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveMessageEdit changes the text of the message to the one of msg,
+// edited at editDate, keeping the texts it had in its revisions. The first
+// edit keeps the original text too. A message not saved before is saved
+// with the edited text as its first revision.
+func (db *sqliteRepo) SaveMessageEdit(ctx context.Context, msg repo.Message, editDate time.Time) error {
+	msg.Text = truncateText(msg.Text)
+
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current repo.Message
+	err = tx.GetContext(ctx, &current, `
+		SELECT * FROM message
+		WHERE chat_id = $1 AND id = $2
+	`, msg.ChatID, msg.ID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = saveMessage(ctx, tx, msg)
+	case err != nil:
+		return err
+	case current.Text == msg.Text:
+		// just the media or the formatting changed
+		return nil
+	default:
+		err = saveOriginal(ctx, tx, current)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE message
+			SET text = $3
+			WHERE chat_id = $1 AND id = $2
+		`, msg.ChatID, msg.ID, msg.Text)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO message_revision (chat_id, message_id, text, date)
+		VALUES ($1, $2, $3, $4)
+	`, msg.ChatID, msg.ID, msg.Text, editDate)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveOriginal saves msg as its first revision, if it has none
+func saveOriginal(ctx context.Context, db sqlx.ExecerContext, msg repo.Message) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO message_revision (chat_id, message_id, text, date)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM message_revision
+			WHERE chat_id = $1 AND message_id = $2
+		)
+	`, msg.ChatID, msg.ID, msg.Text, msg.Date)
+	return err
+}
+
+// FindMessageRevisions finds the texts the message had, the original
+// first. Messages never edited have none.
+func (db *sqliteRepo) FindMessageRevisions(ctx context.Context, chatID int64, msgID int) ([]repo.MessageRevision, error) {
+	var revisions []repo.MessageRevision
+	err := db.db.SelectContext(ctx, &revisions, `
+		SELECT chat_id, message_id, text, date FROM message_revision
+		WHERE chat_id = $1 AND message_id = $2
+		ORDER BY id
+	`, chatID, msgID)
+	return revisions, err
+}
+
+func (db *sqliteRepo) SaveMessageTopics(ctx context.Context, chatID int64, msgID int, topics []string) error {
+	for _, topic := range topics {
+		_, err := db.db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO message_topic (chat_id, message_id, topic)
+			VALUES ($1, $2, $3)
+		`, chatID, msgID, topic)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *sqliteRepo) FindMessageTopics(ctx context.Context, chatID int64, msgID int) ([]string, error) {
+	var topics []string
+	err := db.db.SelectContext(ctx, &topics, `
+		SELECT topic FROM message_topic
+		WHERE chat_id = $1 AND message_id = $2
+		ORDER BY topic
+	`, chatID, msgID)
+	return topics, err
+}
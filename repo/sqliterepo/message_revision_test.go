@@ -0,0 +1,104 @@
+package sqliterepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestSaveMessageEdit(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	defer db.Close()
+
+	sent := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	msg := repo.Message{ID: 1, ChatID: -1, Text: "bom dia", Date: sent, UserID: 1, UserName: "alice"}
+	err := db.SaveMessage(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, text := range []string{"bom dia!", "bom dia!", "boa tarde"} {
+		msg.Text = text
+		err = db.SaveMessageEdit(ctx, msg, sent.Add(time.Duration(i+1)*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := db.FindMessage(ctx, -1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "boa tarde" || !got.Date.Equal(sent) {
+		t.Fatalf("want the last text sent at %s, got: %+v", sent, got)
+	}
+
+	revisions, err := db.FindMessageRevisions(ctx, -1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same text again is no revision
+	want := []repo.MessageRevision{
+		{ChatID: -1, MessageID: 1, Text: "bom dia", Date: sent},
+		{ChatID: -1, MessageID: 1, Text: "bom dia!", Date: sent.Add(time.Minute)},
+		{ChatID: -1, MessageID: 1, Text: "boa tarde", Date: sent.Add(3 * time.Minute)},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("want: %+v, got: %+v", want, revisions)
+	}
+	for i := range want {
+		if revisions[i].Text != want[i].Text || !revisions[i].Date.Equal(want[i].Date) {
+			t.Fatalf("want: %+v, got: %+v", want, revisions)
+		}
+	}
+
+	// not saved before
+	err = db.SaveMessageEdit(ctx, repo.Message{ID: 2, ChatID: -1, Text: "oi", Date: sent, UserID: 1}, sent.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.FindMessage(ctx, -1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "oi" {
+		t.Fatalf("want the edited message saved, got: %+v", got)
+	}
+	revisions, err = db.FindMessageRevisions(ctx, -1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Text != "oi" {
+		t.Fatalf("want just the edited text, got: %+v", revisions)
+	}
+}
+
+func TestMessageTopics(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	defer db.Close()
+
+	err := db.SaveMessageTopics(ctx, -1, 1, []string{"#futebol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveMessageTopics(ctx, -1, 1, []string{"#futebol", "#churras"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SaveMessageTopics(ctx, -1, 2, []string{"#volei"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topics, err := db.FindMessageTopics(ctx, -1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 || topics[0] != "#churras" || topics[1] != "#futebol" {
+		t.Fatalf("want #churras and #futebol, got: %v", topics)
+	}
+}
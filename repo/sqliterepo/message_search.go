@@ -0,0 +1,53 @@
+package sqliterepo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+// SearchMessages returns the page of q.Offset and q.Limit of the results
+// and how many there are in all. The matches are between « and » in the
+// snippets.
+func (db *sqliteRepo) SearchMessages(ctx context.Context, q repo.MessageSearch) ([]repo.MessageResult, int, error) {
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	from := "message m"
+	snippet := "m.text"
+	where := []string{"m.chat_id = " + arg(q.ChatID)}
+	if q.Match != "" {
+		from = "message_fts JOIN message m ON m.rowid = message_fts.rowid"
+		snippet = "snippet(message_fts, 0, '«', '»', '…', 16)"
+		where = append(where, "message_fts MATCH "+arg(q.Match))
+	}
+	if q.UserName != "" {
+		where = append(where, "m.user_name = "+arg(q.UserName)+" COLLATE NOCASE")
+	}
+	if !q.After.IsZero() {
+		where = append(where, "m.date >= "+arg(q.After.UTC().Format(timeLayout)))
+	}
+	if !q.Before.IsZero() {
+		where = append(where, "m.date < "+arg(q.Before.UTC().Format(timeLayout)))
+	}
+	query := "FROM " + from + " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	err := db.db.GetContext(ctx, &total, "SELECT COUNT(*) "+query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []repo.MessageResult
+	err = db.db.SelectContext(ctx, &results, `
+		SELECT m.*, `+snippet+` AS snippet `+query+`
+		ORDER BY m.date DESC, m.id DESC
+		LIMIT `+arg(q.Limit)+` OFFSET `+arg(q.Offset),
+		args...)
+	return results, total, err
+}
@@ -0,0 +1,105 @@
+package sqliterepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestSearchMessages(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	defer db.Close()
+
+	day := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	for i, m := range []repo.Message{
+		{ChatID: -1, UserName: "alice", Text: "bora tomar um café", Date: day.AddDate(0, 0, -2)},
+		{ChatID: -1, UserName: "bob", Text: "cafe agora não", Date: day.AddDate(0, 0, -1)},
+		{ChatID: -1, UserName: "alice", Text: "o café da padaria é melhor", Date: day},
+		{ChatID: -1, UserName: "alice", Text: "bom dia", Date: day},
+		// other chat
+		{ChatID: -2, UserName: "alice", Text: "café", Date: day},
+	} {
+		m.ID = i + 1
+		err := db.SaveMessage(ctx, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// edits are indexed too
+	err := db.SaveMessageEdit(ctx, repo.Message{ID: 4, ChatID: -1, UserName: "alice", Text: "bom dia, café?", Date: day}, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		q    repo.MessageSearch
+		want []int
+	}{
+		{repo.MessageSearch{Match: `"cafe"`}, []int{4, 3, 2, 1}},
+		{repo.MessageSearch{Match: `"cafe" "padaria"`}, []int{3}},
+		{repo.MessageSearch{Match: `"cafe da padaria"`}, []int{3}},
+		{repo.MessageSearch{Match: `"cafe"`, UserName: "Alice"}, []int{4, 3, 1}},
+		{repo.MessageSearch{Match: `"cafe"`, After: day.AddDate(0, 0, -1)}, []int{4, 3, 2}},
+		{repo.MessageSearch{Match: `"cafe"`, Before: day.AddDate(0, 0, -1)}, []int{1}},
+		{repo.MessageSearch{UserName: "bob"}, []int{2}},
+		{repo.MessageSearch{Match: `"cafe"`, Offset: 1, Limit: 2}, []int{3, 2}},
+	} {
+		tc.q.ChatID = -1
+		if tc.q.Limit == 0 {
+			tc.q.Limit = 10
+		}
+		results, total, err := db.SearchMessages(ctx, tc.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []int{}
+		for _, r := range results {
+			got = append(got, r.ID)
+		}
+		if len(got) != len(tc.want) || (tc.q.Offset == 0 && total != len(tc.want)) {
+			t.Fatalf("%+v - want: %v, got: %v of %d", tc.q, tc.want, got, total)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("%+v - want: %v, got: %v", tc.q, tc.want, got)
+			}
+		}
+	}
+
+	results, _, err := db.SearchMessages(ctx, repo.MessageSearch{ChatID: -1, Match: `"padaria"`, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "o café da «padaria» é melhor"; results[0].Snippet != want {
+		t.Fatalf("snippet - want: %q, got: %q", want, results[0].Snippet)
+	}
+}
+
+func TestMigrateMessageIndex(t *testing.T) {
+	ctx := context.TODO()
+
+	// the messages saved before the index
+	db := openMigratedTo(t, 19)
+	err := db.SaveMessage(ctx, repo.Message{ID: 1, ChatID: -1, Text: "bora tomar um café"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrate(ctx, "./migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, total, err := db.SearchMessages(ctx, repo.MessageSearch{ChatID: -1, Match: `"cafe"`, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(results) != 1 || results[0].ID != 1 {
+		t.Fatalf("want the old message found, got: %+v of %d", results, total)
+	}
+}
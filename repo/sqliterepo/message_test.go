@@ -91,3 +91,42 @@ func TestFindMessageThread(t *testing.T) {
 		}
 	}
 }
+
+func TestFindMessagesSince(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{-time.Hour, 0, time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		err := db.SaveMessage(context.TODO(), repo.Message{
+			ID:     i + 1,
+			ChatID: 1,
+			Text:   "msg",
+			Date:   at.Add(offset),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the last 3 since at, oldest first, in any timezone
+	msgs, err := db.FindMessagesSince(context.TODO(), 1, at.In(time.FixedZone("-03", -3*60*60)), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, msg := range msgs {
+		ids = append(ids, msg.ID)
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 4 || ids[2] != 5 {
+		t.Fatalf("want messages 3 to 5, got: %v", ids)
+	}
+
+	msgs, err = db.FindMessagesSince(context.TODO(), 1, at, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 4 || msgs[0].ID != 2 {
+		t.Fatalf("want messages 2 to 5, got: %+v", msgs)
+	}
+}
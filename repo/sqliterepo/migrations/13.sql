@@ -0,0 +1,11 @@
+-- dialogs in progress, at most one per user in each chat
+CREATE TABLE dialog (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    step TEXT NOT NULL,
+    data TEXT NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chat_id, user_id)
+);
@@ -0,0 +1,24 @@
+-- chat switches become rows, so new ones don't need a column
+CREATE TABLE chat_setting (
+    chat_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (chat_id, key)
+);
+
+INSERT INTO chat_setting (chat_id, key, value)
+SELECT id, 'cask', 'true' FROM chat WHERE enable_cask = 1
+UNION ALL
+SELECT id, 'sed', 'true' FROM chat WHERE enable_sed = 1
+UNION ALL
+SELECT id, 'audio', 'true' FROM chat WHERE enable_audio = 1
+UNION ALL
+SELECT id, 'create_topics', 'true' FROM chat WHERE enable_create_topics = 1
+UNION ALL
+SELECT id, 'ask', 'true' FROM chat WHERE enable_ask = 1;
+
+ALTER TABLE chat DROP COLUMN enable_cask;
+ALTER TABLE chat DROP COLUMN enable_sed;
+ALTER TABLE chat DROP COLUMN enable_audio;
+ALTER TABLE chat DROP COLUMN enable_create_topics;
+ALTER TABLE chat DROP COLUMN enable_ask;
@@ -0,0 +1,22 @@
+-- schedules get an id to be canceled by, and may repeat following a rule
+CREATE TABLE scheduled_topic_new (
+    id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    topic TEXT NOT NULL,
+    -- empty for a single mention
+    rule TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL
+        CHECK (status IN ('created', 'failed', 'completed', 'canceled'))
+        DEFAULT 'created',
+    -- the next mention, in UTC
+    time TEXT NOT NULL
+);
+
+INSERT INTO scheduled_topic_new (chat_id, message_id, topic, status, time)
+SELECT chat_id, message_id, topic, status, time FROM scheduled_topic;
+
+DROP TABLE scheduled_topic;
+
+ALTER TABLE scheduled_topic_new RENAME TO scheduled_topic;
@@ -0,0 +1,6 @@
+-- failed mentions are retried, keeping the last error
+ALTER TABLE scheduled_topic ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_topic ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+
+-- retries are seconds apart
+UPDATE scheduled_topic SET time = time || ':00' WHERE length(time) = 16;
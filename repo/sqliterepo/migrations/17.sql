@@ -0,0 +1,28 @@
+-- events of a topic that users answer if they go
+CREATE TABLE topic_event (
+    id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    topic TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    -- when it starts, in UTC
+    time TEXT NOT NULL,
+    -- 0 for no limit
+    capacity INTEGER NOT NULL DEFAULT 0,
+    -- the message with the answers, 0 until sent
+    message_id INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL
+        CHECK (status IN ('open', 'closed'))
+        DEFAULT 'open',
+    -- the next reminder to the ones going, in UTC, empty for none
+    next_reminder TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE topic_event_answer (
+    -- answering again takes a new id, the last in the waitlist
+    id INTEGER PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES topic_event(id),
+    user_id INTEGER NOT NULL,
+    answer TEXT NOT NULL CHECK (answer IN ('yes', 'maybe', 'no')),
+    UNIQUE(event_id, user_id)
+);
@@ -0,0 +1,6 @@
+-- the counters of /conta reuse the event table of migration 1, where the
+-- old /conta saved one row per count of name by the message msg_id, at
+-- time in UTC, so those counts still show. only who counted was missing
+ALTER TABLE event ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX event_chat_name_time ON event (chat_id, name, time);
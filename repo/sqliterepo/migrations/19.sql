@@ -0,0 +1,19 @@
+-- the texts of the edited messages, from the original one to the current,
+-- with when each was written
+CREATE TABLE message_revision (
+    id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    date TIMESTAMP NOT NULL
+);
+
+CREATE INDEX message_revision_message ON message_revision (chat_id, message_id);
+
+-- the #topics a message called, so that its edits call only the new ones
+CREATE TABLE message_topic (
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    topic TEXT NOT NULL,
+    PRIMARY KEY (chat_id, message_id, topic)
+);
@@ -0,0 +1,25 @@
+-- full-text index of the texts of the messages, for /busca. it reads the
+-- texts from the message table, by its rowid, and the triggers keep it in
+-- sync. accents are ignored, so cafe finds café
+CREATE VIRTUAL TABLE message_fts USING fts5(
+    text,
+    content = 'message',
+    content_rowid = 'rowid',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER message_fts_insert AFTER INSERT ON message BEGIN
+    INSERT INTO message_fts (rowid, text) VALUES (new.rowid, new.text);
+END;
+
+CREATE TRIGGER message_fts_delete AFTER DELETE ON message BEGIN
+    INSERT INTO message_fts (message_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+END;
+
+CREATE TRIGGER message_fts_update AFTER UPDATE OF text ON message BEGIN
+    INSERT INTO message_fts (message_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+    INSERT INTO message_fts (rowid, text) VALUES (new.rowid, new.text);
+END;
+
+-- the messages saved before
+INSERT INTO message_fts (message_fts) VALUES ('rebuild');
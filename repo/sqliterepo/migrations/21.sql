@@ -0,0 +1,11 @@
+-- the summaries of /resumo, by the messages summarized, so that asking
+-- again with no new messages reuses them
+CREATE TABLE chat_summary (
+    chat_id INTEGER NOT NULL,
+    first_message_id INTEGER NOT NULL,
+    last_message_id INTEGER NOT NULL,
+    message_count INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chat_id, first_message_id, last_message_id, message_count)
+);
@@ -0,0 +1,2 @@
+-- the message the answers of a dialog reply to
+ALTER TABLE dialog ADD COLUMN prompt_id INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,19 @@
+-- the dates of the messages were saved as written by time.Time.String,
+-- like "2023-10-01 09:00:00 -0300 -03", in whatever zone the bot ran. they
+-- become UTC in timeLayout, like "2023-10-01 12:00:00", so that they
+-- compare as text. the offset comes after the first space of the time,
+-- which may have fractions of seconds
+UPDATE message SET date = datetime(
+    substr(date, 1, 19),
+    printf(
+        '%s%d minutes',
+        CASE substr(offset, 1, 1) WHEN '-' THEN '+' ELSE '-' END,
+        substr(offset, 2, 2) * 60 + substr(offset, 4, 2)
+    )
+)
+FROM (
+    SELECT rowid AS id, substr(date, 12 + instr(substr(date, 12), ' '), 5) AS offset
+    FROM message
+    WHERE length(date) > 19
+) AS old
+WHERE message.rowid = old.id;
@@ -6,8 +6,8 @@ import (
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
-func (db *sqliteRepo) SavePoll(p repo.Poll) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) SavePoll(ctx context.Context, p repo.Poll) error {
+	_, err := db.db.ExecContext(ctx, `
 		INSERT INTO poll
 		(id, chat_id, topic, result_message_id)
 		VALUES ($1, $2, $3, $4)
@@ -16,14 +16,14 @@ func (db *sqliteRepo) SavePoll(p repo.Poll) error {
 	return err
 }
 
-func (db *sqliteRepo) FindPollByMessage(msgID int) (*repo.Poll, error) {
+func (db *sqliteRepo) FindPollByMessage(ctx context.Context, msgID int) (*repo.Poll, error) {
 	var p repo.Poll
-	err := db.db.GetContext(context.TODO(), &p, `SELECT * FROM poll WHERE result_message_id = $1`, msgID)
+	err := db.db.GetContext(ctx, &p, `SELECT * FROM poll WHERE result_message_id = $1`, msgID)
 	return &p, err
 }
 
-func (db *sqliteRepo) SavePollVote(v repo.PollVote) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) SavePollVote(ctx context.Context, v repo.PollVote) error {
+	_, err := db.db.ExecContext(ctx, `
 		INSERT INTO poll_vote
 		(poll_id, user_id, vote)
 		VALUES ($1, $2, $3)
@@ -33,17 +33,17 @@ func (db *sqliteRepo) SavePollVote(v repo.PollVote) error {
 	return err
 }
 
-func (db *sqliteRepo) DeletePollVote(pollID string, userID int64) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) DeletePollVote(ctx context.Context, pollID string, userID int64) error {
+	_, err := db.db.ExecContext(ctx, `
 		DELETE FROM poll_vote
 		WHERE poll_id = $1 AND user_id = $2
 	`, pollID, userID)
 	return err
 }
 
-func (db *sqliteRepo) FindPollVote(pollID string, userID int64) (*repo.PollVote, error) {
+func (db *sqliteRepo) FindPollVote(ctx context.Context, pollID string, userID int64) (*repo.PollVote, error) {
 	var v repo.PollVote
-	err := db.db.GetContext(context.TODO(), &v, `
+	err := db.db.GetContext(ctx, &v, `
 		SELECT pv.* FROM poll_vote pv
 		JOIN user_topic ut ON ut.user_id = $2
 		WHERE pv.poll_id = $1 AND pv.user_id = $2
@@ -0,0 +1,142 @@
+package sqliterepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+type rawScheduledTopic struct {
+	ID        int64  `db:"id"`
+	ChatID    int64  `db:"chat_id"`
+	MessageID int    `db:"message_id"`
+	UserID    int64  `db:"user_id"`
+	Topic     string `db:"topic"`
+	Rule      string `db:"rule"`
+	Status    string `db:"status"`
+	Time      string `db:"time"`
+	Attempts  int    `db:"attempts"`
+	LastError string `db:"last_error"`
+}
+
+func toRawScheduledTopic(st repo.ScheduledTopic) rawScheduledTopic {
+	status := st.Status
+	if status == "" {
+		status = repo.ScheduledCreated
+	}
+	return rawScheduledTopic{
+		ID:        st.ID,
+		ChatID:    st.ChatID,
+		MessageID: st.MessageID,
+		UserID:    st.UserID,
+		Topic:     st.Topic,
+		Rule:      st.Rule,
+		Status:    status,
+		Time:      st.Time.UTC().Format(timeLayout),
+		Attempts:  st.Attempts,
+		LastError: st.LastError,
+	}
+}
+
+func (raw rawScheduledTopic) scheduledTopic() (repo.ScheduledTopic, error) {
+	t, err := time.Parse(timeLayout, raw.Time)
+	return repo.ScheduledTopic{
+		ID:        raw.ID,
+		ChatID:    raw.ChatID,
+		MessageID: raw.MessageID,
+		UserID:    raw.UserID,
+		Topic:     raw.Topic,
+		Rule:      raw.Rule,
+		Status:    raw.Status,
+		Time:      t,
+		Attempts:  raw.Attempts,
+		LastError: raw.LastError,
+	}, err
+}
+
+func (db *sqliteRepo) SaveScheduledTopic(ctx context.Context, st repo.ScheduledTopic) (int64, error) {
+	res, err := db.db.NamedExecContext(ctx, `
+		INSERT INTO scheduled_topic
+		(chat_id, message_id, user_id, topic, rule, status, time)
+		VALUES (:chat_id, :message_id, :user_id, :topic, :rule, :status, :time)
+	`, toRawScheduledTopic(st))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateScheduledTopic changes the status, the time and the attempts of
+// st.
+func (db *sqliteRepo) UpdateScheduledTopic(ctx context.Context, st repo.ScheduledTopic) error {
+	res, err := db.db.NamedExecContext(ctx, `
+		UPDATE scheduled_topic
+		SET status = :status, time = :time, attempts = :attempts, last_error = :last_error
+		WHERE id = :id
+	`, toRawScheduledTopic(st))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repo.ErrNotFound
+	}
+	return nil
+}
+
+func (db *sqliteRepo) FindScheduledTopic(ctx context.Context, id int64) (*repo.ScheduledTopic, error) {
+	var raw rawScheduledTopic
+	err := db.db.GetContext(ctx, &raw, `
+		SELECT * FROM scheduled_topic
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := raw.scheduledTopic()
+	return &st, err
+}
+
+// FindChatScheduledTopics finds the pending topics of the chat, the next
+// first.
+func (db *sqliteRepo) FindChatScheduledTopics(ctx context.Context, chatID int64) ([]repo.ScheduledTopic, error) {
+	return db.selectScheduledTopics(ctx, `
+		SELECT * FROM scheduled_topic
+		WHERE chat_id = $1 AND status = $2
+		ORDER BY datetime(time)
+	`, chatID, repo.ScheduledCreated)
+}
+
+// FindDueScheduledTopics finds the pending topics whose time is not after
+// now, the oldest first.
+func (db *sqliteRepo) FindDueScheduledTopics(ctx context.Context, now time.Time) ([]repo.ScheduledTopic, error) {
+	return db.selectScheduledTopics(ctx, `
+		SELECT * FROM scheduled_topic
+		WHERE status = $1 AND datetime(time) <= datetime($2)
+		ORDER BY datetime(time)
+	`, repo.ScheduledCreated, now.UTC().Format(timeLayout))
+}
+
+func (db *sqliteRepo) selectScheduledTopics(ctx context.Context, query string, args ...any) ([]repo.ScheduledTopic, error) {
+	var raws []rawScheduledTopic
+	err := db.db.SelectContext(ctx, &raws, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]repo.ScheduledTopic, 0, len(raws))
+	for _, raw := range raws {
+		st, err := raw.scheduledTopic()
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, st)
+	}
+	return topics, nil
+}
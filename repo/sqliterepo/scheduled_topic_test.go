@@ -0,0 +1,132 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestScheduledTopic(t *testing.T) {
+	db := newDB(t)
+	t.Cleanup(func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	ctx := context.TODO()
+	at := time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC)
+	st := repo.ScheduledTopic{
+		ChatID:    -1,
+		MessageID: 10,
+		UserID:    1,
+		Topic:     "#futebol",
+		Rule:      "sex 12:30",
+		Time:      at,
+	}
+
+	id, err := db.SaveScheduledTopic(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.ID = id
+	st.Status = repo.ScheduledCreated
+
+	for _, tc := range []struct {
+		now  time.Time
+		want int
+	}{
+		{at.Add(-time.Minute), 0},
+		{at, 1},
+		{at.Add(time.Hour), 1},
+	} {
+		due, err := db.FindDueScheduledTopics(ctx, tc.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != tc.want {
+			t.Fatalf("at %s - want: %d due, got: %+v", tc.now, tc.want, due)
+		}
+	}
+
+	got, err := db.FindScheduledTopic(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != st {
+		t.Fatalf("want: %+v, got: %+v", st, *got)
+	}
+
+	// moved to the next week after failing
+	st.Time = at.AddDate(0, 0, 7)
+	st.Attempts = 2
+	st.LastError = "chat not found"
+	err = db.UpdateScheduledTopic(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := db.FindDueScheduledTopics(ctx, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("want moved topic not due, got: %+v", due)
+	}
+
+	pending, err := db.FindChatScheduledTopics(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != st {
+		t.Fatalf("want: %+v pending, got: %+v", st, pending)
+	}
+
+	st.Status = repo.ScheduledCanceled
+	err = db.UpdateScheduledTopic(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.FindChatScheduledTopics(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("want canceled topic not pending, got: %+v", pending)
+	}
+
+	_, err = db.FindScheduledTopic(ctx, id+1)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("err - want: %v, got: %v", repo.ErrNotFound, err)
+	}
+}
+
+func TestMigrateScheduledTopicTime(t *testing.T) {
+	ctx := context.TODO()
+
+	// times had no seconds before the retries
+	db := openMigratedTo(t, 15)
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO scheduled_topic (chat_id, message_id, topic, time)
+		VALUES (-1, 10, '#futebol', '2023-10-01 12:30')
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrate(ctx, "./migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := db.FindDueScheduledTopics(ctx, time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Time != time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC) {
+		t.Fatalf("want the topic due at 12:30, got: %+v", due)
+	}
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// timeLayout is how the times compared in queries are stored as text, in
+// UTC, as in message, scheduled_topic, topic_event, event and chat_summary
+const timeLayout = "2006-01-02 15:04:05"
+
 type sqliteRepo struct {
 	db      *sqlx.DB
 	Version int
@@ -23,6 +27,14 @@ func Open(ctx context.Context, dsn string, dir string) (repo.Repo, error) {
 		return nil, err
 	}
 
+	if dsn == ":memory:" {
+		// each connection to :memory: has its own database, so keep a
+		// single one open
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+	}
+
 	err = db.Ping()
 	if err != nil {
 		return nil, err
@@ -37,10 +49,6 @@ func Open(ctx context.Context, dsn string, dir string) (repo.Repo, error) {
 	return repo, err
 }
 
-func (db *sqliteRepo) DB() *sqlx.DB {
-	return db.db
-}
-
 func (db *sqliteRepo) migrate(ctx context.Context, dir string) error {
 	var version int
 
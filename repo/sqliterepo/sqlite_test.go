@@ -2,6 +2,9 @@ package sqliterepo
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	_ "modernc.org/sqlite"
@@ -15,7 +18,65 @@ func Test_Migrate(t *testing.T) {
 	db := _db.(*sqliteRepo)
 
 	// this test has to be updated anytime a new migration is created, on purpose
-	if db.Version != 11 {
-		t.Fatalf("version - want: %d, got: %d", 11, db.Version)
+	if db.Version != 23 {
+		t.Fatalf("version - want: %d, got: %d", 23, db.Version)
+	}
+}
+
+// Test_MigrateMessageDates checks that migration 23 moves the dates saved by
+// time.Time.String to UTC in timeLayout.
+func Test_MigrateMessageDates(t *testing.T) {
+	ctx := context.TODO()
+
+	// the migrations before 23
+	dir := t.TempDir()
+	for i := 1; i < 23; i++ {
+		name := fmt.Sprintf("%d.sql", i)
+		b, err := os.ReadFile(filepath.Join("migrations", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), b, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	_db, err := Open(ctx, dsn, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := _db.(*sqliteRepo)
+	for id, date := range []string{
+		"2023-10-01 09:00:00 -0300 -03",
+		"2023-10-01 23:30:00.5 +0530 IST",
+		"2023-10-01 12:00:00 +0000 UTC",
+	} {
+		_, err = db.db.ExecContext(ctx, `
+			INSERT INTO message (id, chat_id, date, text, user_id, user_name)
+			VALUES ($1, -1, $2, 'oi', 1, 'alice')
+		`, id, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	_db, err = Open(ctx, dsn, "./migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = _db.(*sqliteRepo)
+	defer db.Close()
+
+	var dates []string
+	err = db.db.SelectContext(ctx, &dates, `SELECT CAST(date AS TEXT) FROM message ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2023-10-01 12:00:00", "2023-10-01 18:00:00", "2023-10-01 12:00:00"}
+	if fmt.Sprint(dates) != fmt.Sprint(want) {
+		t.Fatalf("dates - want: %q, got: %q", want, dates)
 	}
 }
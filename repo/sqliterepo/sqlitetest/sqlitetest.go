@@ -0,0 +1,36 @@
+// Package sqlitetest opens a migrated in-memory database for the tests of
+// the packages that use the repo.
+package sqlitetest
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo"
+	_ "modernc.org/sqlite"
+)
+
+// Open returns an empty repo with every migration, closed when the test
+// ends.
+func Open(t testing.TB) repo.Repo {
+	t.Helper()
+
+	r, err := sqliterepo.Open(context.TODO(), ":memory:", migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+	})
+	return r
+}
+
+// migrations is the directory of the migrations, wherever the test runs
+// from.
+func migrations() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "migrations")
+}
@@ -0,0 +1,52 @@
+package sqliterepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func (db *sqliteRepo) SaveSummary(ctx context.Context, sum repo.Summary) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT INTO chat_summary
+		(chat_id, first_message_id, last_message_id, message_count, text, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO UPDATE SET text = $5, created_at = $6
+	`,
+		sum.ChatID,
+		sum.FirstMessageID,
+		sum.LastMessageID,
+		sum.Messages,
+		sum.Text,
+		sum.CreatedAt.UTC().Format(timeLayout),
+	)
+	return err
+}
+
+func (db *sqliteRepo) FindSummary(ctx context.Context, key repo.SummaryKey) (*repo.Summary, error) {
+	var sum repo.Summary
+	err := db.db.GetContext(ctx, &sum, `
+		SELECT * FROM chat_summary
+		WHERE
+			chat_id = $1 AND
+			first_message_id = $2 AND
+			last_message_id = $3 AND
+			message_count = $4
+	`, key.ChatID, key.FirstMessageID, key.LastMessageID, key.Messages)
+	if err != nil {
+		return nil, err
+	}
+	sum.CreatedAt = sum.CreatedAt.UTC()
+	return &sum, nil
+}
+
+// DeleteSummariesBefore deletes the summaries created before t, of every
+// chat.
+func (db *sqliteRepo) DeleteSummariesBefore(ctx context.Context, t time.Time) error {
+	_, err := db.db.ExecContext(ctx, `
+		DELETE FROM chat_summary
+		WHERE created_at < $1
+	`, t.UTC().Format(timeLayout))
+	return err
+}
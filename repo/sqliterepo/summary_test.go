@@ -0,0 +1,69 @@
+package sqliterepo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestSummaries(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	t.Cleanup(func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	key := repo.SummaryKey{ChatID: -1, FirstMessageID: 10, LastMessageID: 20, Messages: 11}
+	at := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	err := db.SaveSummary(ctx, repo.Summary{SummaryKey: key, Text: "antigo", CreatedAt: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// summarized again
+	want := repo.Summary{SummaryKey: key, Text: "resumo", CreatedAt: at.Add(time.Hour)}
+	err = db.SaveSummary(ctx, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindSummary(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != want {
+		t.Fatalf("want: %+v, got: %+v", want, *got)
+	}
+
+	// a new message is another summary
+	other := key
+	other.LastMessageID++
+	other.Messages++
+	_, err = db.FindSummary(ctx, other)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("want: %v, got: %v", repo.ErrNotFound, err)
+	}
+
+	err = db.DeleteSummariesBefore(ctx, at.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FindSummary(ctx, key)
+	if err != nil {
+		t.Fatalf("want the summary kept, got: %v", err)
+	}
+
+	err = db.DeleteSummariesBefore(ctx, at.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.FindSummary(ctx, key)
+	if !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("want the summary deleted, got: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package sqliterepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+type rawEvent struct {
+	ID           int64  `db:"id"`
+	ChatID       int64  `db:"chat_id"`
+	UserID       int64  `db:"user_id"`
+	Topic        string `db:"topic"`
+	Description  string `db:"description"`
+	Time         string `db:"time"`
+	Capacity     int    `db:"capacity"`
+	MessageID    int    `db:"message_id"`
+	Status       string `db:"status"`
+	NextReminder string `db:"next_reminder"`
+}
+
+func toRawEvent(e repo.Event) rawEvent {
+	status := e.Status
+	if status == "" {
+		status = repo.EventOpen
+	}
+	reminder := ""
+	if !e.NextReminder.IsZero() {
+		reminder = e.NextReminder.UTC().Format(timeLayout)
+	}
+	return rawEvent{
+		ID:           e.ID,
+		ChatID:       e.ChatID,
+		UserID:       e.UserID,
+		Topic:        e.Topic,
+		Description:  e.Description,
+		Time:         e.Time.UTC().Format(timeLayout),
+		Capacity:     e.Capacity,
+		MessageID:    e.MessageID,
+		Status:       status,
+		NextReminder: reminder,
+	}
+}
+
+func (raw rawEvent) event() (repo.Event, error) {
+	e := repo.Event{
+		ID:          raw.ID,
+		ChatID:      raw.ChatID,
+		UserID:      raw.UserID,
+		Topic:       raw.Topic,
+		Description: raw.Description,
+		Capacity:    raw.Capacity,
+		MessageID:   raw.MessageID,
+		Status:      raw.Status,
+	}
+
+	var err error
+	e.Time, err = time.Parse(timeLayout, raw.Time)
+	if err != nil {
+		return e, err
+	}
+	if raw.NextReminder != "" {
+		e.NextReminder, err = time.Parse(timeLayout, raw.NextReminder)
+	}
+	return e, err
+}
+
+func (db *sqliteRepo) SaveEvent(ctx context.Context, e repo.Event) (int64, error) {
+	res, err := db.db.NamedExecContext(ctx, `
+		INSERT INTO topic_event
+		(chat_id, user_id, topic, description, time, capacity, message_id, status, next_reminder)
+		VALUES (:chat_id, :user_id, :topic, :description, :time, :capacity, :message_id, :status, :next_reminder)
+	`, toRawEvent(e))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateEvent changes the message, the status and the next reminder of e.
+func (db *sqliteRepo) UpdateEvent(ctx context.Context, e repo.Event) error {
+	res, err := db.db.NamedExecContext(ctx, `
+		UPDATE topic_event
+		SET message_id = :message_id, status = :status, next_reminder = :next_reminder
+		WHERE id = :id
+	`, toRawEvent(e))
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repo.ErrNotFound
+	}
+	return nil
+}
+
+func (db *sqliteRepo) FindEvent(ctx context.Context, id int64) (*repo.Event, error) {
+	var raw rawEvent
+	err := db.db.GetContext(ctx, &raw, `
+		SELECT * FROM topic_event
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := raw.event()
+	return &e, err
+}
+
+// FindDueEvents finds the open events that started or have a reminder due
+// at now.
+func (db *sqliteRepo) FindDueEvents(ctx context.Context, now time.Time) ([]repo.Event, error) {
+	var raws []rawEvent
+	err := db.db.SelectContext(ctx, &raws, `
+		SELECT * FROM topic_event
+		WHERE status = $1 AND (
+			datetime(time) <= datetime($2) OR
+			(next_reminder != '' AND datetime(next_reminder) <= datetime($2))
+		)
+		ORDER BY id
+	`, repo.EventOpen, now.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]repo.Event, 0, len(raws))
+	for _, raw := range raws {
+		e, err := raw.event()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// SaveEventAnswer replaces the answer of the user, which goes after the
+// others.
+func (db *sqliteRepo) SaveEventAnswer(ctx context.Context, a repo.EventAnswer) error {
+	_, err := db.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO topic_event_answer
+		(event_id, user_id, answer)
+		VALUES ($1, $2, $3)
+	`, a.EventID, a.User.ID, a.Answer)
+	return err
+}
+
+func (db *sqliteRepo) DeleteEventAnswer(ctx context.Context, eventID int64, userID int64) error {
+	_, err := db.db.ExecContext(ctx, `
+		DELETE FROM topic_event_answer
+		WHERE event_id = $1 AND user_id = $2
+	`, eventID, userID)
+	return err
+}
+
+// FindEventAnswers finds the answers to the event in the order they were
+// given.
+func (db *sqliteRepo) FindEventAnswers(ctx context.Context, eventID int64) ([]repo.EventAnswer, error) {
+	var rows []struct {
+		Answer string `db:"answer"`
+		repo.User
+	}
+	err := db.db.SelectContext(ctx, &rows, `
+		SELECT a.answer, u.* FROM topic_event_answer a
+		JOIN user u ON u.id = a.user_id
+		WHERE a.event_id = $1
+		ORDER BY a.id
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := make([]repo.EventAnswer, 0, len(rows))
+	for _, row := range rows {
+		answers = append(answers, repo.EventAnswer{
+			EventID: eventID,
+			User:    row.User,
+			Answer:  row.Answer,
+		})
+	}
+	return answers, nil
+}
@@ -0,0 +1,152 @@
+package sqliterepo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestEvent(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	t.Cleanup(func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	at := time.Date(2026, 10, 23, 23, 0, 0, 0, time.UTC)
+	e := repo.Event{
+		ChatID:       -1,
+		UserID:       1,
+		Topic:        "#futebol",
+		Description:  "pelada no parque",
+		Time:         at,
+		Capacity:     10,
+		NextReminder: at.Add(-time.Hour),
+	}
+
+	id, err := db.SaveEvent(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.ID = id
+	e.Status = repo.EventOpen
+
+	e.MessageID = 20
+	err = db.UpdateEvent(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.FindEvent(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != e {
+		t.Fatalf("want: %+v, got: %+v", e, *got)
+	}
+
+	for _, tc := range []struct {
+		now  time.Time
+		want int
+	}{
+		{at.Add(-2 * time.Hour), 0},
+		// the reminder
+		{at.Add(-time.Hour), 1},
+		// started
+		{at, 1},
+	} {
+		due, err := db.FindDueEvents(ctx, tc.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != tc.want {
+			t.Fatalf("at %s - want: %d due, got: %+v", tc.now, tc.want, due)
+		}
+	}
+
+	// no more reminders
+	e.NextReminder = time.Time{}
+	err = db.UpdateEvent(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := db.FindDueEvents(ctx, at.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("want no reminder due, got: %+v", due)
+	}
+
+	e.Status = repo.EventClosed
+	err = db.UpdateEvent(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err = db.FindDueEvents(ctx, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("want closed event not due, got: %+v", due)
+	}
+}
+
+func TestEventAnswers(t *testing.T) {
+	ctx := context.TODO()
+	db := newDB(t)
+	t.Cleanup(func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	users := []repo.User{
+		{ID: 1, Username: "alice"},
+		{ID: 2, FirstName: "Bob"},
+		{ID: 3, Username: "carol"},
+	}
+	for _, u := range users {
+		err := db.SaveUser(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, a := range []repo.EventAnswer{
+		{EventID: 1, User: users[0], Answer: repo.AnswerYes},
+		{EventID: 1, User: users[1], Answer: repo.AnswerMaybe},
+		{EventID: 1, User: users[2], Answer: repo.AnswerYes},
+		// other event
+		{EventID: 2, User: users[1], Answer: repo.AnswerNo},
+		// changed, goes last
+		{EventID: 1, User: users[0], Answer: repo.AnswerYes},
+	} {
+		err := db.SaveEventAnswer(ctx, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := db.DeleteEventAnswer(ctx, 1, users[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers, err := db.FindEventAnswers(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []repo.EventAnswer{
+		{EventID: 1, User: users[2], Answer: repo.AnswerYes},
+		{EventID: 1, User: users[0], Answer: repo.AnswerYes},
+	}
+	if len(answers) != len(want) || answers[0] != want[0] || answers[1] != want[1] {
+		t.Fatalf("want: %+v, got: %+v", want, answers)
+	}
+}
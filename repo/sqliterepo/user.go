@@ -3,11 +3,13 @@ package sqliterepo
 import (
 	"context"
 
+	"github.com/jmoiron/sqlx"
+
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
-func (db *sqliteRepo) SaveUser(u repo.User) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) SaveUser(ctx context.Context, u repo.User) error {
+	_, err := db.db.ExecContext(ctx, `
 		INSERT INTO user
 		(id, first_name, username)
 		VALUES ($1, $2, $3)
@@ -18,14 +20,14 @@ func (db *sqliteRepo) SaveUser(u repo.User) error {
 	return err
 }
 
-func (db *sqliteRepo) FindUser(id int64) (*repo.User, error) {
+func (db *sqliteRepo) FindUser(ctx context.Context, id int64) (*repo.User, error) {
 	var u repo.User
-	err := db.db.GetContext(context.TODO(), &u, `SELECT * FROM user WHERE id = $1`, id)
+	err := db.db.GetContext(ctx, &u, `SELECT * FROM user WHERE id = $1`, id)
 	return &u, err
 }
 
-func (db *sqliteRepo) ExistsChatTopic(chatID int64, topic string) (bool, error) {
-	row := db.db.QueryRowContext(context.TODO(), `
+func (db *sqliteRepo) ExistsChatTopic(ctx context.Context, chatID int64, topic string) (bool, error) {
+	row := db.db.QueryRowContext(ctx, `
 		SELECT EXISTS (
 			SELECT * FROM user_topic
 			WHERE chat_id = $1 AND topic = $2
@@ -37,8 +39,8 @@ func (db *sqliteRepo) ExistsChatTopic(chatID int64, topic string) (bool, error)
 	return exists, err
 }
 
-func (db *sqliteRepo) SaveUserTopic(topic repo.UserTopic) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) SaveUserTopic(ctx context.Context, topic repo.UserTopic) error {
+	_, err := db.db.ExecContext(ctx, `
 		INSERT INTO user_topic
 		(chat_id, user_id, topic)
 		VALUES ($1, $2, $3)
@@ -48,8 +50,8 @@ func (db *sqliteRepo) SaveUserTopic(topic repo.UserTopic) error {
 	return err
 }
 
-func (db *sqliteRepo) DeleteUserTopic(topic repo.UserTopic) (int64, error) {
-	res, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) DeleteUserTopic(ctx context.Context, topic repo.UserTopic) (int64, error) {
+	res, err := db.db.ExecContext(ctx, `
 		DELETE FROM user_topic
 		WHERE chat_id = $1 AND user_id = $2 AND topic = $3
 	`, topic.ChatID, topic.UserID, topic.Topic)
@@ -61,7 +63,7 @@ func (db *sqliteRepo) DeleteUserTopic(topic repo.UserTopic) (int64, error) {
 	return res.RowsAffected()
 }
 
-func (db *sqliteRepo) FindUserChatTopics(chatID, userID int64) ([]repo.UserTopic, error) {
+func (db *sqliteRepo) FindUserChatTopics(ctx context.Context, chatID, userID int64) ([]repo.UserTopic, error) {
 	sql := `
 		SELECT *, (
 			SELECT COUNT(*) FROM user_topic
@@ -70,13 +72,14 @@ func (db *sqliteRepo) FindUserChatTopics(chatID, userID int64) ([]repo.UserTopic
 		) AS subscribers
 		FROM user_topic ut
 		WHERE chat_id = $1 AND user_id = $2
+		ORDER BY topic
 	`
 	var topics []repo.UserTopic
-	err := db.db.SelectContext(context.TODO(), &topics, sql, chatID, userID)
+	err := db.db.SelectContext(ctx, &topics, sql, chatID, userID)
 	return topics, err
 }
 
-func (db *sqliteRepo) FindChatTopics(chatID int64) ([]repo.UserTopic, error) {
+func (db *sqliteRepo) FindChatTopics(ctx context.Context, chatID int64) ([]repo.UserTopic, error) {
 	sql := `
 		SELECT DISTINCT *, COUNT(*) AS subscribers FROM user_topic
 		WHERE chat_id = $1
@@ -84,17 +87,36 @@ func (db *sqliteRepo) FindChatTopics(chatID int64) ([]repo.UserTopic, error) {
 		ORDER BY subscribers DESC
 	`
 	var topics []repo.UserTopic
-	err := db.db.SelectContext(context.TODO(), &topics, sql, chatID)
+	err := db.db.SelectContext(ctx, &topics, sql, chatID)
 	return topics, err
 }
 
-func (db *sqliteRepo) FindUsersByTopic(chatID int64, topic string) ([]repo.User, error) {
+func (db *sqliteRepo) FindUsersByTopic(ctx context.Context, chatID int64, topic string) ([]repo.User, error) {
 	sql := `
 		SELECT u.* FROM user u
 		JOIN user_topic ut ON u.id = ut.user_id
 		WHERE ut.chat_id = $1 AND ut.topic = $2
 	`
 	var users []repo.User
-	err := db.db.SelectContext(context.TODO(), &users, sql, chatID, topic)
+	err := db.db.SelectContext(ctx, &users, sql, chatID, topic)
+	return users, err
+}
+
+func (db *sqliteRepo) FindUsersByTopics(ctx context.Context, chatID int64, topics []string) ([]repo.User, error) {
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	sql, args, err := sqlx.In(`
+		SELECT DISTINCT u.* FROM user u
+		JOIN user_topic ut ON u.id = ut.user_id
+		WHERE ut.chat_id = ? AND ut.topic IN (?)
+	`, chatID, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []repo.User
+	err = db.db.SelectContext(ctx, &users, db.db.Rebind(sql), args...)
 	return users, err
 }
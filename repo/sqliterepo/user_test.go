@@ -1,6 +1,7 @@
 package sqliterepo
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -23,18 +24,18 @@ func TestCreateAndUpdateUser(t *testing.T) {
 	}
 
 	// not stored yet
-	_, err := db.FindUser(user.ID)
+	_, err := db.FindUser(context.TODO(), user.ID)
 	if !errors.Is(err, repo.ErrNotFound) {
 		t.Fatalf("err - want: %v, got: %v", repo.ErrNotFound, err)
 	}
 
-	err = db.SaveUser(user)
+	err = db.SaveUser(context.TODO(), user)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// must be stored
-	loadedUser, err := db.FindUser(user.ID)
+	loadedUser, err := db.FindUser(context.TODO(), user.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -45,13 +46,13 @@ func TestCreateAndUpdateUser(t *testing.T) {
 	user.FirstName = "Newname"
 	user.Username = "Newusername"
 
-	err = db.SaveUser(user)
+	err = db.SaveUser(context.TODO(), user)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// must be updated
-	loadedUser, err = db.FindUser(user.ID)
+	loadedUser, err = db.FindUser(context.TODO(), user.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,7 +78,7 @@ func TestCreateAndDeleteUserTopic(t *testing.T) {
 	}
 
 	// ensure topic does not exist yet
-	exists, err := db.ExistsChatTopic(userTopic.ChatID, userTopic.Topic)
+	exists, err := db.ExistsChatTopic(context.TODO(), userTopic.ChatID, userTopic.Topic)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -86,25 +87,25 @@ func TestCreateAndDeleteUserTopic(t *testing.T) {
 	}
 
 	// store user
-	err = db.SaveUser(user)
+	err = db.SaveUser(context.TODO(), user)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// store topic
-	err = db.SaveUserTopic(userTopic)
+	err = db.SaveUserTopic(context.TODO(), userTopic)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// double storing the topic should do nothing
-	err = db.SaveUserTopic(userTopic)
+	err = db.SaveUserTopic(context.TODO(), userTopic)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// ensure topic exists
-	exists, err = db.ExistsChatTopic(userTopic.ChatID, userTopic.Topic)
+	exists, err = db.ExistsChatTopic(context.TODO(), userTopic.ChatID, userTopic.Topic)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,7 +114,7 @@ func TestCreateAndDeleteUserTopic(t *testing.T) {
 	}
 
 	// ensure user is subscribed to topic
-	users, err := db.FindUsersByTopic(userTopic.ChatID, userTopic.Topic)
+	users, err := db.FindUsersByTopic(context.TODO(), userTopic.ChatID, userTopic.Topic)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -122,7 +123,7 @@ func TestCreateAndDeleteUserTopic(t *testing.T) {
 	}
 
 	// ensure topic is found on user topics
-	topics, err := db.FindUserChatTopics(userTopic.ChatID, user.ID)
+	topics, err := db.FindUserChatTopics(context.TODO(), userTopic.ChatID, user.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -132,7 +133,7 @@ func TestCreateAndDeleteUserTopic(t *testing.T) {
 	userTopic = topics[0]
 
 	// delete topic
-	n, err := db.DeleteUserTopic(userTopic)
+	n, err := db.DeleteUserTopic(context.TODO(), userTopic)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -141,7 +142,7 @@ func TestCreateAndDeleteUserTopic(t *testing.T) {
 	}
 
 	// ensure topic is deleted
-	topics, err = db.FindChatTopics(userTopic.ChatID)
+	topics, err = db.FindChatTopics(context.TODO(), userTopic.ChatID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -6,8 +6,8 @@ import (
 	"github.com/igoracmelo/euperturbot/repo"
 )
 
-func (db *sqliteRepo) SaveVoice(v repo.Voice) error {
-	_, err := db.db.ExecContext(context.TODO(), `
+func (db *sqliteRepo) SaveVoice(ctx context.Context, v repo.Voice) error {
+	_, err := db.db.ExecContext(ctx, `
 		INSERT INTO voice
 			(file_id, user_id, chat_id)
 		VALUES
@@ -20,9 +20,9 @@ func (db *sqliteRepo) SaveVoice(v repo.Voice) error {
 	return err
 }
 
-func (db *sqliteRepo) FindRandomVoice(chatID int64) (*repo.Voice, error) {
+func (db *sqliteRepo) FindRandomVoice(ctx context.Context, chatID int64) (*repo.Voice, error) {
 	var v repo.Voice
-	err := db.db.GetContext(context.TODO(), &v, `
+	err := db.db.GetContext(ctx, &v, `
 		SELECT * FROM voice
 		WHERE chat_id = $1
 		ORDER BY RANDOM()
@@ -0,0 +1,194 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+// header starts the results, followed by the query. The page buttons read
+// the query back from it.
+const header = "🔎 "
+
+// maxSnippet is the length of the texts shown when the query has only
+// filters
+const maxSnippet = 200
+
+// Handler answers /busca with the Service.
+type Handler struct {
+	Service Service
+}
+
+// Search handles /busca, sending the first page of the results.
+func (h Handler) Search(ctx context.Context, s bot.Service, u bot.Update) error {
+	chatID := u.Message.Chat.ID
+	text := strings.TrimSpace(bh.ArgsFrom(ctx).Text("termo"))
+	q, err := h.parse(ctx, chatID, text)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.Service.Search(ctx, chatID, q, 1)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+	if page.Total == 0 {
+		return bh.Reply{Text: h.notFound(ctx, chatID)}
+	}
+
+	loc, err := h.Service.Settings.Location(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	_, err = s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:                   chatID,
+		Text:                     pageText(text, page, chatID, loc),
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		ReplyMarkup:              pageKeyboard(page),
+	})
+	return err
+}
+
+// PageButton handles the buttons of /busca, "busca:page:<n>", editing the
+// message to the page n of the same query.
+func (h Handler) PageButton(ctx context.Context, s bot.Service, u bot.Update, args bh.CallbackArgs) error {
+	msg := u.CallbackQuery.Message
+	n, err := args.Int(0)
+	if err != nil || msg == nil || !strings.HasPrefix(msg.Text, header) {
+		return bh.Toast{Text: "a busca não existe mais"}
+	}
+
+	chatID := msg.Chat.ID
+	text, _, _ := strings.Cut(strings.TrimPrefix(msg.Text, header), "\n")
+	q, err := h.parse(ctx, chatID, text)
+	if err != nil {
+		return bh.Toast{Text: "a busca não existe mais"}
+	}
+
+	page, err := h.Service.Search(ctx, chatID, q, n)
+	if err != nil {
+		return err
+	}
+	if len(page.Results) == 0 {
+		return bh.Toast{Text: "essa página não existe mais"}
+	}
+
+	loc, err := h.Service.Settings.Location(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:      chatID,
+		MessageID:   msg.MessageID,
+		Text:        pageText(text, page, chatID, loc),
+		ReplyMarkup: pageKeyboard(page),
+	})
+	if err != nil && !errors.Is(err, bot.ErrMessageNotModified) {
+		return err
+	}
+	return nil
+}
+
+// parse reads text at the timezone of chatID, with the errors as replies.
+func (h Handler) parse(ctx context.Context, chatID int64, text string) (Query, error) {
+	loc, err := h.Service.Settings.Location(ctx, chatID)
+	if err != nil {
+		return Query{}, err
+	}
+
+	q, err := ParseQuery(text, time.Now(), loc)
+	if errors.Is(err, ErrEmptyQuery) {
+		return Query{}, bh.Reply{Text: "busque por palavras, \"frases\", from:nome, after:01/02 ou before:01/02"}
+	}
+	if errors.Is(err, ErrInvalidDate) {
+		return Query{}, bh.Reply{Text: "data inválida, use 31/12, 31/12/2023 ou 2023-12-31"}
+	}
+	return q, err
+}
+
+// notFound explains the empty results, as messages are only saved with
+// the cask feature on.
+func (h Handler) notFound(ctx context.Context, chatID int64) string {
+	enabled, err := h.Service.Settings.Enabled(ctx, chatID, settings.CAsk)
+	if err != nil {
+		log.Print(err)
+	}
+	if err != nil || enabled {
+		return "nada encontrado"
+	}
+	return "nada encontrado, as mensagens só são salvas com o cask ligado no /config"
+}
+
+func pageText(query string, page Page, chatID int64, loc *time.Location) string {
+	var b strings.Builder
+	b.WriteString(header + query + "\n")
+	fmt.Fprintf(&b, "%d %s, página %d/%d\n", page.Total, plural(page.Total, "mensagem", "mensagens"), page.Page, page.Pages)
+
+	for _, r := range page.Results {
+		b.WriteString("\n")
+		name := r.UserName
+		if name == "" {
+			name = "?"
+		}
+		fmt.Fprintf(&b, "%s, %s\n", name, r.Date.In(loc).Format("02/01/2006 15:04"))
+		b.WriteString(truncate(r.Snippet, maxSnippet) + "\n")
+		if link := messageLink(chatID, r.ID); link != "" {
+			b.WriteString(link + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func pageKeyboard(page Page) *bot.InlineKeyboardMarkup {
+	var row []bot.InlineKeyboardButton
+	if page.Page > 1 {
+		row = append(row, bot.InlineKeyboardButton{
+			Text:         "« anterior",
+			CallbackData: bh.MustEncodeCallback("busca:page", page.Page-1),
+		})
+	}
+	if page.Page < page.Pages {
+		row = append(row, bot.InlineKeyboardButton{
+			Text:         "próxima »",
+			CallbackData: bh.MustEncodeCallback("busca:page", page.Page+1),
+		})
+	}
+	if len(row) == 0 {
+		return nil
+	}
+	return &bot.InlineKeyboardMarkup{InlineKeyboard: [][]bot.InlineKeyboardButton{row}}
+}
+
+// messageLink is the link to msgID, which only supergroups have.
+func messageLink(chatID int64, msgID int) string {
+	const supergroup = -1000000000000
+	if chatID > supergroup {
+		return ""
+	}
+	return "https://t.me/c/" + strconv.FormatInt(-chatID+supergroup, 10) + "/" + strconv.Itoa(msgID)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
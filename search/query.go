@@ -0,0 +1,136 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrEmptyQuery  = errors.New("empty search query")
+	ErrInvalidDate = errors.New("invalid search date")
+)
+
+// Query is what /busca looks for. Messages must have all the Terms, each a
+// word or a "quoted phrase", and match the filters set.
+type Query struct {
+	Terms []string
+	// From is the name of the sender, as saved in the history
+	From string
+	// After and Before are the start of the days given, Before excluded
+	After  time.Time
+	Before time.Time
+}
+
+var dateLayouts = []string{"2006-01-02", "02/01/2006"}
+
+// ParseQuery reads the words and "phrases" of text and the filters
+// from:name, after:date and before:date, also de:, depois: and antes:.
+// Dates are like 2006-01-02, 02/01/2006 or 02/01, of the year of now, in
+// loc.
+func ParseQuery(text string, now time.Time, loc *time.Location) (Query, error) {
+	var q Query
+	for _, tok := range tokens(text) {
+		if tok.phrase {
+			q.Terms = append(q.Terms, tok.text)
+			continue
+		}
+
+		key, value, ok := strings.Cut(tok.text, ":")
+		if !ok || value == "" {
+			q.Terms = append(q.Terms, tok.text)
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "from", "de":
+			q.From = sanitizeName(value)
+		case "after", "depois":
+			q.After, err = parseDate(value, now, loc)
+		case "before", "antes":
+			q.Before, err = parseDate(value, now, loc)
+		default:
+			q.Terms = append(q.Terms, tok.text)
+		}
+		if err != nil {
+			return Query{}, err
+		}
+	}
+
+	if len(q.Terms) == 0 && q.From == "" && q.After.IsZero() && q.Before.IsZero() {
+		return Query{}, ErrEmptyQuery
+	}
+	return q, nil
+}
+
+// match is the FTS5 query for the terms, quoted so their symbols are not
+// taken as operators.
+func (q Query) match() string {
+	quoted := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+type token struct {
+	text   string
+	phrase bool
+}
+
+// tokens splits text by spaces, keeping what is between quotes together.
+func tokens(text string) []token {
+	var toks []token
+	var cur strings.Builder
+	quoted := false
+	flush := func(phrase bool) {
+		s := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if s != "" {
+			toks = append(toks, token{text: s, phrase: phrase})
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			flush(quoted)
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush(false)
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	// an unclosed quote is a phrase until the end
+	flush(quoted)
+	return toks
+}
+
+func parseDate(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.ParseInLocation("02/01", s, loc)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return time.Date(now.In(loc).Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+}
+
+// sanitizeName leaves name like the names saved with the messages.
+func sanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(name, "@") {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 10, 18, 9, 0, 0, 0, loc)
+
+	for _, tc := range []struct {
+		text string
+		want Query
+	}{
+		{"churrasco", Query{Terms: []string{"churrasco"}}},
+		{`bora "jogar bola" hoje`, Query{Terms: []string{"bora", "jogar bola", "hoje"}}},
+		{"from:@Fulano_ churrasco", Query{Terms: []string{"churrasco"}, From: "Fulano"}},
+		{"de:fulano", Query{From: "fulano"}},
+		{
+			"after:01/10 before:2023-10-15 x",
+			Query{
+				Terms:  []string{"x"},
+				After:  time.Date(2023, 10, 1, 0, 0, 0, 0, loc),
+				Before: time.Date(2023, 10, 15, 0, 0, 0, 0, loc),
+			},
+		},
+		{"depois:31/12/2022", Query{After: time.Date(2022, 12, 31, 0, 0, 0, 0, loc)}},
+		{"link:http://x.com", Query{Terms: []string{"link:http://x.com"}}},
+		{"“frase com aspas” “sem fim", Query{Terms: []string{"frase com aspas", "sem fim"}}},
+	} {
+		got, err := ParseQuery(tc.text, now, loc)
+		if err != nil {
+			t.Errorf("%q: %v", tc.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: want: %+v, got: %+v", tc.text, tc.want, got)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		text string
+		want error
+	}{
+		{"", ErrEmptyQuery},
+		{`  ""  `, ErrEmptyQuery},
+		{"from:@", ErrEmptyQuery},
+		{"x after:ontem", ErrInvalidDate},
+		{"x antes:32/01", ErrInvalidDate},
+	} {
+		_, err := ParseQuery(tc.text, now, time.UTC)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%q: want: %v, got: %v", tc.text, tc.want, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	q := Query{Terms: []string{"jogar bola", `diz "oi"`, "a*"}}
+	want := `"jogar bola" "diz ""oi""" "a*"`
+	if got := q.match(); got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
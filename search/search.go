@@ -0,0 +1,55 @@
+// Package search finds messages in the chat history saved for /cask.
+package search
+
+import (
+	"context"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+// PageSize is how many results each page has
+const PageSize = 5
+
+// Service searches the history in the Repo, with the dates at the
+// timezone of the chat.
+type Service struct {
+	Repo     repo.Repo
+	Settings settings.Service
+}
+
+// Page of the results of a search. Page counts from 1.
+type Page struct {
+	Results []repo.MessageResult
+	Page    int
+	Pages   int
+	Total   int
+}
+
+// Search returns the page of the messages of chatID matching q, the newest
+// first.
+func (s Service) Search(ctx context.Context, chatID int64, q Query, page int) (Page, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	results, total, err := s.Repo.SearchMessages(ctx, repo.MessageSearch{
+		ChatID:   chatID,
+		Match:    q.match(),
+		UserName: q.From,
+		After:    q.After,
+		Before:   q.Before,
+		Offset:   (page - 1) * PageSize,
+		Limit:    PageSize,
+	})
+	if err != nil {
+		return Page{}, err
+	}
+
+	return Page{
+		Results: results,
+		Page:    page,
+		Pages:   (total + PageSize - 1) / PageSize,
+		Total:   total,
+	}, nil
+}
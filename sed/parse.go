@@ -0,0 +1,117 @@
+package sed
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// delimiters are the characters that may delimit the parts of a command.
+// Letters and spaces are left out so that text isn't taken for a script.
+const delimiters = "!\"#$%&'()*+,-./:;<=>?@[]^_`{|}~"
+
+// Parse parses a script of s and y commands separated by ; or new lines.
+// s/pattern/replacement/flags takes the flags g, i and a number, to replace
+// from the nth match. Any of the delimiters may take the place of /.
+func Parse(script string) (*Script, error) {
+	s := &Script{}
+	p := parser{runes: []rune(script)}
+
+	for {
+		p.skip(func(r rune) bool { return r == ';' || unicode.IsSpace(r) })
+		if p.done() {
+			break
+		}
+
+		name := p.next()
+		if name != 's' && name != 'y' {
+			return nil, fmt.Errorf("sed: unknown command: `%c'", name)
+		}
+
+		if p.done() {
+			return nil, fmt.Errorf("sed: unterminated `%c' command", name)
+		}
+		delim := p.next()
+		if delim == '\\' || !strings.ContainsRune(delimiters, delim) {
+			return nil, fmt.Errorf("sed: invalid delimiter of `%c': %q", name, delim)
+		}
+
+		first, ok := p.part(delim)
+		if !ok {
+			return nil, fmt.Errorf("sed: unterminated `%c' command", name)
+		}
+		second, ok := p.part(delim)
+		if !ok {
+			return nil, fmt.Errorf("sed: unterminated `%c' command", name)
+		}
+
+		var cmd command
+		var err error
+		if name == 's' {
+			flags := p.skip(func(r rune) bool { return r != ';' && !unicode.IsSpace(r) })
+			cmd, err = newSubstitute(first, second, flags)
+		} else {
+			cmd, err = newTransliterate(first, second)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.cmds = append(s.cmds, cmd)
+
+		p.skip(func(r rune) bool { return r == ' ' || r == '\t' })
+		if !p.done() && p.peek() != ';' && p.peek() != '\n' {
+			return nil, errors.New("sed: extra characters after command")
+		}
+	}
+
+	if len(s.cmds) == 0 {
+		return nil, errors.New("sed: no commands")
+	}
+	return s, nil
+}
+
+type parser struct {
+	runes []rune
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.runes)
+}
+
+func (p *parser) peek() rune {
+	return p.runes[p.pos]
+}
+
+func (p *parser) next() rune {
+	r := p.runes[p.pos]
+	p.pos++
+	return r
+}
+
+// skip skips and returns the runes while match is true
+func (p *parser) skip(match func(r rune) bool) string {
+	start := p.pos
+	for !p.done() && match(p.peek()) {
+		p.pos++
+	}
+	return string(p.runes[start:p.pos])
+}
+
+// part returns the text up to the next delim not escaped, consuming the
+// delim. Escapes are kept, it is false if there is no delim.
+func (p *parser) part(delim rune) (string, bool) {
+	start := p.pos
+	for !p.done() {
+		r := p.next()
+		if r == '\\' && !p.done() {
+			p.next()
+			continue
+		}
+		if r == delim {
+			return string(p.runes[start : p.pos-1]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,245 @@
+// Package sed runs the s and y commands of sed scripts, like
+// "s/isso/aquilo/g; y/abc/xyz/", without the sed binary.
+//
+// The regular expressions have the syntax of Go, which is close to the
+// extended ones of sed -E, and match the leftmost-longest like sed does.
+// As they run in linear time, only the size of the output is limited.
+package sed
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrOutputTooLong is for output longer than the max given to Run
+var ErrOutputTooLong = errors.New("sed: output too long")
+
+// Script is a parsed sed script, see Parse.
+type Script struct {
+	cmds []command
+}
+
+type command interface {
+	// apply is line after the command, or ErrOutputTooLong when longer
+	// than max
+	apply(line string, max int) (string, error)
+}
+
+// Run runs the script on each line of input, like sed does, and returns
+// the lines of the output. It fails with ErrOutputTooLong as soon as the
+// output is longer than max bytes.
+func (s *Script) Run(input string, max int) (string, error) {
+	lines := strings.Split(input, "\n")
+	size := 0
+	for i, line := range lines {
+		for _, cmd := range s.cmds {
+			var err error
+			line, err = cmd.apply(line, max-size)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		lines[i] = line
+		size += len(line) + 1
+	}
+
+	output := strings.Join(lines, "\n")
+	if len(output) > max {
+		return "", ErrOutputTooLong
+	}
+	return output, nil
+}
+
+// substitute is s/re/repl/flags
+type substitute struct {
+	re   *regexp.Regexp
+	repl []replacePart
+	// nth is the first match replaced, from 1
+	nth int
+	// global replaces the matches after the nth too
+	global bool
+}
+
+// replacePart is a literal or, if group >= 0, a group of the match
+type replacePart struct {
+	literal string
+	group   int
+}
+
+func (c substitute) apply(line string, max int) (string, error) {
+	var b strings.Builder
+	last := 0
+	for i, m := range c.re.FindAllStringSubmatchIndex(line, -1) {
+		n := i + 1
+		if n < c.nth {
+			continue
+		}
+		if n > c.nth && !c.global {
+			break
+		}
+
+		b.WriteString(line[last:m[0]])
+		for _, p := range c.repl {
+			if p.group < 0 {
+				b.WriteString(p.literal)
+			} else if start := m[2*p.group]; start >= 0 {
+				b.WriteString(line[start:m[2*p.group+1]])
+			}
+		}
+		last = m[1]
+
+		if b.Len() > max {
+			return "", ErrOutputTooLong
+		}
+	}
+	b.WriteString(line[last:])
+
+	if b.Len() > max {
+		return "", ErrOutputTooLong
+	}
+	return b.String(), nil
+}
+
+// transliterate is y/src/dst/
+type transliterate map[rune]rune
+
+func (c transliterate) apply(line string, max int) (string, error) {
+	output := strings.Map(func(r rune) rune {
+		if to, ok := c[r]; ok {
+			return to
+		}
+		return r
+	}, line)
+
+	if len(output) > max {
+		return "", ErrOutputTooLong
+	}
+	return output, nil
+}
+
+// newSubstitute compiles the parts of s/pattern/replacement/flags
+func newSubstitute(pattern, replacement, flags string) (substitute, error) {
+	c := substitute{nth: 1}
+	nth := ""
+	prefix := ""
+	for _, f := range flags {
+		switch {
+		case f == 'g':
+			c.global = true
+		case f == 'i' || f == 'I':
+			prefix = "(?i)"
+		case f >= '0' && f <= '9':
+			nth += string(f)
+		default:
+			return c, fmt.Errorf("sed: unknown option to `s': %q", f)
+		}
+	}
+	if nth != "" {
+		_, err := fmt.Sscan(nth, &c.nth)
+		if err != nil || c.nth == 0 {
+			return c, fmt.Errorf("sed: invalid number option to `s': %s", nth)
+		}
+	}
+
+	re, err := regexp.Compile(prefix + pattern)
+	if err != nil {
+		return c, fmt.Errorf("sed: %w", err)
+	}
+	re.Longest()
+	c.re = re
+
+	c.repl, err = parseReplacement(replacement, re.NumSubexp())
+	return c, err
+}
+
+// parseReplacement parses the replacement of s, where & is the match,
+// \1 to \9 are its groups and \n is a new line.
+func parseReplacement(s string, groups int) ([]replacePart, error) {
+	parts := []replacePart{}
+	literal := strings.Builder{}
+	group := func(n int) {
+		if literal.Len() > 0 {
+			parts = append(parts, replacePart{literal: literal.String(), group: -1})
+			literal.Reset()
+		}
+		parts = append(parts, replacePart{group: n})
+	}
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '&' {
+			group(0)
+			continue
+		}
+		if r != '\\' {
+			literal.WriteRune(r)
+			continue
+		}
+
+		i++
+		if i == len(runes) {
+			return nil, errors.New("sed: trailing backslash on `s' replacement")
+		}
+		switch r = runes[i]; {
+		case r >= '0' && r <= '9':
+			n := int(r - '0')
+			if n > groups {
+				return nil, fmt.Errorf("sed: invalid reference \\%d on `s' command's RHS", n)
+			}
+			group(n)
+		case r == 'n':
+			literal.WriteRune('\n')
+		case r == 't':
+			literal.WriteRune('\t')
+		default:
+			// \&, \\ and the escaped delimiter
+			literal.WriteRune(r)
+		}
+	}
+
+	if literal.Len() > 0 {
+		parts = append(parts, replacePart{literal: literal.String(), group: -1})
+	}
+	return parts, nil
+}
+
+// newTransliterate maps each character of src to the one of dst at the
+// same position
+func newTransliterate(src, dst string) (transliterate, error) {
+	from := unescape(src)
+	to := unescape(dst)
+	if len(from) != len(to) {
+		return nil, errors.New("sed: strings for `y' command are different lengths")
+	}
+
+	c := transliterate{}
+	for i, r := range from {
+		c[r] = to[i]
+	}
+	return c, nil
+}
+
+// unescape is s without the backslashes, with \n as a new line
+func unescape(s string) []rune {
+	runes := []rune{}
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped && r == 'n':
+			runes = append(runes, '\n')
+		case escaped && r == 't':
+			runes = append(runes, '\t')
+		case !escaped && r == '\\':
+			escaped = true
+			continue
+		default:
+			runes = append(runes, r)
+		}
+		escaped = false
+	}
+	return runes
+}
@@ -0,0 +1,106 @@
+package sed
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		script string
+		input  string
+		want   string
+	}{
+		{"s/isso/aquilo/", "isso e isso", "aquilo e isso"},
+		{"s/isso/aquilo/g", "isso e isso", "aquilo e aquilo"},
+		{"s/ISSO/aquilo/i", "Isso e isso", "aquilo e isso"},
+		{"s/a/x/2", "aaaa", "axaa"},
+		{"s/a/x/2g", "aaaa", "axxx"},
+		{"s/a/x/5", "aaaa", "aaaa"},
+		{"s/(\\w+) (\\w+)/\\2 \\1/", "ola mundo", "mundo ola"},
+		{"s/o+/[&]/g", "foo bo", "f[oo] b[o]"},
+		{"s/o/\\&/", "foo", "f&o"},
+		{"s/ /\\n/g", "a b", "a\nb"},
+		{"s/x*/-/g", "abc", "-a-b-c-"},
+		{"s/a*/x/g", "baaac", "xbxcx"},
+		// leftmost-longest, like sed
+		{"s/a|ab/x/", "abc", "xc"},
+		{"s|/usr|/opt|", "/usr/bin", "/opt/bin"},
+		{"s,a\\,b,x,", "a,b", "x"},
+		{"s#a#\\##", "a", "#"},
+		{"s/\\//-/g", "a/b/c", "a-b-c"},
+		{"s/é/e/g", "café é", "cafe e"},
+		{"y/abc/xyz/", "aabbcc", "xxyyzz"},
+		{"y/áé/ae/", "áé", "ae"},
+		{"y/\\//|/", "a/b", "a|b"},
+		// chained
+		{"s/a/b/; s/b/c/", "a", "c"},
+		{"s/a/b/g;y/b/c/;", "aa", "cc"},
+		{"s/a/b/\ns/b/c/", "a", "c"},
+		// line by line
+		{"s/^/> /", "a\nb", "> a\n> b"},
+		{"s/x/y/", "", ""},
+	} {
+		s, err := Parse(tc.script)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.script, err)
+		}
+		got, err := s.Run(tc.input, 100)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.script, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q on %q - want: %q, got: %q", tc.script, tc.input, tc.want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, script := range []string{
+		"",
+		";",
+		"sim, claro",
+		"s",
+		"s/a/b",
+		"s a b ",
+		"sxaxbx",
+		"s\\a\\b\\",
+		"s/a/b/x",
+		"s/a/b/0",
+		"s/a/b/g c",
+		"s/(a/b/",
+		"s/a/\\1/",
+		"s/a/b\\/",
+		"p",
+		"y/ab/x/",
+	} {
+		_, err := Parse(script)
+		if err == nil {
+			t.Fatalf("%q: want error", script)
+		}
+	}
+}
+
+func TestRunMaxOutput(t *testing.T) {
+	s, err := Parse("s/a/aaaaaaaaaa/g; s/a/aaaaaaaaaa/g; s/a/aaaaaaaaaa/g")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Run("aaaa", 1000)
+	if !errors.Is(err, ErrOutputTooLong) {
+		t.Fatalf("err - want: %v, got: %v", ErrOutputTooLong, err)
+	}
+
+	got, err := s.Run("a\na", 2001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2001 {
+		t.Fatalf("want 2001 bytes, got: %d", len(got))
+	}
+	_, err = s.Run("a\na", 2000)
+	if !errors.Is(err, ErrOutputTooLong) {
+		t.Fatalf("err - want: %v, got: %v", ErrOutputTooLong, err)
+	}
+}
@@ -0,0 +1,157 @@
+package settings
+
+import (
+	"errors"
+	"strings"
+	"time"
+	// the timezones are checked even where the system has no tzdata
+	_ "time/tzdata"
+
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+)
+
+// keys of the features of the bot
+const (
+	CreateTopics = "create_topics"
+	Audio        = "audio"
+	Ask          = "ask"
+	CAsk         = "cask"
+	Sed          = "sed"
+	EditMentions = "edit_mentions"
+)
+
+// keys of the settings of the bot
+const (
+	Timezone       = "timezone"
+	AgendaMax      = "agenda_max"
+	TopicMaxLength = "topic_max_length"
+	AskModel       = "ask_model"
+	AskPrompt      = "ask_prompt"
+	CAskMessages   = "cask_messages"
+	CAskChars      = "cask_chars"
+	EventReminders = "event_reminders"
+)
+
+// New returns the registry with every feature of the bot, all off by
+// default, and every setting.
+func New() *Registry {
+	r := NewRegistry()
+	r.Add(Feature{
+		Key:         CreateTopics,
+		Description: "qualquer um cria tópicos com /suba",
+		Permission:  bh.Admin,
+	})
+	r.Add(Feature{
+		Key:         Audio,
+		Description: "salva e manda áudios com /a e /arand",
+		Permission:  bh.Admin,
+	})
+	r.Add(Feature{
+		Key:         Ask,
+		Description: "responde /ask e as respostas ao bot",
+		Permission:  bh.Admin,
+	})
+	r.Add(Feature{
+		Key:         CAsk,
+		Description: "salva as mensagens do grupo para o /cask",
+		Permission:  bh.Admin,
+	})
+	r.Add(Feature{
+		Key:         Sed,
+		Description: "responde s/isso/aquilo/ nas respostas",
+		Permission:  bh.Admin,
+	})
+	r.Add(Feature{
+		Key:         EditMentions,
+		Description: "chama os inscritos dos #tópicos adicionados ao editar uma mensagem",
+		Permission:  bh.Admin,
+	})
+
+	r.AddSetting(Setting{
+		Key:         Timezone,
+		Description: "fuso horário do grupo",
+		Kind:        KindString,
+		Default:     "America/Sao_Paulo",
+		Validate: func(value string) error {
+			_, err := time.LoadLocation(value)
+			if err != nil || value == "" || value == "Local" {
+				return errors.New("fuso horário inválido, ex: America/Sao_Paulo")
+			}
+			return nil
+		},
+	})
+	r.AddSetting(Setting{
+		Key:         AgendaMax,
+		Description: "o máximo que o /agenda espera quando recebe uma duração",
+		Kind:        KindDuration,
+		Default:     "24h0m0s",
+		MinDuration: time.Hour,
+		MaxDuration: 24 * time.Hour,
+	})
+	r.AddSetting(Setting{
+		Key:         TopicMaxLength,
+		Description: "tamanho máximo dos tópicos",
+		Kind:        KindInt,
+		Default:     "30",
+		Min:         5,
+		Max:         100,
+	})
+	r.AddSetting(Setting{
+		Key:         AskModel,
+		Description: "modelo do gpt no /ask e no /cask",
+		Kind:        KindEnum,
+		Default:     "gpt-3.5-turbo",
+		Options:     []string{"gpt-3.5-turbo", "gpt-4"},
+	})
+	r.AddSetting(Setting{
+		Key:         AskPrompt,
+		Description: "instruções pro gpt no /ask, tipo a personalidade dele",
+		Kind:        KindString,
+		MaxLength:   1000,
+	})
+	r.AddSetting(Setting{
+		Key:         CAskMessages,
+		Description: "quantas mensagens salvas o /cask lê",
+		Kind:        KindInt,
+		Default:     "100",
+		Min:         10,
+		Max:         500,
+	})
+	r.AddSetting(Setting{
+		Key:         CAskChars,
+		Description: "quantos caracteres das mensagens salvas o /cask usa",
+		Kind:        KindInt,
+		Default:     "2000",
+		Min:         500,
+		Max:         8000,
+	})
+	r.AddSetting(Setting{
+		Key:         EventReminders,
+		Description: "quanto tempo antes do /evento lembrar quem vai, separado por vírgula",
+		Kind:        KindString,
+		Default:     "1h",
+		MaxLength:   100,
+		Validate: func(value string) error {
+			_, err := parseDurations(value)
+			return err
+		},
+	})
+	return r
+}
+
+// parseDurations reads a list like "24h,1h", which may be empty.
+func parseDurations(value string) ([]time.Duration, error) {
+	ds := []time.Duration{}
+	if strings.TrimSpace(value) == "" {
+		return ds, nil
+	}
+
+	for _, field := range strings.Split(value, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil || d < time.Minute || d > 7*24*time.Hour {
+			return nil, errors.New("tem que ser durações de 1m a 168h separadas por vírgula (ex: 24h,1h)")
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
@@ -0,0 +1,174 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+)
+
+// Handler shows the features of the chat in /config, with a button to
+// turn each one on or off, and changes the settings with /ajuste.
+type Handler struct {
+	Service Service
+	// Allowed tells if the sender of u has the permission p in the chat.
+	Allowed func(ctx context.Context, s bot.Service, u bot.Update, p bh.Permission) (bool, error)
+}
+
+func (h Handler) Config(ctx context.Context, s bot.Service, u bot.Update) error {
+	text, keyboard, err := h.panel(ctx, u.Message.Chat.ID)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	_, err = s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:                   u.Message.Chat.ID,
+		Text:                     text,
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		ReplyMarkup:              keyboard,
+	})
+	return err
+}
+
+// Toggle handles the buttons of /config, "cfg:toggle:<key>".
+func (h Handler) Toggle(ctx context.Context, s bot.Service, u bot.Update, args bh.CallbackArgs) error {
+	msg := u.CallbackQuery.Message
+	f, ok := h.Service.Registry.Feature(args.String(0))
+	if !ok || msg == nil {
+		return bh.Toast{Text: "opção não encontrada"}
+	}
+
+	allowed, err := h.Allowed(ctx, s, u, f.Permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return bh.Toast{Text: "você não tem permissão para isso"}
+	}
+
+	enabled, err := h.Service.Enabled(ctx, msg.Chat.ID, f.Key)
+	if err != nil {
+		return err
+	}
+	err = h.Service.SetEnabled(ctx, msg.Chat.ID, f.Key, !enabled)
+	if err != nil {
+		return err
+	}
+
+	text, keyboard, err := h.panel(ctx, msg.Chat.ID)
+	if err != nil {
+		return err
+	}
+	_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.MessageID,
+		Text:        text,
+		ReplyMarkup: keyboard,
+	})
+	if err != nil && !errors.Is(err, bot.ErrMessageNotModified) {
+		return err
+	}
+
+	if enabled {
+		return bh.Toast{Text: f.Key + " desativado"}
+	}
+	return bh.Toast{Text: f.Key + " ativado"}
+}
+
+// panel is the text and the buttons of /config for the chat
+func (h Handler) panel(ctx context.Context, chatID int64) (string, *bot.InlineKeyboardMarkup, error) {
+	enabled, err := h.Service.Chat(ctx, chatID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	text := "configurações do grupo:\n"
+	keyboard := &bot.InlineKeyboardMarkup{}
+	for _, f := range h.Service.Registry.Features() {
+		mark := "❌"
+		if enabled[f.Key] {
+			mark = "✅"
+		}
+		text += mark + " " + f.Key + " - " + f.Description + "\n"
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []bot.InlineKeyboardButton{{
+			Text:         mark + " " + f.Key,
+			CallbackData: bh.MustEncodeCallback("cfg:toggle", f.Key),
+		}})
+	}
+	return text, keyboard, nil
+}
+
+// Set handles /ajuste, which lists the settings of the chat, shows one or
+// changes it. The value "padrao" goes back to the default.
+func (h Handler) Set(ctx context.Context, s bot.Service, u bot.Update) error {
+	args := bh.ArgsFrom(ctx)
+	chatID := u.Message.Chat.ID
+
+	key := strings.ToLower(args.Text("chave"))
+	if key == "" {
+		return h.list(ctx, chatID)
+	}
+
+	setting, ok := h.Service.Registry.Setting(key)
+	if !ok {
+		return bh.Reply{Text: "ajuste não encontrado: " + key + "\nveja os ajustes com /ajuste"}
+	}
+
+	var err error
+	switch value := args.Text("valor"); value {
+	case "":
+	case "padrao", "padrão":
+		err = h.Service.Reset(ctx, chatID, key)
+	default:
+		err = h.Service.Set(ctx, chatID, key, value)
+	}
+	var invalid InvalidValueError
+	if errors.As(err, &invalid) {
+		return bh.Reply{Text: "valor inválido, " + invalid.Reason}
+	}
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	value, err := h.Service.Value(ctx, chatID, key)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+	return bh.Reply{
+		Text: fmt.Sprintf("%s = %s\n%s\n%s, padrão: %s", key, display(value), setting.Description, setting.Help(), display(setting.Default)),
+	}
+}
+
+func (h Handler) list(ctx context.Context, chatID int64) error {
+	text := "ajustes do grupo:\n"
+	for _, setting := range h.Service.Registry.Settings() {
+		value, err := h.Service.Value(ctx, chatID, setting.Key)
+		if err != nil {
+			log.Print(err)
+			return bh.Reply{Text: "vish deu ruim"}
+		}
+
+		if runes := []rune(value); len(runes) > 30 {
+			value = string(runes[:30]) + "…"
+		}
+		text += fmt.Sprintf("%s = %s - %s\n", setting.Key, display(value), setting.Description)
+	}
+	text += "\nmuda com /ajuste <chave> <valor>, volta pro padrão com /ajuste <chave> padrao"
+	return bh.Reply{Text: text}
+}
+
+// display shows empty values
+func display(value string) string {
+	if value == "" {
+		return "(vazio)"
+	}
+	return value
+}
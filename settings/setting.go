@@ -0,0 +1,118 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrUnknownSetting = errors.New("unknown setting")
+
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindDuration
+	// KindEnum is one of the Options
+	KindEnum
+)
+
+// Setting is a value of the bot each chat may change, stored as text
+// under Key.
+type Setting struct {
+	Key         string
+	Description string
+	Kind        Kind
+	Default     string
+	// Options are the values of a KindEnum.
+	Options []string
+	// Min and Max bound a KindInt.
+	Min, Max int
+	// MinDuration and MaxDuration bound a KindDuration.
+	MinDuration, MaxDuration time.Duration
+	// MaxLength bounds a KindString, in characters. Zero is no limit.
+	MaxLength int
+	// Validate checks what the kind can't, returning the reason shown to
+	// the user.
+	Validate func(value string) error
+}
+
+// InvalidValueError tells the user why a value was refused.
+type InvalidValueError struct {
+	Key    string
+	Reason string
+}
+
+func (e InvalidValueError) Error() string {
+	return e.Key + ": " + e.Reason
+}
+
+// Parse checks value and returns it the way it is stored.
+func (s Setting) Parse(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	invalid := func(format string, args ...any) error {
+		return InvalidValueError{Key: s.Key, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	switch s.Kind {
+	case KindString:
+		if s.MaxLength > 0 && utf8.RuneCountInString(value) > s.MaxLength {
+			return "", invalid("máximo de %d caracteres", s.MaxLength)
+		}
+
+	case KindInt:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < s.Min || n > s.Max {
+			return "", invalid("tem que ser um número de %d a %d", s.Min, s.Max)
+		}
+		value = strconv.Itoa(n)
+
+	case KindDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < s.MinDuration || d > s.MaxDuration {
+			return "", invalid("tem que ser uma duração de %s a %s (ex: 1h30m)", s.MinDuration, s.MaxDuration)
+		}
+		value = d.String()
+
+	case KindEnum:
+		found := false
+		for _, opt := range s.Options {
+			if strings.EqualFold(opt, value) {
+				value = opt
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", invalid("opções: %s", strings.Join(s.Options, ", "))
+		}
+	}
+
+	if s.Validate != nil {
+		err := s.Validate(value)
+		if err != nil {
+			return "", invalid("%s", err.Error())
+		}
+	}
+	return value, nil
+}
+
+// Help describes the values accepted.
+func (s Setting) Help() string {
+	switch s.Kind {
+	case KindInt:
+		return fmt.Sprintf("número de %d a %d", s.Min, s.Max)
+	case KindDuration:
+		return fmt.Sprintf("duração de %s a %s", s.MinDuration, s.MaxDuration)
+	case KindEnum:
+		return "opções: " + strings.Join(s.Options, ", ")
+	}
+	if s.MaxLength > 0 {
+		return fmt.Sprintf("texto de até %d caracteres", s.MaxLength)
+	}
+	return "texto"
+}
@@ -0,0 +1,224 @@
+// Package settings stores the switches each chat turns on and off, like
+// whether /ask is answered.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+var ErrUnknownFeature = errors.New("unknown feature")
+
+// Feature is a switch of the bot, stored per chat under Key.
+type Feature struct {
+	Key         string
+	Description string
+	Default     bool
+	// Permission needed to turn it on or off.
+	Permission bh.Permission
+}
+
+// Registry holds the features and the settings in the order they are
+// shown to the users. Both are stored under their keys, so a key is either
+// a feature or a setting.
+type Registry struct {
+	features []Feature
+	settings []Setting
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add panics if the key is taken or can't be part of a callback_data.
+func (r *Registry) Add(f Feature) {
+	r.checkKey(f.Key)
+	r.features = append(r.features, f)
+}
+
+// AddSetting panics if the key is taken or the default is not valid.
+func (r *Registry) AddSetting(s Setting) {
+	r.checkKey(s.Key)
+	if _, err := s.Parse(s.Default); err != nil {
+		panic(fmt.Sprintf("settings: invalid default of %q: %v", s.Key, err))
+	}
+	r.settings = append(r.settings, s)
+}
+
+func (r *Registry) checkKey(key string) {
+	if key == "" || strings.ContainsAny(key, ": \t\n") {
+		panic(fmt.Sprintf("settings: invalid key %q", key))
+	}
+	_, isFeature := r.Feature(key)
+	_, isSetting := r.Setting(key)
+	if isFeature || isSetting {
+		panic(fmt.Sprintf("settings: key %q added twice", key))
+	}
+}
+
+func (r *Registry) Feature(key string) (Feature, bool) {
+	for _, f := range r.features {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Feature{}, false
+}
+
+func (r *Registry) Features() []Feature {
+	return append([]Feature(nil), r.features...)
+}
+
+func (r *Registry) Setting(key string) (Setting, bool) {
+	for _, s := range r.settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+func (r *Registry) Settings() []Setting {
+	return append([]Setting(nil), r.settings...)
+}
+
+// Service reads and changes the features and the settings of the chats.
+type Service struct {
+	Repo     repo.Repo
+	Registry *Registry
+}
+
+// Enabled tells if the feature is on in chatID, which is its default until
+// someone changes it.
+func (s Service) Enabled(ctx context.Context, chatID int64, key string) (bool, error) {
+	f, ok := s.Registry.Feature(key)
+	if !ok {
+		return false, ErrUnknownFeature
+	}
+
+	value, err := s.Repo.FindChatSetting(ctx, chatID, key)
+	if errors.Is(err, repo.ErrNotFound) {
+		return f.Default, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(value)
+}
+
+func (s Service) SetEnabled(ctx context.Context, chatID int64, key string, enabled bool) error {
+	if _, ok := s.Registry.Feature(key); !ok {
+		return ErrUnknownFeature
+	}
+	return s.Repo.SaveChatSetting(ctx, chatID, key, strconv.FormatBool(enabled))
+}
+
+// Chat returns whether each feature is on in chatID.
+func (s Service) Chat(ctx context.Context, chatID int64) (map[string]bool, error) {
+	values, err := s.Repo.FindChatSettings(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := map[string]bool{}
+	for _, f := range s.Registry.Features() {
+		enabled[f.Key] = f.Default
+		value, ok := values[f.Key]
+		if !ok {
+			continue
+		}
+		enabled[f.Key], err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("setting %s: %w", f.Key, err)
+		}
+	}
+	return enabled, nil
+}
+
+// Value returns the setting of chatID, or its default when never set or no
+// longer valid.
+func (s Service) Value(ctx context.Context, chatID int64, key string) (string, error) {
+	setting, ok := s.Registry.Setting(key)
+	if !ok {
+		return "", ErrUnknownSetting
+	}
+
+	value, err := s.Repo.FindChatSetting(ctx, chatID, key)
+	if errors.Is(err, repo.ErrNotFound) {
+		return setting.Default, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value, err = setting.Parse(value)
+	if err != nil {
+		log.Printf("chat %d: %v, using the default", chatID, err)
+		return setting.Default, nil
+	}
+	return value, nil
+}
+
+func (s Service) Int(ctx context.Context, chatID int64, key string) (int, error) {
+	value, err := s.Value(ctx, chatID, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+func (s Service) Duration(ctx context.Context, chatID int64, key string) (time.Duration, error) {
+	value, err := s.Value(ctx, chatID, key)
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(value)
+}
+
+// Durations reads a setting with a list of durations, like "24h,1h".
+func (s Service) Durations(ctx context.Context, chatID int64, key string) ([]time.Duration, error) {
+	value, err := s.Value(ctx, chatID, key)
+	if err != nil {
+		return nil, err
+	}
+	return parseDurations(value)
+}
+
+// Location is the timezone of chatID.
+func (s Service) Location(ctx context.Context, chatID int64) (*time.Location, error) {
+	value, err := s.Value(ctx, chatID, Timezone)
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(value)
+}
+
+// Set returns an InvalidValueError if value is not accepted by the setting.
+func (s Service) Set(ctx context.Context, chatID int64, key string, value string) error {
+	setting, ok := s.Registry.Setting(key)
+	if !ok {
+		return ErrUnknownSetting
+	}
+
+	value, err := setting.Parse(value)
+	if err != nil {
+		return err
+	}
+	return s.Repo.SaveChatSetting(ctx, chatID, key, value)
+}
+
+// Reset makes the setting of chatID follow the default again.
+func (s Service) Reset(ctx context.Context, chatID int64, key string) error {
+	if _, ok := s.Registry.Setting(key); !ok {
+		return ErrUnknownSetting
+	}
+	return s.Repo.DeleteChatSetting(ctx, chatID, key)
+}
@@ -0,0 +1,219 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo/sqlitetest"
+)
+
+func newService(t *testing.T) Service {
+	t.Helper()
+
+	r := sqlitetest.Open(t)
+
+	features := NewRegistry()
+	features.Add(Feature{Key: "off"})
+	features.Add(Feature{Key: "on", Default: true})
+	return Service{Repo: r, Registry: features}
+}
+
+func TestEnabled(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+
+	for key, want := range map[string]bool{"off": false, "on": true} {
+		got, err := s.Enabled(ctx, -1, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("%s default - want: %v, got: %v", key, want, got)
+		}
+	}
+
+	err := s.SetEnabled(ctx, -1, "off", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetEnabled(ctx, -1, "on", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chat, err := s.Chat(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chat["off"] || chat["on"] {
+		t.Fatalf("want off enabled and on disabled, got: %v", chat)
+	}
+
+	// other chats keep the defaults
+	chat, err = s.Chat(ctx, -2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat["off"] || !chat["on"] {
+		t.Fatalf("want defaults, got: %v", chat)
+	}
+}
+
+func TestUnknownFeature(t *testing.T) {
+	s := newService(t)
+
+	_, err := s.Enabled(context.TODO(), -1, "nope")
+	if !errors.Is(err, ErrUnknownFeature) {
+		t.Fatalf("err - want: %v, got: %v", ErrUnknownFeature, err)
+	}
+
+	err = s.SetEnabled(context.TODO(), -1, "nope", true)
+	if !errors.Is(err, ErrUnknownFeature) {
+		t.Fatalf("err - want: %v, got: %v", ErrUnknownFeature, err)
+	}
+}
+
+func TestRegistryAddInvalid(t *testing.T) {
+	for _, f := range []Feature{{Key: ""}, {Key: "a:b"}, {Key: Ask}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("want panic adding %q", f.Key)
+				}
+			}()
+			New().Add(f)
+		}()
+	}
+}
+
+func TestSettingParse(t *testing.T) {
+	for _, tc := range []struct {
+		setting Setting
+		value   string
+		want    string
+		invalid bool
+	}{
+		{Setting{Kind: KindString, MaxLength: 3}, " abc ", "abc", false},
+		{Setting{Kind: KindString, MaxLength: 3}, "abcd", "", true},
+		{Setting{Kind: KindInt, Min: 1, Max: 10}, "007", "7", false},
+		{Setting{Kind: KindInt, Min: 1, Max: 10}, "11", "", true},
+		{Setting{Kind: KindInt, Min: 1, Max: 10}, "dez", "", true},
+		{Setting{Kind: KindDuration, MinDuration: time.Minute, MaxDuration: time.Hour}, "90s", "1m30s", false},
+		{Setting{Kind: KindDuration, MinDuration: time.Minute, MaxDuration: time.Hour}, "2h", "", true},
+		{Setting{Kind: KindEnum, Options: []string{"gpt-4"}}, "GPT-4", "gpt-4", false},
+		{Setting{Kind: KindEnum, Options: []string{"gpt-4"}}, "gpt-5", "", true},
+	} {
+		got, err := tc.setting.Parse(tc.value)
+		var invalid InvalidValueError
+		if tc.invalid != errors.As(err, &invalid) {
+			t.Fatalf("%q - want invalid: %v, got: %v", tc.value, tc.invalid, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%q - want: %q, got: %q", tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestSettingValues(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+	s.Registry = New()
+
+	n, err := s.Int(ctx, -1, CAskMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("default - want: %d, got: %d", 100, n)
+	}
+
+	err = s.Set(ctx, -1, CAskMessages, "1000")
+	var invalid InvalidValueError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("want invalid value, got: %v", err)
+	}
+
+	err = s.Set(ctx, -1, CAskMessages, "50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = s.Int(ctx, -1, CAskMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 50 {
+		t.Fatalf("want: %d, got: %d", 50, n)
+	}
+
+	err = s.Reset(ctx, -1, CAskMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = s.Int(ctx, -1, CAskMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("reset - want: %d, got: %d", 100, n)
+	}
+
+	// stored values no longer valid fall back to the default
+	err = s.Repo.SaveChatSetting(ctx, -1, CAskMessages, "100000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = s.Int(ctx, -1, CAskMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("invalid stored - want: %d, got: %d", 100, n)
+	}
+
+	err = s.Set(ctx, -1, Timezone, "Marte/Olympus")
+	if !errors.As(err, &invalid) {
+		t.Fatalf("want invalid timezone, got: %v", err)
+	}
+	err = s.Set(ctx, -1, Timezone, "America/Recife")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, err := s.Location(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.String() != "America/Recife" {
+		t.Fatalf("want: America/Recife, got: %s", loc)
+	}
+
+	err = s.Set(ctx, -1, EventReminders, "24h,30s")
+	if !errors.As(err, &invalid) {
+		t.Fatalf("want invalid reminders, got: %v", err)
+	}
+	err = s.Set(ctx, -1, EventReminders, "24h, 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := s.Durations(ctx, -1, EventReminders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0] != 24*time.Hour || ds[1] != time.Hour {
+		t.Fatalf("want: [24h 1h], got: %v", ds)
+	}
+	err = s.Set(ctx, -1, EventReminders, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err = s.Durations(ctx, -1, EventReminders)
+	if err != nil || len(ds) != 0 {
+		t.Fatalf("want no reminders, got: %v (%v)", ds, err)
+	}
+
+	_, err = s.Value(ctx, -1, Ask)
+	if !errors.Is(err, ErrUnknownSetting) {
+		t.Fatalf("feature as setting - want: %v, got: %v", ErrUnknownSetting, err)
+	}
+}
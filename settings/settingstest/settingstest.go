@@ -0,0 +1,19 @@
+// Package settingstest gives the tests of the packages that use the
+// settings a service over a migrated in-memory database.
+package settingstest
+
+import (
+	"testing"
+
+	"github.com/igoracmelo/euperturbot/repo/sqliterepo/sqlitetest"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+// New returns the settings of every feature of the bot over an empty repo,
+// which is its Repo, closed when the test ends.
+func New(t testing.TB) settings.Service {
+	t.Helper()
+
+	r := sqlitetest.Open(t)
+	return settings.Service{Repo: r, Registry: settings.New()}
+}
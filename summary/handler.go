@@ -0,0 +1,111 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+// maxText is how much of a summary fits in a message
+const maxText = 4000
+
+// Handler answers /resumo with the Service.
+type Handler struct {
+	Service Service
+}
+
+// Summarize handles /resumo, with the messages of the last hours given or
+// since the message replied. The command needs the cask feature on, as
+// only then the messages are saved.
+func (h Handler) Summarize(ctx context.Context, s bot.Service, u bot.Update) error {
+	chatID := u.Message.Chat.ID
+	now := time.Now()
+	args := bh.ArgsFrom(ctx)
+	var since time.Time
+	switch {
+	case args.Has("janela"):
+		d := args.Duration("janela")
+		if d <= 0 || d > MaxWindow {
+			return bh.Reply{Text: "o resumo vai até " + util.RelativeDuration(MaxWindow) + " atrás"}
+		}
+		since = now.Add(-d)
+	case u.Message.ReplyToMessage != nil:
+		since = time.Unix(u.Message.ReplyToMessage.Date, 0)
+		if now.Sub(since) > MaxWindow {
+			return bh.Reply{Text: "essa mensagem é antiga demais, o resumo vai até " + util.RelativeDuration(MaxWindow) + " atrás"}
+		}
+	default:
+		return bh.Reply{Text: "use /resumo 6h, ou responda à mensagem de onde começar"}
+	}
+
+	msg, err := s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:           chatID,
+		ReplyToMessageID: u.Message.MessageID,
+		Text:             "Carregando...",
+	})
+	if err != nil {
+		return err
+	}
+	edit := func(text string) error {
+		_, err := s.EditMessageText(ctx, bot.EditMessageTextParams{
+			ChatID:    chatID,
+			MessageID: msg.MessageID,
+			Text:      text,
+		})
+		if errors.Is(err, bot.ErrMessageNotModified) {
+			return nil
+		}
+		return err
+	}
+
+	sum, err := h.Service.Summarize(ctx, chatID, since, u.Message.Chat.Name(), func(done, total int) {
+		text := fmt.Sprintf("Carregando... (resumindo parte %d de %d)", done+1, total)
+		if done == total {
+			text = "Carregando... (juntando as partes)"
+		}
+		err := edit(text)
+		if err != nil {
+			log.Print(err)
+		}
+	})
+
+	var rateErr openai.ErrRateLimit
+	switch {
+	case errors.Is(err, ErrNoMessages):
+		return edit("nenhuma mensagem salva nesse período")
+	case errors.As(err, &rateErr):
+		_ = edit(fmt.Sprintf("ignorated kk rate limit, tenta de novo em %ds", int(rateErr)))
+		return err
+	case err != nil:
+		_ = edit("vish deu ruim")
+		return err
+	}
+
+	if sum.Cached {
+		log.Printf("summary of %d messages of chat %d from the cache", sum.Messages, chatID)
+	}
+	return edit(summaryText(sum))
+}
+
+func summaryText(sum Summary) string {
+	text := fmt.Sprintf("📝 resumo de %d %s:\n\n%s", sum.Messages, plural(sum.Messages, "mensagem", "mensagens"), sum.Text)
+	r := []rune(text)
+	if len(r) > maxText {
+		return string(r[:maxText-1]) + "…"
+	}
+	return text
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
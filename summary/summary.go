@@ -0,0 +1,295 @@
+// Package summary writes digests of the chat history saved for /cask, for
+// who missed the conversation.
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+const (
+	// MaxWindow is how far back a summary goes
+	MaxWindow = 48 * time.Hour
+	// MaxMessages summarized at once, the most recent ones
+	MaxMessages = 2000
+	// chunkChars is how much of the history goes in each completion
+	chunkChars = 6000
+	// parallel is how many chunks are summarized at the same time
+	parallel = 4
+	// cacheTTL is how long a summary is reused
+	cacheTTL = 24 * time.Hour
+
+	// Timeout is how long /resumo has to answer. MaxMessages of history
+	// take a few rounds of completions, more than the other commands.
+	Timeout = 10 * time.Minute
+)
+
+var ErrNoMessages = errors.New("no messages to summarize")
+
+// Service summarizes the history in the Repo with OpenAI, with the model
+// and timezone of the chat.
+type Service struct {
+	Repo     repo.Repo
+	OpenAI   openai.Service
+	Settings settings.Service
+}
+
+// Summary of the Messages of a chat. Cached is true when it was written
+// for an earlier request.
+type Summary struct {
+	Text     string
+	Messages int
+	Cached   bool
+}
+
+// Progress is told when done of total parts of the history are
+// summarized. When done == total the parts are being put together.
+type Progress func(done, total int)
+
+// Summarize writes a digest of the messages of chatID since since, grouped
+// by subject. Long histories are summarized in parts, then the parts put
+// together. A summary of the same messages is reused.
+func (s Service) Summarize(ctx context.Context, chatID int64, since time.Time, title string, progress Progress) (Summary, error) {
+	msgs, err := s.Repo.FindMessagesSince(ctx, chatID, since, MaxMessages)
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(msgs) == 0 {
+		return Summary{}, ErrNoMessages
+	}
+
+	key := repo.SummaryKey{
+		ChatID:         chatID,
+		FirstMessageID: msgs[0].ID,
+		LastMessageID:  msgs[len(msgs)-1].ID,
+		Messages:       len(msgs),
+	}
+	cached, err := s.Repo.FindSummary(ctx, key)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return Summary{}, err
+	}
+	if err == nil && time.Since(cached.CreatedAt) < cacheTTL {
+		return Summary{Text: cached.Text, Messages: len(msgs), Cached: true}, nil
+	}
+
+	loc, err := s.Settings.Location(ctx, chatID)
+	if err != nil {
+		return Summary{}, err
+	}
+	model, err := s.Settings.Value(ctx, chatID, settings.AskModel)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	sum := summarizer{openai: s.OpenAI, model: model, title: title}
+	text, err := sum.history(ctx, lines(msgs, loc), progress)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	err = s.Repo.SaveSummary(ctx, repo.Summary{
+		SummaryKey: key,
+		Text:       text,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	err = s.Repo.DeleteSummariesBefore(ctx, time.Now().Add(-cacheTTL))
+	return Summary{Text: text, Messages: len(msgs)}, err
+}
+
+const (
+	digestPrompt = "Abaixo estão as mensagens do chat %s, no formato '<hora> <usuario>: <texto>'. " +
+		"Escreva um resumo delas para quem não acompanhou a conversa. Agrupe por assunto, " +
+		"com um título curto e um parágrafo curto para cada um, dizendo quem participou pelo nome de usuário. " +
+		"Não invente nada que não esteja nas mensagens."
+	partPrompt = "Abaixo está um trecho das mensagens do chat %s, no formato '<hora> <usuario>: <texto>'. " +
+		"Liste os assuntos do trecho e, para cada um, quem participou pelo nome de usuário e o que foi dito de importante. " +
+		"Seja breve e não invente nada que não esteja nas mensagens."
+	reducePrompt = "Abaixo estão resumos de trechos seguidos das mensagens do chat %s. " +
+		"Junte-os em um só resumo para quem não acompanhou a conversa. Agrupe por assunto, " +
+		"com um título curto e um parágrafo curto para cada um, dizendo quem participou pelo nome de usuário. " +
+		"Não invente nada que não esteja nos resumos."
+)
+
+// summarizer does the completions of a summary.
+type summarizer struct {
+	openai openai.Service
+	model  string
+	title  string
+}
+
+// history summarizes the lines of the history in one completion, or in
+// parts put together after.
+func (s summarizer) history(ctx context.Context, lines []string, progress Progress) (string, error) {
+	chunks := chunk(lines, chunkChars)
+	if len(chunks) == 1 {
+		return s.complete(ctx, digestPrompt, chunks[0])
+	}
+
+	parts, err := s.parts(ctx, partPrompt, chunks, progress)
+	if err != nil {
+		return "", err
+	}
+	progress(len(chunks), len(chunks))
+	return s.reduce(ctx, parts)
+}
+
+// reduce puts the summaries of the parts together, in more rounds while
+// they don't fit in one completion.
+func (s summarizer) reduce(ctx context.Context, parts []string) (string, error) {
+	for {
+		chunks := chunk(parts, chunkChars)
+		if len(chunks) == len(parts) && len(parts) > 1 {
+			// the summaries don't get shorter, so they are cut to fit
+			for i, part := range parts {
+				parts[i] = cut(part, chunkChars/len(parts)-1)
+			}
+			chunks = chunk(parts, chunkChars)
+		}
+		if len(chunks) == 1 {
+			return s.complete(ctx, reducePrompt, chunks[0])
+		}
+
+		var err error
+		parts, err = s.parts(ctx, reducePrompt, chunks, func(int, int) {})
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// parts summarizes each of the chunks with prompt, a few at a time, and
+// returns them in order.
+func (s summarizer) parts(ctx context.Context, prompt string, chunks []string, progress Progress) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parts := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+	done := 0
+
+	progress(0, len(chunks))
+	for i, c := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			parts[i], errs[i] = s.complete(ctx, prompt, c)
+			if errs[i] != nil {
+				cancel()
+				return
+			}
+
+			mut.Lock()
+			done++
+			if done < len(chunks) {
+				progress(done, len(chunks))
+			}
+			mut.Unlock()
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	return parts, ctx.Err()
+}
+
+func (s summarizer) complete(ctx context.Context, prompt string, text string) (string, error) {
+	resp, err := s.openai.Completion(ctx, &openai.CompletionParams{
+		Model: s.model,
+		Messages: []openai.Message{
+			{Role: "system", Content: fmt.Sprintf(prompt, s.title)},
+			{Content: text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("completion without choices")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+var (
+	reURL        = regexp.MustCompile(`https?:\/\/\S+`)
+	reMultiSpace = regexp.MustCompile(`\s+`)
+	reLaugh      = regexp.MustCompile(`([kK]{7})[kK]+`)
+)
+
+// lines are the msgs as "15:04 name: text", in loc, without links and
+// long laughs.
+func lines(msgs []repo.Message, loc *time.Location) []string {
+	var lines []string
+	for _, msg := range msgs {
+		text := reURL.ReplaceAllString(msg.Text, "")
+		text = reLaugh.ReplaceAllString(text, "$1")
+		text = strings.TrimSpace(reMultiSpace.ReplaceAllString(text, " "))
+		if text == "" {
+			continue
+		}
+
+		name := msg.UserName
+		if name == "" {
+			name = "?"
+		}
+		lines = append(lines, msg.Date.In(loc).Format("15:04")+" "+name+": "+text)
+	}
+	return lines
+}
+
+// chunk joins lines by newlines in chunks of up to max bytes, cutting the
+// lines longer than max.
+func chunk(lines []string, max int) []string {
+	var chunks []string
+	var cur strings.Builder
+	for _, line := range lines {
+		line = cut(line, max)
+		if cur.Len() > 0 && cur.Len()+1+len(line) > max {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString("\n")
+		}
+		cur.WriteString(line)
+	}
+	if cur.Len() > 0 || len(chunks) == 0 {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
+
+// cut leaves s with up to max bytes, not splitting a rune.
+func cut(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
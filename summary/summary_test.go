@@ -0,0 +1,175 @@
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/openai"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings/settingstest"
+)
+
+// fakeOpenAI answers with the kind of the prompt and how many lines it
+// got, recording the prompts.
+type fakeOpenAI struct {
+	mut     sync.Mutex
+	prompts []string
+}
+
+func (f *fakeOpenAI) Completion(ctx context.Context, params *openai.CompletionParams) (*openai.CompletionResponse, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	prompt := params.Messages[0].Content
+	f.prompts = append(f.prompts, prompt)
+
+	kind := "digest"
+	switch {
+	case strings.HasPrefix(prompt, "Abaixo está um trecho"):
+		kind = "part"
+	case strings.HasPrefix(prompt, "Abaixo estão resumos"):
+		kind = "reduce"
+	}
+	lines := strings.Count(params.Messages[1].Content, "\n") + 1
+	return &openai.CompletionResponse{
+		Choices: []openai.Choice{{Message: openai.Message{Content: fmt.Sprintf("%s of %d", kind, lines)}}},
+	}, nil
+}
+
+func (f *fakeOpenAI) CompletionStream(ctx context.Context, params *openai.CompletionParams, onDelta func(string)) (*openai.CompletionResponse, error) {
+	resp, err := f.Completion(ctx, params)
+	if err == nil {
+		onDelta(resp.Choices[0].Message.Content)
+	}
+	return resp, err
+}
+
+func newService(t *testing.T) (Service, *fakeOpenAI) {
+	t.Helper()
+
+	s := settingstest.New(t)
+
+	ai := &fakeOpenAI{}
+	return Service{
+		Repo:     s.Repo,
+		OpenAI:   ai,
+		Settings: s,
+	}, ai
+}
+
+func saveMessages(t *testing.T, r repo.Repo, since time.Time, texts ...string) {
+	t.Helper()
+
+	for i, text := range texts {
+		err := r.SaveMessage(context.TODO(), repo.Message{
+			ID:       i + 1,
+			ChatID:   -1,
+			Text:     text,
+			Date:     since.Add(time.Duration(i) * time.Minute),
+			UserName: "fulano",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	ctx := context.TODO()
+	s, ai := newService(t)
+	since := time.Now().Add(-time.Hour)
+
+	_, err := s.Summarize(ctx, -1, since, "grupo", func(int, int) {})
+	if !errors.Is(err, ErrNoMessages) {
+		t.Fatalf("want: %v, got: %v", ErrNoMessages, err)
+	}
+
+	saveMessages(t, s.Repo, since, "bom dia", "https://x.com", "bora almoçar?")
+	sum, err := s.Summarize(ctx, -1, since, "grupo", func(int, int) {
+		t.Error("want no progress of one part")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the link is left out
+	want := Summary{Text: "digest of 2", Messages: 3}
+	if sum != want {
+		t.Fatalf("want: %+v, got: %+v", want, sum)
+	}
+
+	// the same messages again
+	sum, err = s.Summarize(ctx, -1, since, "grupo", func(int, int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Cached = true
+	if sum != want || len(ai.prompts) != 1 {
+		t.Fatalf("want the summary cached, got: %+v after %d completions", sum, len(ai.prompts))
+	}
+
+	// without the first message, the summary is another
+	sum, err = s.Summarize(ctx, -1, since.Add(time.Minute), "grupo", func(int, int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Cached || sum.Messages != 2 || len(ai.prompts) != 2 {
+		t.Fatalf("want a new summary, got: %+v after %d completions", sum, len(ai.prompts))
+	}
+}
+
+func TestSummarizeInParts(t *testing.T) {
+	s, ai := newService(t)
+	since := time.Now().Add(-time.Hour)
+
+	// 3 parts of 20 messages
+	texts := make([]string, 60)
+	for i := range texts {
+		texts[i] = strings.Repeat("a", chunkChars/20-len("15:04 fulano: ")-1)
+	}
+	saveMessages(t, s.Repo, since, texts...)
+
+	var progress []string
+	sum, err := s.Summarize(context.TODO(), -1, since, "grupo", func(done, total int) {
+		progress = append(progress, fmt.Sprintf("%d/%d", done, total))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sum.Text != "reduce of 3" {
+		t.Fatalf("want the parts put together, got: %q", sum.Text)
+	}
+	if len(ai.prompts) != 4 {
+		t.Fatalf("want 3 parts and the reduce, got %d completions", len(ai.prompts))
+	}
+	if got := strings.Join(progress, " "); got != "0/3 1/3 2/3 3/3" {
+		t.Fatalf("want the progress of each part, got: %s", got)
+	}
+	if !strings.Contains(ai.prompts[3], "chat grupo") {
+		t.Fatalf("want the chat named, got: %s", ai.prompts[3])
+	}
+}
+
+func TestChunk(t *testing.T) {
+	for _, tc := range []struct {
+		lines []string
+		max   int
+		want  []string
+	}{
+		{nil, 10, []string{""}},
+		{[]string{"abc", "de", "fgh"}, 6, []string{"abc\nde", "fgh"}},
+		{[]string{"abcdefgh", "i"}, 4, []string{"abcd", "i"}},
+		// runes are not split
+		{[]string{"aãé"}, 4, []string{"aã"}},
+	} {
+		got := chunk(tc.lines, tc.max)
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%q by %d: want: %q, got: %q", tc.lines, tc.max, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package topic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+// MaxEventCapacity is the most places an event may have.
+const MaxEventCapacity = 1000
+
+var (
+	ErrEventNotFound = errors.New("event not found")
+	ErrEventClosed   = errors.New("event closed")
+)
+
+// ParseEvent reads what comes after the topic in /evento: when it starts,
+// like "sexta 20h", "amanhã 19:30", "25/12 20h" or just "20h", then
+// optionally the places, like "10 vagas", then the description. The
+// returned event has just these set.
+func ParseEvent(text string, now time.Time, loc *time.Location) (repo.Event, error) {
+	var e repo.Event
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return e, ErrInvalidWhen
+	}
+
+	local := now.In(loc)
+	day := local
+	weekday := time.Weekday(-1)
+	hasDate, hasYear := false, false
+
+	i := 0
+	switch word := strings.ToLower(fields[0]); word {
+	case "hoje":
+		hasDate, hasYear = true, true
+		i++
+	case "amanhã", "amanha":
+		day = local.AddDate(0, 0, 1)
+		hasDate, hasYear = true, true
+		i++
+	default:
+		if d, ok := parseWeekday(word); ok {
+			weekday = d
+			i++
+		} else if d, year, ok := parseDate(word, loc); ok {
+			day = d
+			if !year {
+				day = time.Date(local.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+			}
+			hasDate, hasYear = true, year
+			i++
+		}
+	}
+
+	if i < len(fields) {
+		switch strings.ToLower(fields[i]) {
+		case "às", "as", "a":
+			i++
+		}
+	}
+	if i >= len(fields) {
+		return e, ErrInvalidWhen
+	}
+	hour, minute, ok := parseClock(fields[i])
+	if !ok {
+		return e, ErrInvalidWhen
+	}
+	i++
+
+	e.Time = time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	switch {
+	case weekday >= 0:
+		// the next one, maybe today
+		e.Time = e.Time.AddDate(0, 0, (int(weekday)-int(day.Weekday())+7)%7)
+		if !e.Time.After(now) {
+			e.Time = e.Time.AddDate(0, 0, 7)
+		}
+	case hasDate && !hasYear:
+		if !e.Time.After(now) {
+			e.Time = e.Time.AddDate(1, 0, 0)
+		}
+	case !hasDate:
+		if !e.Time.After(now) {
+			e.Time = e.Time.AddDate(0, 0, 1)
+		}
+	}
+
+	if i+1 < len(fields) {
+		switch strings.ToLower(fields[i+1]) {
+		case "vaga", "vagas":
+			n, err := strconv.Atoi(fields[i])
+			if err != nil || n < 1 || n > MaxEventCapacity {
+				return e, ErrInvalidWhen
+			}
+			e.Capacity = n
+			i += 2
+		}
+	}
+
+	e.Description = strings.Join(fields[i:], " ")
+	return e, nil
+}
+
+// parseDate reads dates like "25/12" or "25/12/2026", telling if the year
+// was given.
+func parseDate(s string, loc *time.Location) (time.Time, bool, bool) {
+	t, err := time.ParseInLocation("2/1/2006", s, loc)
+	if err == nil {
+		return t, true, true
+	}
+	t, err = time.ParseInLocation("2/1", s, loc)
+	if err == nil {
+		return t, false, true
+	}
+	return t, false, false
+}
+
+// parseClock reads times like "20h", "20h30" or "20:30".
+func parseClock(s string) (int, int, bool) {
+	s = strings.Replace(strings.ToLower(s), "h", ":", 1)
+	if strings.HasSuffix(s, ":") {
+		s += "00"
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, false
+	}
+	return t.Hour(), t.Minute(), true
+}
+
+// CreateEvent saves e, open, with its first reminder.
+func (s Service) CreateEvent(ctx context.Context, e repo.Event) (repo.Event, error) {
+	ahead := time.Until(e.Time)
+	if ahead < MinScheduleDelay {
+		return e, ErrScheduleSoon
+	}
+	if ahead > MaxScheduleAhead {
+		return e, ErrScheduleLate
+	}
+
+	var err error
+	e.Status = repo.EventOpen
+	e.NextReminder, err = s.nextReminder(ctx, e, time.Now())
+	if err != nil {
+		return e, err
+	}
+
+	e.ID, err = s.Repo.SaveEvent(ctx, e)
+	return e, err
+}
+
+// SaveEventMessage keeps the message with the answers to e.
+func (s Service) SaveEventMessage(ctx context.Context, e repo.Event, msgID int) (repo.Event, error) {
+	e.MessageID = msgID
+	return e, s.Repo.UpdateEvent(ctx, e)
+}
+
+// FindEvent returns ErrEventNotFound unless id is an event of chatID.
+func (s Service) FindEvent(ctx context.Context, chatID int64, id int64) (repo.Event, error) {
+	e, err := s.Repo.FindEvent(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return repo.Event{}, ErrEventNotFound
+	}
+	if err != nil {
+		return repo.Event{}, err
+	}
+	if e.ChatID != chatID {
+		return repo.Event{}, ErrEventNotFound
+	}
+	return *e, nil
+}
+
+// Answer saves the answer of user to the event, or takes it back when it
+// is the same as before. It returns the answers after it and who left the
+// waitlist because of it.
+func (s Service) Answer(ctx context.Context, e repo.Event, user repo.User, answer string) (Attendance, []repo.User, error) {
+	if e.Status != repo.EventOpen {
+		return Attendance{}, nil, ErrEventClosed
+	}
+
+	before, err := s.Attendance(ctx, e)
+	if err != nil {
+		return Attendance{}, nil, err
+	}
+
+	if before.AnswerOf(user.ID) == answer {
+		err = s.Repo.DeleteEventAnswer(ctx, e.ID, user.ID)
+	} else {
+		err = s.Repo.SaveUser(ctx, user)
+		if err != nil {
+			return Attendance{}, nil, err
+		}
+		err = s.Repo.SaveEventAnswer(ctx, repo.EventAnswer{
+			EventID: e.ID,
+			User:    user,
+			Answer:  answer,
+		})
+	}
+	if err != nil {
+		return Attendance{}, nil, err
+	}
+
+	after, err := s.Attendance(ctx, e)
+	if err != nil {
+		return Attendance{}, nil, err
+	}
+
+	promoted := []repo.User{}
+	for _, u := range after.Going {
+		if u.ID != user.ID && contains(before.Waitlist, u.ID) {
+			promoted = append(promoted, u)
+		}
+	}
+	return after, promoted, nil
+}
+
+// Attendance is the answers to an event. The ones going after the places
+// are taken wait for someone to leave.
+type Attendance struct {
+	Going    []repo.User
+	Waitlist []repo.User
+	Maybe    []repo.User
+	NotGoing []repo.User
+
+	// answers by user
+	answers map[int64]string
+}
+
+func NewAttendance(answers []repo.EventAnswer, capacity int) Attendance {
+	a := Attendance{answers: map[int64]string{}}
+	for _, answer := range answers {
+		a.answers[answer.User.ID] = answer.Answer
+		switch answer.Answer {
+		case repo.AnswerYes:
+			if capacity > 0 && len(a.Going) >= capacity {
+				a.Waitlist = append(a.Waitlist, answer.User)
+			} else {
+				a.Going = append(a.Going, answer.User)
+			}
+		case repo.AnswerMaybe:
+			a.Maybe = append(a.Maybe, answer.User)
+		case repo.AnswerNo:
+			a.NotGoing = append(a.NotGoing, answer.User)
+		}
+	}
+	return a
+}
+
+// AnswerOf is the answer of userID, empty if none.
+func (a Attendance) AnswerOf(userID int64) string {
+	return a.answers[userID]
+}
+
+// Waiting tells if userID is in the waitlist.
+func (a Attendance) Waiting(userID int64) bool {
+	return contains(a.Waitlist, userID)
+}
+
+func (s Service) Attendance(ctx context.Context, e repo.Event) (Attendance, error) {
+	answers, err := s.Repo.FindEventAnswers(ctx, e.ID)
+	if err != nil {
+		return Attendance{}, err
+	}
+	return NewAttendance(answers, e.Capacity), nil
+}
+
+// nextReminder is the first reminder of e after now by the settings of the
+// chat, zero if none is left.
+func (s Service) nextReminder(ctx context.Context, e repo.Event, now time.Time) (time.Time, error) {
+	offsets, err := s.Settings.Durations(ctx, e.ChatID, settings.EventReminders)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, d := range offsets {
+		at := e.Time.Add(-d)
+		if at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next, nil
+}
+
+// remind mentions the ones going to e, which starts after now.
+func (s Service) remind(ctx context.Context, b bot.Service, e repo.Event, now time.Time) error {
+	attendance, err := s.Attendance(ctx, e)
+	if err != nil {
+		return err
+	}
+	if len(attendance.Going) == 0 {
+		return nil
+	}
+
+	_, err = b.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:                   e.ChatID,
+		Text:                     "⏰ " + eventTitle(e) + " começa em " + util.RelativeDuration(e.Time.Sub(now).Round(time.Minute)),
+		ReplyToMessageID:         e.MessageID,
+		AllowSendingWithoutReply: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, text := range Mentions(attendance.Going) {
+		_, err = b.SendMessage(ctx, bot.SendMessageParams{
+			ChatID:                   e.ChatID,
+			Text:                     text,
+			ReplyToMessageID:         e.MessageID,
+			AllowSendingWithoutReply: true,
+			ParseMode:                "MarkdownV2",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeEvent stops the answers to e, which started. Its message may be
+// gone, then it is just closed.
+func (s Service) closeEvent(ctx context.Context, b bot.Service, e repo.Event) (repo.Event, error) {
+	e.Status = repo.EventClosed
+	e.NextReminder = time.Time{}
+
+	attendance, err := s.Attendance(ctx, e)
+	if err != nil {
+		return e, err
+	}
+	loc, err := s.Settings.Location(ctx, e.ChatID)
+	if err != nil {
+		return e, err
+	}
+
+	// without the buttons
+	_, err = b.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:    e.ChatID,
+		MessageID: e.MessageID,
+		Text:      eventText(e, attendance, loc),
+	})
+	if err != nil && !errors.Is(err, bot.ErrMessageNotModified) {
+		log.Printf("event %d: closing: %v", e.ID, err)
+	}
+	return e, ctx.Err()
+}
+
+// eventTitle is like "#futebol - pelada no parque"
+func eventTitle(e repo.Event) string {
+	if e.Description == "" {
+		return e.Topic
+	}
+	return e.Topic + " - " + e.Description
+}
+
+// eventText is the message of e with its answers
+func eventText(e repo.Event, a Attendance, loc *time.Location) string {
+	text := "📅 " + eventTitle(e) + "\n" + formatTime(e.Time, loc)
+	switch {
+	case e.Capacity == 1:
+		text += ", 1 vaga"
+	case e.Capacity > 1:
+		text += fmt.Sprintf(", %d vagas", e.Capacity)
+	}
+	text += "\n\n"
+
+	if e.Capacity > 0 {
+		text += fmt.Sprintf("vou (%d/%d):\n", len(a.Going), e.Capacity)
+	} else {
+		text += fmt.Sprintf("vou (%d):\n", len(a.Going))
+	}
+	text += userList(a.Going)
+
+	for _, group := range []struct {
+		name  string
+		users []repo.User
+	}{
+		{"lista de espera", a.Waitlist},
+		{"talvez", a.Maybe},
+		{"não vou", a.NotGoing},
+	} {
+		if len(group.users) > 0 {
+			text += fmt.Sprintf("%s (%d):\n", group.name, len(group.users))
+			text += userList(group.users)
+		}
+	}
+
+	if e.Status == repo.EventClosed {
+		text += "\nencerrado"
+	}
+	return text
+}
+
+func userList(users []repo.User) string {
+	text := ""
+	for _, u := range users {
+		text += "- " + u.Name() + "\n"
+	}
+	return text
+}
+
+// eventKeyboard has the buttons to answer e, "evt:rsvp:<id>:<answer>"
+func eventKeyboard(e repo.Event) *bot.InlineKeyboardMarkup {
+	return &bot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]bot.InlineKeyboardButton{{
+			{Text: "✅ vou", CallbackData: bh.MustEncodeCallback("evt:rsvp", e.ID, repo.AnswerYes)},
+			{Text: "🤔 talvez", CallbackData: bh.MustEncodeCallback("evt:rsvp", e.ID, repo.AnswerMaybe)},
+			{Text: "❌ não vou", CallbackData: bh.MustEncodeCallback("evt:rsvp", e.ID, repo.AnswerNo)},
+		}},
+	}
+}
+
+func contains(users []repo.User, id int64) bool {
+	for _, u := range users {
+		if u.ID == id {
+			return true
+		}
+	}
+	return false
+}
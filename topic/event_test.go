@@ -0,0 +1,153 @@
+package topic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+)
+
+func TestParseEvent(t *testing.T) {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a sunday
+	now := time.Date(2026, 10, 18, 15, 0, 0, 0, loc)
+
+	for _, tc := range []struct {
+		text        string
+		at          time.Time
+		capacity    int
+		description string
+	}{
+		{"sexta 20h pelada no parque", time.Date(2026, 10, 23, 20, 0, 0, 0, loc), 0, "pelada no parque"},
+		{"sexta-feira às 20h30", time.Date(2026, 10, 23, 20, 30, 0, 0, loc), 0, ""},
+		// today is sunday
+		{"domingo 16:00 churras", time.Date(2026, 10, 18, 16, 0, 0, 0, loc), 0, "churras"},
+		{"domingo 14:00 churras", time.Date(2026, 10, 25, 14, 0, 0, 0, loc), 0, "churras"},
+		{"hoje 19h", time.Date(2026, 10, 18, 19, 0, 0, 0, loc), 0, ""},
+		{"amanhã 8h 10 vagas corrida", time.Date(2026, 10, 19, 8, 0, 0, 0, loc), 10, "corrida"},
+		{"25/12 20h ceia", time.Date(2026, 12, 25, 20, 0, 0, 0, loc), 0, "ceia"},
+		{"1/1 0h", time.Date(2027, 1, 1, 0, 0, 0, 0, loc), 0, ""},
+		{"2/11/2026 19h 1 vaga", time.Date(2026, 11, 2, 19, 0, 0, 0, loc), 1, ""},
+		{"10h café", time.Date(2026, 10, 19, 10, 0, 0, 0, loc), 0, "café"},
+		{"18h 5 pessoas", time.Date(2026, 10, 18, 18, 0, 0, 0, loc), 0, "5 pessoas"},
+	} {
+		e, err := ParseEvent(tc.text, now, loc)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.text, err)
+		}
+		if !e.Time.Equal(tc.at) || e.Capacity != tc.capacity || e.Description != tc.description {
+			t.Fatalf("%q - want: %s, %d, %q, got: %s, %d, %q", tc.text, tc.at, tc.capacity, tc.description, e.Time, e.Capacity, e.Description)
+		}
+	}
+
+	for _, text := range []string{"", "sexta", "sexta pelada", "amanhã 25h", "sexta 20h 0 vagas"} {
+		_, err := ParseEvent(text, now, loc)
+		if !errors.Is(err, ErrInvalidWhen) {
+			t.Fatalf("%q - err want: %v, got: %v", text, ErrInvalidWhen, err)
+		}
+	}
+}
+
+func TestEventAnswer(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+
+	e, err := s.CreateEvent(ctx, repo.Event{
+		ChatID:   -1,
+		UserID:   1,
+		Topic:    "#futebol",
+		Time:     time.Now().Add(24 * time.Hour),
+		Capacity: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := repo.User{ID: 1, Username: "alice"}
+	bob := repo.User{ID: 2, Username: "bob"}
+	carol := repo.User{ID: 3, Username: "carol"}
+
+	for _, u := range []repo.User{alice, bob, carol} {
+		_, _, err = s.Answer(ctx, e, u, repo.AnswerYes)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _, err := s.Answer(ctx, e, repo.User{ID: 4, Username: "dave"}, repo.AnswerMaybe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Going) != 2 || !a.Waiting(carol.ID) || len(a.Maybe) != 1 {
+		t.Fatalf("want alice and bob going, carol waiting and dave maybe, got: %+v", a)
+	}
+
+	// bob gives up, carol goes in
+	a, promoted, err := s.Answer(ctx, e, bob, repo.AnswerNo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != 1 || promoted[0].ID != carol.ID {
+		t.Fatalf("want carol promoted, got: %+v", promoted)
+	}
+	if len(a.Going) != 2 || a.AnswerOf(bob.ID) != repo.AnswerNo || len(a.Waitlist) != 0 {
+		t.Fatalf("want alice and carol going, got: %+v", a)
+	}
+
+	// bob changes his mind, goes to the end of the line
+	a, _, err = s.Answer(ctx, e, bob, repo.AnswerYes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Waiting(bob.ID) {
+		t.Fatalf("want bob waiting, got: %+v", a)
+	}
+
+	// the same answer takes it back
+	a, _, err = s.Answer(ctx, e, bob, repo.AnswerYes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.AnswerOf(bob.ID) != "" {
+		t.Fatalf("want bob without answer, got: %+v", a)
+	}
+
+	e.Status = repo.EventClosed
+	_, _, err = s.Answer(ctx, e, bob, repo.AnswerYes)
+	if !errors.Is(err, ErrEventClosed) {
+		t.Fatalf("err - want: %v, got: %v", ErrEventClosed, err)
+	}
+}
+
+func TestEventText(t *testing.T) {
+	e := repo.Event{
+		ID:          1,
+		Topic:       "#futebol",
+		Description: "pelada",
+		Time:        time.Date(2026, 10, 23, 23, 0, 0, 0, time.UTC),
+		Capacity:    1,
+		Status:      repo.EventOpen,
+	}
+	a := NewAttendance([]repo.EventAnswer{
+		{User: repo.User{ID: 1, Username: "alice"}, Answer: repo.AnswerYes},
+		{User: repo.User{ID: 2, FirstName: "Bob"}, Answer: repo.AnswerYes},
+		{User: repo.User{ID: 3, Username: "carol"}, Answer: repo.AnswerNo},
+	}, e.Capacity)
+
+	want := "📅 #futebol - pelada\nsex 23/10 23:00, 1 vaga\n\n" +
+		"vou (1/1):\n- alice\n" +
+		"lista de espera (1):\n- Bob\n" +
+		"não vou (1):\n- carol\n"
+	if got := eventText(e, a, time.UTC); got != want {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+
+	e.Status = repo.EventClosed
+	if got := eventText(e, a, time.UTC); got != want+"\nencerrado" {
+		t.Fatalf("closed - want: %q, got: %q", want+"\nencerrado", got)
+	}
+}
@@ -0,0 +1,589 @@
+package topic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	bh "github.com/igoracmelo/euperturbot/bot/bothandler"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+// Handler answers the topic commands with the Service.
+type Handler struct {
+	Service Service
+	// Dialogs asks what is missing from /agenda, see ScheduleDialog.
+	Dialogs *bh.Dialogs
+	// Allowed tells if the sender of u has the permission p. Admins may
+	// cancel the schedules of others.
+	Allowed func(ctx context.Context, s bot.Service, u bot.Update, p bh.Permission) (bool, error)
+}
+
+// errNotAllowed is for who cancels a schedule of someone else
+var errNotAllowed = errors.New("not allowed")
+
+func (h Handler) Subscribe(ctx context.Context, s bot.Service, u bot.Update) error {
+	args := bh.ArgsFrom(ctx)
+	topics := args.Topics("topicos")
+
+	user := u.Message.From
+	if target := args.User("usuario"); target != nil {
+		if target.ID == 0 {
+			return bh.Reply{Text: "não sei quem é @" + target.Username + ", responda a uma mensagem dele"}
+		}
+		user = target
+	}
+
+	if user.IsBot {
+		return bh.Reply{Text: "nao pode inscrever bot"}
+	}
+
+	admin, err := h.Allowed(ctx, s, u, bh.Admin)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	err = h.Service.Subscribe(ctx, u.Message.Chat.ID, repo.User{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		Username:  user.Username,
+	}, admin, topics...)
+	if errors.Is(err, ErrNewTopic) {
+		return bh.Reply{Text: "só admins criam tópicos novos, ative o create_topics com /config para liberar"}
+	}
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	return bh.Reply{Text: "inscrições adicionadas: " + strings.Join(topics, ", ")}
+}
+
+func (h Handler) Unsubscribe(ctx context.Context, s bot.Service, u bot.Update) error {
+	topics := bh.ArgsFrom(ctx).Topics("topicos")
+
+	_, err := h.Service.Unsubscribe(ctx, u.Message.Chat.ID, u.Message.From.ID, topics...)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	return bh.Reply{Text: "feito meu querido"}
+}
+
+func (h Handler) ListByUser(ctx context.Context, s bot.Service, u bot.Update) error {
+	topics, err := h.Service.UserTopics(ctx, u.Message.Chat.ID, u.Message.From.ID)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	if len(topics) == 0 {
+		return bh.Reply{Text: "voce nao ta inscrito em nenhum topico"}
+	}
+
+	msg := "seus topicos:\n"
+	for _, t := range topics {
+		msg += fmt.Sprintf("(%02d) %s\n", t.Subscribers, t.Topic)
+	}
+	return bh.Reply{Text: msg}
+}
+
+// MentionSubscribers mentions the subscribers of the #topics in a message.
+// Messages without topics with subscribers pass.
+func (h Handler) MentionSubscribers(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+	return h.mentionNew(ctx, s, u.Message)
+}
+
+// MentionEdited mentions the subscribers of the #topics an edit added to a
+// message, when the chat enables it. The ones called before aren't called
+// again.
+func (h Handler) MentionEdited(ctx context.Context, s bot.Service, u bot.Update) (bool, error) {
+	enabled, err := h.Service.Settings.Enabled(ctx, u.EditedMessage.Chat.ID, settings.EditMentions)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, nil
+	}
+	return h.mentionNew(ctx, s, u.EditedMessage)
+}
+
+// mentionNew mentions the subscribers of the topics of msg it didn't call
+// before. They are only known while the chat enables settings.EditMentions,
+// so an edit of a message from before calls all of its topics.
+func (h Handler) mentionNew(ctx context.Context, s bot.Service, msg *bot.Message) (bool, error) {
+	if strings.HasPrefix(msg.Text, "/") {
+		return false, nil
+	}
+	topics := Hashtags(msg.Text)
+	if len(topics) == 0 {
+		return false, nil
+	}
+
+	// the topics called are only kept for the edits to call just the new
+	// ones, so not while the chat doesn't mention on edits
+	record, err := h.Service.Settings.Enabled(ctx, msg.Chat.ID, settings.EditMentions)
+	if err != nil {
+		log.Print(err)
+		return true, bh.Reply{Text: "vish deu ruim"}
+	}
+	if record {
+		topics, err = h.Service.NewTopics(ctx, msg.Chat.ID, msg.MessageID, topics)
+		if err != nil {
+			log.Print(err)
+			return true, bh.Reply{Text: "vish deu ruim"}
+		}
+	}
+	if len(topics) == 0 {
+		return false, nil
+	}
+
+	users, err := h.Service.Subscribers(ctx, msg.Chat.ID, topics...)
+	if err != nil {
+		log.Print(err)
+		return true, bh.Reply{Text: "vish deu ruim"}
+	}
+
+	texts := Mentions(users)
+	if len(texts) == 0 {
+		return false, nil
+	}
+
+	for _, text := range texts[:len(texts)-1] {
+		_, err = s.SendMessage(ctx, bot.SendMessageParams{
+			ChatID:                   msg.Chat.ID,
+			Text:                     text,
+			ReplyToMessageID:         msg.MessageID,
+			AllowSendingWithoutReply: true,
+			ParseMode:                "MarkdownV2",
+		})
+		if err != nil {
+			log.Print(err)
+			return true, bh.Reply{Text: "vish deu ruim"}
+		}
+	}
+
+	return true, bh.Reply{
+		Text:      texts[len(texts)-1],
+		ParseMode: "MarkdownV2",
+	}
+}
+
+// Schedule handles /agenda, starting the dialog when the topic or the
+// time is missing.
+func (h Handler) Schedule(ctx context.Context, s bot.Service, u bot.Update) error {
+	args := bh.ArgsFrom(ctx)
+
+	if !args.Has("topico") || !args.Has("quando") {
+		// ask for what is missing
+		data := map[string]string{}
+		if args.Has("topico") {
+			data["topico"] = args.Topic("topico")
+		}
+		return h.Dialogs.Begin(ctx, s, u, "agenda", data)
+	}
+
+	text, err := h.schedule(ctx, repo.ScheduledTopic{
+		ChatID:    u.Message.Chat.ID,
+		MessageID: u.Message.MessageID,
+		UserID:    u.Message.From.ID,
+		Topic:     args.Topic("topico"),
+	}, args.Text("quando"))
+	if err != nil {
+		return err
+	}
+	return bh.Reply{Text: text}
+}
+
+// schedule saves st at the time users wrote in when, returning what was
+// scheduled. Mistakes of the user are returned as a bh.Reply.
+func (h Handler) schedule(ctx context.Context, st repo.ScheduledTopic, when string) (string, error) {
+	loc, err := h.Service.Settings.Location(ctx, st.ChatID)
+	if err != nil {
+		log.Print(err)
+		return "", bh.Reply{Text: "vish deu ruim"}
+	}
+
+	w, err := ParseWhen(when, time.Now(), loc)
+	if err != nil {
+		return "", bh.Reply{Text: "não entendi quando, manda tipo 1h30m, 25/12 19:00 ou toda sexta 20:00"}
+	}
+
+	if w.Delay != 0 {
+		max, err := h.Service.Settings.Duration(ctx, st.ChatID, settings.AgendaMax)
+		if err != nil {
+			log.Print(err)
+			return "", bh.Reply{Text: "vish deu ruim"}
+		}
+		if w.Delay > max {
+			return "", bh.Reply{Text: "o intervalo maximo eh de " + util.RelativeDuration(max)}
+		}
+	}
+
+	st.Time = w.At
+	if w.Rule != nil {
+		st.Rule = w.Rule.String()
+	}
+
+	st, err = h.Service.Schedule(ctx, st)
+	if errors.Is(err, ErrScheduleSoon) {
+		if w.Delay != 0 {
+			return "", bh.Reply{Text: "o intervalo precisa ser +1min"}
+		}
+		return "", bh.Reply{Text: "essa hora já passou"}
+	}
+	if errors.Is(err, ErrScheduleLate) {
+		return "", bh.Reply{Text: "só dá pra agendar até daqui a um ano"}
+	}
+	if err != nil {
+		log.Print(err)
+		return "", bh.Reply{Text: "vish deu ruim"}
+	}
+
+	switch {
+	case w.Rule != nil:
+		return "agendado " + w.Rule.Describe() + ", a próxima é " + formatTime(st.Time, loc), nil
+	case w.Delay != 0:
+		return "agendado para daqui a " + w.Delay.String(), nil
+	}
+	return "agendado para " + formatTime(st.Time, loc), nil
+}
+
+// ListScheduled handles /agendas, listing the pending schedules of the
+// chat with buttons to cancel them.
+func (h Handler) ListScheduled(ctx context.Context, s bot.Service, u bot.Update) error {
+	text, keyboard, err := h.pending(ctx, u.Message.Chat.ID)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	_, err = s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:                   u.Message.Chat.ID,
+		Text:                     text,
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		ReplyMarkup:              keyboard,
+	})
+	return err
+}
+
+// Unschedule handles /desagenda <id>.
+func (h Handler) Unschedule(ctx context.Context, s bot.Service, u bot.Update) error {
+	id, err := strconv.ParseInt(bh.ArgsFrom(ctx).Text("id"), 10, 64)
+	if err != nil {
+		return bh.Reply{Text: "id inválido, veja os ids com /agendas"}
+	}
+
+	st, err := h.cancel(ctx, s, u, u.Message.Chat.ID, u.Message.From.ID, id)
+	if errors.Is(err, ErrScheduleNotFound) {
+		return bh.Reply{Text: "agenda não encontrada, veja as agendas com /agendas"}
+	}
+	if errors.Is(err, errNotAllowed) {
+		return bh.Reply{Text: "só quem agendou ou um admin pode cancelar"}
+	}
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	return bh.Reply{Text: "agenda cancelada: " + st.Topic}
+}
+
+// CancelButton handles the buttons of /agendas, "sched:cancel:<id>".
+func (h Handler) CancelButton(ctx context.Context, s bot.Service, u bot.Update, args bh.CallbackArgs) error {
+	msg := u.CallbackQuery.Message
+	id, err := args.Int64(0)
+	if err != nil || msg == nil {
+		return bh.Toast{Text: "agenda não encontrada"}
+	}
+
+	st, err := h.cancel(ctx, s, u, msg.Chat.ID, u.CallbackQuery.From.ID, id)
+	if errors.Is(err, ErrScheduleNotFound) {
+		return bh.Toast{Text: "agenda não encontrada"}
+	}
+	if errors.Is(err, errNotAllowed) {
+		return bh.Toast{Text: "só quem agendou ou um admin pode cancelar"}
+	}
+	if err != nil {
+		return err
+	}
+
+	text, keyboard, err := h.pending(ctx, msg.Chat.ID)
+	if err != nil {
+		return err
+	}
+	_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.MessageID,
+		Text:        text,
+		ReplyMarkup: keyboard,
+	})
+	if err != nil && !errors.Is(err, bot.ErrMessageNotModified) {
+		return err
+	}
+
+	return bh.Toast{Text: "agenda cancelada: " + st.Topic}
+}
+
+// cancel stops the schedule id of chatID on behalf of userID, who must be
+// who scheduled it or an admin
+func (h Handler) cancel(ctx context.Context, s bot.Service, u bot.Update, chatID int64, userID int64, id int64) (repo.ScheduledTopic, error) {
+	st, err := h.Service.FindPending(ctx, chatID, id)
+	if err != nil {
+		return st, err
+	}
+
+	if st.UserID != userID {
+		allowed, err := h.Allowed(ctx, s, u, bh.Admin)
+		if err != nil {
+			return st, err
+		}
+		if !allowed {
+			return st, errNotAllowed
+		}
+	}
+
+	return h.Service.Cancel(ctx, chatID, id)
+}
+
+// pending is the text and the buttons of /agendas for the chat
+func (h Handler) pending(ctx context.Context, chatID int64) (string, *bot.InlineKeyboardMarkup, error) {
+	sts, err := h.Service.Pending(ctx, chatID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(sts) == 0 {
+		return "nenhuma agenda pendente", nil, nil
+	}
+
+	loc, err := h.Service.Settings.Location(ctx, chatID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	text := "agendas do grupo:\n"
+	keyboard := &bot.InlineKeyboardMarkup{}
+	for _, st := range sts {
+		text += fmt.Sprintf("(%d) %s - ", st.ID, st.Topic)
+		if rule, err := ParseRule(st.Rule); st.Rule != "" && err == nil {
+			text += rule.Describe() + ", próxima " + formatTime(st.Time, loc) + "\n"
+		} else {
+			text += formatTime(st.Time, loc) + "\n"
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []bot.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("❌ (%d) %s", st.ID, st.Topic),
+			CallbackData: bh.MustEncodeCallback("sched:cancel", st.ID),
+		}})
+	}
+	return text, keyboard, nil
+}
+
+// ScheduleDialog asks for the topic and the time of /agenda when they are
+// missing.
+func (h Handler) ScheduleDialog() bh.Dialog {
+	askWhen := func(ctx context.Context, s bot.Service, c *bh.Conversation) error {
+		c.Next("quando")
+		return c.Ask(ctx, s, "quando? (ex: 1h30m, 25/12 19:00 ou toda sexta 20:00)", "15m", "30m", "1h", "2h", "4h", "8h")
+	}
+
+	return bh.Dialog{
+		Name: "agenda",
+		Steps: map[string]bh.StepFunc{
+			"start": func(ctx context.Context, s bot.Service, u bot.Update, c *bh.Conversation) error {
+				if c.Get("topico") != "" {
+					return askWhen(ctx, s, c)
+				}
+
+				chatTopics, err := h.Service.ChatTopics(ctx, c.ChatID)
+				if err != nil {
+					return err
+				}
+
+				topics := []string{}
+				for i := 0; i < len(chatTopics) && i < 9; i++ {
+					topics = append(topics, chatTopics[i].Topic)
+				}
+
+				c.Next("topico")
+				return c.Ask(ctx, s, "qual tópico? (ou /cancelar)", topics...)
+			},
+			"topico": func(ctx context.Context, s bot.Service, u bot.Update, c *bh.Conversation) error {
+				topic := strings.ToLower(bh.Answer(u))
+				if !reTopic.MatchString(topic) {
+					c.Next("topico")
+					return bh.Reply{Text: "tópico inválido, manda tipo #topico"}
+				}
+
+				c.Set("topico", topic)
+				return askWhen(ctx, s, c)
+			},
+			"quando": func(ctx context.Context, s bot.Service, u bot.Update, c *bh.Conversation) error {
+				text, err := h.schedule(ctx, repo.ScheduledTopic{
+					ChatID:    c.ChatID,
+					MessageID: c.MessageID,
+					UserID:    c.UserID,
+					Topic:     c.Get("topico"),
+				}, bh.Answer(u))
+				if errors.As(err, &bh.Reply{}) {
+					// a mistake, let the user try again
+					c.Next("quando")
+				}
+				if err != nil {
+					return err
+				}
+				return bh.Reply{Text: text}
+			},
+		},
+	}
+}
+
+// Event handles /evento, posting the event for the subscribers of the
+// topic to answer if they go.
+func (h Handler) Event(ctx context.Context, s bot.Service, u bot.Update) error {
+	args := bh.ArgsFrom(ctx)
+	chatID := u.Message.Chat.ID
+
+	loc, err := h.Service.Settings.Location(ctx, chatID)
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	e, err := ParseEvent(args.Text("detalhes"), time.Now(), loc)
+	if err != nil {
+		return bh.Reply{Text: "não entendi, manda tipo /evento #topico sexta 20h 10 vagas pelada no parque"}
+	}
+	e.ChatID = chatID
+	e.UserID = u.Message.From.ID
+	e.Topic = args.Topic("topico")
+
+	e, err = h.Service.CreateEvent(ctx, e)
+	if errors.Is(err, ErrScheduleSoon) {
+		return bh.Reply{Text: "essa hora já passou"}
+	}
+	if errors.Is(err, ErrScheduleLate) {
+		return bh.Reply{Text: "só dá pra marcar até daqui a um ano"}
+	}
+	if err != nil {
+		log.Print(err)
+		return bh.Reply{Text: "vish deu ruim"}
+	}
+
+	msg, err := s.SendMessage(ctx, bot.SendMessageParams{
+		ChatID:                   chatID,
+		Text:                     eventText(e, NewAttendance(nil, e.Capacity), loc),
+		ReplyToMessageID:         u.Message.MessageID,
+		AllowSendingWithoutReply: true,
+		ReplyMarkup:              eventKeyboard(e),
+	})
+	if err != nil {
+		return err
+	}
+	e, err = h.Service.SaveEventMessage(ctx, e, msg.MessageID)
+	if err != nil {
+		return err
+	}
+
+	users, err := h.Service.Subscribers(ctx, chatID, e.Topic)
+	if err != nil {
+		return err
+	}
+	for _, text := range Mentions(users) {
+		_, err = s.SendMessage(ctx, bot.SendMessageParams{
+			ChatID:                   chatID,
+			Text:                     text,
+			ReplyToMessageID:         e.MessageID,
+			AllowSendingWithoutReply: true,
+			ParseMode:                "MarkdownV2",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EventAnswer handles the buttons of /evento, "evt:rsvp:<id>:<answer>".
+func (h Handler) EventAnswer(ctx context.Context, s bot.Service, u bot.Update, args bh.CallbackArgs) error {
+	msg := u.CallbackQuery.Message
+	id, err := args.Int64(0)
+	if err != nil || msg == nil {
+		return bh.Toast{Text: "evento não encontrado"}
+	}
+	answer := args.String(1)
+	switch answer {
+	case repo.AnswerYes, repo.AnswerMaybe, repo.AnswerNo:
+	default:
+		return fmt.Errorf("invalid answer: %q", answer)
+	}
+
+	e, err := h.Service.FindEvent(ctx, msg.Chat.ID, id)
+	if errors.Is(err, ErrEventNotFound) {
+		return bh.Toast{Text: "evento não encontrado"}
+	}
+	if err != nil {
+		return err
+	}
+
+	from := u.CallbackQuery.From
+	attendance, promoted, err := h.Service.Answer(ctx, e, repo.User{
+		ID:        from.ID,
+		FirstName: from.FirstName,
+		Username:  from.Username,
+	}, answer)
+	if errors.Is(err, ErrEventClosed) {
+		return bh.Toast{Text: "esse evento já foi"}
+	}
+	if err != nil {
+		return err
+	}
+
+	loc, err := h.Service.Settings.Location(ctx, e.ChatID)
+	if err != nil {
+		return err
+	}
+	_, err = s.EditMessageText(ctx, bot.EditMessageTextParams{
+		ChatID:      e.ChatID,
+		MessageID:   msg.MessageID,
+		Text:        eventText(e, attendance, loc),
+		ReplyMarkup: eventKeyboard(e),
+	})
+	if err != nil && !errors.Is(err, bot.ErrMessageNotModified) {
+		return err
+	}
+
+	for _, text := range Mentions(promoted) {
+		_, err = s.SendMessage(ctx, bot.SendMessageParams{
+			ChatID:                   e.ChatID,
+			Text:                     "abriu vaga, agora você vai: " + text,
+			ReplyToMessageID:         msg.MessageID,
+			AllowSendingWithoutReply: true,
+			ParseMode:                "MarkdownV2",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case attendance.Waiting(from.ID):
+		return bh.Toast{Text: "lotado, você está na lista de espera"}
+	case attendance.AnswerOf(from.ID) == repo.AnswerYes:
+		return bh.Toast{Text: "você vai"}
+	case attendance.AnswerOf(from.ID) == repo.AnswerMaybe:
+		return bh.Toast{Text: "você talvez vá"}
+	case attendance.AnswerOf(from.ID) == repo.AnswerNo:
+		return bh.Toast{Text: "você não vai"}
+	}
+	return bh.Toast{Text: "resposta removida"}
+}
@@ -0,0 +1,220 @@
+package topic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/util"
+)
+
+// Defaults of the fields of Runner
+const (
+	DefaultInterval    = 10 * time.Second
+	DefaultCatchUp     = 5 * time.Minute
+	DefaultMaxAttempts = 3
+	DefaultRetryDelay  = 30 * time.Second
+)
+
+// Runner sends the scheduled mentions when their time comes. A mention that
+// fails is retried a few times, then given up: mentions that repeat move to
+// their next time and the others are marked failed, with the error kept.
+// It also reminds the ones going to the events, and closes the events that
+// started.
+type Runner struct {
+	Service Service
+	Bot     bot.Service
+	// Interval between the scans for due mentions, DefaultInterval if zero
+	Interval time.Duration
+	// CatchUp is how late a mention is still sent, as when the bot was
+	// down at its time. Later ones are given up. DefaultCatchUp if zero.
+	CatchUp time.Duration
+	// MaxAttempts to send each mention, DefaultMaxAttempts if zero
+	MaxAttempts int
+	// RetryDelay is the wait after the first failed attempt, doubled after
+	// each other. DefaultRetryDelay if zero.
+	RetryDelay time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewRunner(s Service, b bot.Service) *Runner {
+	return &Runner{
+		Service: s,
+		Bot:     b,
+		now:     time.Now,
+		sleep:   util.Sleep,
+	}
+}
+
+// Run sends the due mentions every Interval, until ctx is done.
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		err := r.RunDue(ctx)
+		if err != nil {
+			log.Print(err)
+		}
+
+		if r.sleep(ctx, r.interval()) != nil {
+			return
+		}
+	}
+}
+
+// RunDue sends all the mentions and the reminders due now.
+func (r *Runner) RunDue(ctx context.Context) error {
+	now := r.now()
+	due, err := r.Service.Repo.FindDueScheduledTopics(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, st := range due {
+		err = r.run(ctx, st, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	events, err := r.Service.Repo.FindDueEvents(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		err = r.runEvent(ctx, e, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runEvent closes e if it started, or sends its reminder. Reminders are
+// not retried.
+func (r *Runner) runEvent(ctx context.Context, e repo.Event, now time.Time) error {
+	var err error
+
+	if !e.Time.After(now) {
+		e, err = r.Service.closeEvent(ctx, r.Bot, e)
+		if err != nil {
+			return err
+		}
+		return r.Service.Repo.UpdateEvent(ctx, e)
+	}
+
+	if late := now.Sub(e.NextReminder); late > r.catchUp() {
+		log.Printf("event %d: reminder expired, it was due at %s", e.ID, e.NextReminder)
+	} else if err = r.Service.remind(ctx, r.Bot, e, now); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("event %d: reminder: %v", e.ID, err)
+	}
+
+	e.NextReminder, err = r.Service.nextReminder(ctx, e, now)
+	if err != nil {
+		return err
+	}
+	return r.Service.Repo.UpdateEvent(ctx, e)
+}
+
+// run sends st and saves what comes next for it. A mention that fails after
+// some of its messages were sent is not retried, or they would call the
+// same subscribers again.
+func (r *Runner) run(ctx context.Context, st repo.ScheduledTopic, now time.Time) error {
+	var err error
+	var sent int
+
+	if late := now.Sub(st.Time); late > r.catchUp() {
+		log.Printf("scheduled topic %d expired, it was due at %s", st.ID, st.Time)
+		st.LastError = fmt.Sprintf("expired, it was due %s before", late.Round(time.Second))
+		st, err = r.Service.next(ctx, st, now, true)
+	} else if sent, err = r.Service.mention(ctx, r.Bot, st); err != nil && sent > 0 {
+		log.Printf("scheduled topic %d: sent %d messages, the others failed: %v", st.ID, sent, err)
+		st.LastError = lastError(err)
+		if ctx.Err() != nil {
+			// stopped, but what was sent must be saved
+			ctx = context.Background()
+		}
+		st, err = r.Service.next(ctx, st, now, false)
+	} else if err != nil {
+		if ctx.Err() != nil {
+			// stopped, it is sent on the next run
+			return ctx.Err()
+		}
+		log.Printf("scheduled topic %d: %v", st.ID, err)
+		st, err = r.retry(ctx, st, now, err)
+	} else {
+		st, err = r.Service.next(ctx, st, now, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.Service.Repo.UpdateScheduledTopic(ctx, st)
+}
+
+// retry is st after the attempt at now failed with sendErr. It waits
+// longer after each attempt, unless the chat can't be sent to anymore.
+func (r *Runner) retry(ctx context.Context, st repo.ScheduledTopic, now time.Time, sendErr error) (repo.ScheduledTopic, error) {
+	st.Attempts++
+	st.LastError = lastError(sendErr)
+
+	if st.Attempts >= r.maxAttempts() || permanent(sendErr) {
+		return r.Service.next(ctx, st, now, true)
+	}
+
+	st.Time = now.Add(r.retryDelay() << (st.Attempts - 1))
+	return st, nil
+}
+
+// lastError is what is kept of the error of a mention
+func lastError(err error) string {
+	var botErr bot.BotError
+	if errors.As(err, &botErr) {
+		// just what Telegram said
+		return botErr.Description
+	}
+	return err.Error()
+}
+
+// permanent tells if the error of a mention repeats whatever the attempts
+func permanent(err error) bool {
+	return errors.Is(err, bot.ErrChatNotFound) ||
+		errors.Is(err, bot.ErrBotKicked) ||
+		errors.Is(err, bot.ErrBotBlocked)
+}
+
+func (r *Runner) interval() time.Duration {
+	if r.Interval == 0 {
+		return DefaultInterval
+	}
+	return r.Interval
+}
+
+func (r *Runner) catchUp() time.Duration {
+	if r.CatchUp == 0 {
+		return DefaultCatchUp
+	}
+	return r.CatchUp
+}
+
+func (r *Runner) maxAttempts() int {
+	if r.MaxAttempts == 0 {
+		return DefaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+func (r *Runner) retryDelay() time.Duration {
+	if r.RetryDelay == 0 {
+		return DefaultRetryDelay
+	}
+	return r.RetryDelay
+}
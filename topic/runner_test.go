@@ -0,0 +1,383 @@
+package topic
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot/bottest"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+// newTestRunner returns a runner over a new service whose clock is faked.
+// Sleeping moves the clock.
+func newTestRunner(t *testing.T) (*Runner, *bottest.Server, *time.Time) {
+	t.Helper()
+
+	srv := bottest.NewServer()
+	t.Cleanup(srv.Close)
+
+	now := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	r := NewRunner(newService(t), srv.Service())
+	r.now = func() time.Time {
+		return now
+	}
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	return r, srv, &now
+}
+
+// saveDue saves a mention of #futebol in chat -1 at at, which may be in
+// the past of the fake clock
+func saveDue(t *testing.T, r *Runner, at time.Time, rule string) repo.ScheduledTopic {
+	t.Helper()
+
+	st := repo.ScheduledTopic{
+		ChatID:    -1,
+		MessageID: 10,
+		UserID:    1,
+		Topic:     "#futebol",
+		Rule:      rule,
+		Time:      at,
+	}
+	id, err := r.Service.Repo.SaveScheduledTopic(context.TODO(), st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.ID = id
+	return st
+}
+
+func runDue(t *testing.T, r *Runner) {
+	t.Helper()
+
+	err := r.RunDue(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertSent(t *testing.T, srv *bottest.Server, want int) {
+	t.Helper()
+
+	if got := len(srv.Sent()); got != want {
+		t.Fatalf("want %d messages sent, got: %q", want, srv.SentTexts())
+	}
+}
+
+func TestRunnerMentions(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	subscribe(t, r.Service, 5)
+	st := saveDue(t, r, now.Add(time.Hour), "")
+
+	// not yet
+	runDue(t, r)
+	assertSent(t, srv, 0)
+
+	*now = now.Add(time.Hour)
+	runDue(t, r)
+	assertSent(t, srv, 2)
+	if reply := srv.Sent()[0].ReplyToMessageID; reply != 10 {
+		t.Fatalf("want reply to 10, got: %d", reply)
+	}
+	assertStatus(t, r.Service, st.ID, repo.ScheduledCompleted)
+
+	// mentioned once
+	runDue(t, r)
+	assertSent(t, srv, 2)
+}
+
+func TestRunnerAllDue(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	subscribe(t, r.Service, 1)
+	sts := []repo.ScheduledTopic{
+		saveDue(t, r, now.Add(-3*time.Minute), ""),
+		saveDue(t, r, now.Add(-time.Minute), ""),
+		saveDue(t, r, *now, ""),
+	}
+
+	runDue(t, r)
+	assertSent(t, srv, 3)
+	for _, st := range sts {
+		assertStatus(t, r.Service, st.ID, repo.ScheduledCompleted)
+	}
+}
+
+func TestRunnerCatchUp(t *testing.T) {
+	for _, tc := range []struct {
+		catchUp time.Duration
+		late    time.Duration
+		sent    bool
+	}{
+		{0, DefaultCatchUp, true},
+		{0, DefaultCatchUp + time.Second, false},
+		{time.Hour, 30 * time.Minute, true},
+		{time.Hour, 2 * time.Hour, false},
+	} {
+		r, srv, now := newTestRunner(t)
+		r.CatchUp = tc.catchUp
+
+		subscribe(t, r.Service, 1)
+		st := saveDue(t, r, now.Add(-tc.late), "")
+
+		runDue(t, r)
+		if !tc.sent {
+			assertSent(t, srv, 0)
+			got := assertStatus(t, r.Service, st.ID, repo.ScheduledFailed)
+			if !strings.HasPrefix(got.LastError, "expired") {
+				t.Fatalf("%s late - want expired error, got: %q", tc.late, got.LastError)
+			}
+			continue
+		}
+		assertSent(t, srv, 1)
+		assertStatus(t, r.Service, st.ID, repo.ScheduledCompleted)
+	}
+}
+
+func TestRunnerRetries(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	subscribe(t, r.Service, 1)
+	st := saveDue(t, r, *now, "")
+	srv.Fail("sendMessage", 2, 400, "Bad Request: something went wrong")
+
+	for attempt, wait := range []time.Duration{DefaultRetryDelay, 2 * DefaultRetryDelay} {
+		runDue(t, r)
+		got := assertStatus(t, r.Service, st.ID, repo.ScheduledCreated)
+		if got.Attempts != attempt+1 || got.LastError != "Bad Request: something went wrong" {
+			t.Fatalf("want attempt %d recorded, got: %+v", attempt+1, got)
+		}
+		if want := now.Add(wait); !got.Time.Equal(want) {
+			t.Fatalf("retry time - want: %s, got: %s", want, got.Time)
+		}
+
+		// not before its time
+		runDue(t, r)
+		*now = now.Add(wait)
+	}
+
+	runDue(t, r)
+	assertSent(t, srv, 1)
+	assertStatus(t, r.Service, st.ID, repo.ScheduledCompleted)
+}
+
+func TestRunnerPartialMention(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	subscribe(t, r.Service, 5)
+	st := saveDue(t, r, *now, "")
+	srv.FailAfter("sendMessage", 1, 1, 400, "Bad Request: something went wrong")
+
+	runDue(t, r)
+	got := assertStatus(t, r.Service, st.ID, repo.ScheduledCompleted)
+	if got.LastError != "Bad Request: something went wrong" {
+		t.Fatalf("want the error kept, got: %+v", got)
+	}
+
+	// the first ones aren't called again
+	*now = now.Add(time.Hour)
+	runDue(t, r)
+	assertSent(t, srv, 1)
+}
+
+func TestRunnerGivesUp(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+	r.MaxAttempts = 2
+	r.RetryDelay = time.Minute
+
+	subscribe(t, r.Service, 1)
+	st := saveDue(t, r, *now, "")
+	srv.Fail("sendMessage", 2, 400, "Bad Request: something went wrong")
+
+	runDue(t, r)
+	*now = now.Add(time.Minute)
+	runDue(t, r)
+
+	got := assertStatus(t, r.Service, st.ID, repo.ScheduledFailed)
+	if got.Attempts != 2 {
+		t.Fatalf("attempts - want: 2, got: %d", got.Attempts)
+	}
+}
+
+func TestRunnerPermanentError(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	subscribe(t, r.Service, 1)
+	st := saveDue(t, r, *now, "")
+	srv.Fail("sendMessage", 1, 403, "Forbidden: bot was kicked from the group chat")
+
+	runDue(t, r)
+	got := assertStatus(t, r.Service, st.ID, repo.ScheduledFailed)
+	if got.Attempts != 1 {
+		t.Fatalf("want no retries, got: %+v", got)
+	}
+}
+
+func TestRunnerRecurring(t *testing.T) {
+	ctx := context.TODO()
+	r, srv, now := newTestRunner(t)
+	r.MaxAttempts = 1
+
+	loc, err := r.Service.Settings.Location(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := ParseRule("todo dia às 20:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscribe(t, r.Service, 1)
+	at := rule.Next(*now, loc)
+	st := saveDue(t, r, at, rule.String())
+
+	*now = at
+	runDue(t, r)
+	assertSent(t, srv, 1)
+	got := assertStatus(t, r.Service, st.ID, repo.ScheduledCreated)
+	if want := at.AddDate(0, 0, 1); !got.Time.Equal(want) {
+		t.Fatalf("next time - want: %s, got: %s", want, got.Time)
+	}
+
+	// given up, but still repeats
+	*now = got.Time
+	srv.Fail("sendMessage", 1, 400, "Bad Request: something went wrong")
+	runDue(t, r)
+	got = assertStatus(t, r.Service, st.ID, repo.ScheduledCreated)
+	if want := at.AddDate(0, 0, 2); !got.Time.Equal(want) || got.Attempts != 0 || got.LastError == "" {
+		t.Fatalf("want moved to %s keeping the error, got: %+v", want, got)
+	}
+
+	// missed, but still repeats
+	*now = got.Time.Add(DefaultCatchUp + time.Minute)
+	runDue(t, r)
+	assertSent(t, srv, 1)
+	got = assertStatus(t, r.Service, st.ID, repo.ScheduledCreated)
+	if want := at.AddDate(0, 0, 3); !got.Time.Equal(want) {
+		t.Fatalf("next time - want: %s, got: %s", want, got.Time)
+	}
+}
+
+func TestRunnerRun(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	subscribe(t, r.Service, 1)
+	saveDue(t, r, now.Add(25*time.Second), "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sleep := r.sleep
+	sleeps := 0
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		if d != DefaultInterval {
+			t.Fatalf("sleep - want: %s, got: %s", DefaultInterval, d)
+		}
+		sleeps++
+		if sleeps == 4 {
+			cancel()
+		}
+		return sleep(ctx, d)
+	}
+
+	r.Run(ctx)
+	assertSent(t, srv, 1)
+}
+
+// saveEvent saves an event of #futebol in chat -1 at at, with alice going
+// and its message sent
+func saveEvent(t *testing.T, r *Runner, at time.Time, reminder time.Time) repo.Event {
+	t.Helper()
+	ctx := context.TODO()
+
+	e := repo.Event{
+		ChatID:       -1,
+		UserID:       1,
+		Topic:        "#futebol",
+		Time:         at,
+		MessageID:    20,
+		Status:       repo.EventOpen,
+		NextReminder: reminder,
+	}
+	id, err := r.Service.Repo.SaveEvent(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.ID = id
+
+	_, _, err = r.Service.Answer(ctx, e, repo.User{ID: 1, Username: "alice"}, repo.AnswerYes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func findEvent(t *testing.T, r *Runner, id int64) *repo.Event {
+	t.Helper()
+
+	e, err := r.Service.Repo.FindEvent(context.TODO(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRunnerEventReminders(t *testing.T) {
+	ctx := context.TODO()
+	r, srv, now := newTestRunner(t)
+
+	err := r.Service.Settings.Set(ctx, -1, settings.EventReminders, "24h,1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := now.Add(48 * time.Hour)
+	e := saveEvent(t, r, at, at.Add(-24*time.Hour))
+
+	*now = at.Add(-24 * time.Hour)
+	runDue(t, r)
+	texts := srv.SentTexts()
+	if len(texts) != 2 || texts[0] != "⏰ #futebol começa em 1 dia" || srv.Sent()[1].ReplyToMessageID != 20 {
+		t.Fatalf("want reminder and mention replying the event, got: %q", texts)
+	}
+	if got := findEvent(t, r, e.ID); !got.NextReminder.Equal(at.Add(-time.Hour)) {
+		t.Fatalf("next reminder - want: %s, got: %s", at.Add(-time.Hour), got.NextReminder)
+	}
+
+	// the bot was down at the last one
+	*now = at.Add(-time.Hour + DefaultCatchUp + time.Minute)
+	runDue(t, r)
+	assertSent(t, srv, 2)
+	if got := findEvent(t, r, e.ID); !got.NextReminder.IsZero() || got.Status != repo.EventOpen {
+		t.Fatalf("want open event without reminders, got: %+v", got)
+	}
+}
+
+func TestRunnerClosesEvent(t *testing.T) {
+	r, srv, now := newTestRunner(t)
+
+	at := now.Add(time.Hour)
+	e := saveEvent(t, r, at, time.Time{})
+
+	runDue(t, r)
+	if got := findEvent(t, r, e.ID); got.Status != repo.EventOpen {
+		t.Fatalf("want event open before it starts, got: %+v", got)
+	}
+
+	*now = at
+	runDue(t, r)
+	if got := findEvent(t, r, e.ID); got.Status != repo.EventClosed {
+		t.Fatalf("want event closed, got: %+v", got)
+	}
+
+	// the message is gone from the fake server, it still closes
+	edits := srv.Edits()
+	if len(edits) != 1 || !strings.HasSuffix(edits[0].Text, "encerrado") || edits[0].ReplyMarkup != nil {
+		t.Fatalf("want message closed without buttons, got: %+v", edits)
+	}
+}
@@ -0,0 +1,279 @@
+// Package topic manages the subscriptions of the users of a chat to topics,
+// and mentions the subscribers when a topic is called.
+package topic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/bot"
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+)
+
+const (
+	// MinScheduleDelay is how soon a mention may be scheduled.
+	MinScheduleDelay = time.Minute
+	// MaxScheduleAhead is how far a mention may be scheduled.
+	MaxScheduleAhead = 366 * 24 * time.Hour
+
+	// mentions sent per message
+	mentionsPerMessage = 4
+)
+
+var (
+	ErrScheduleSoon     = errors.New("schedule time is too soon")
+	ErrScheduleLate     = errors.New("schedule time is too far")
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrNewTopic         = errors.New("new topics are disabled")
+)
+
+var (
+	reHashtag = regexp.MustCompile(`#[a-z0-9_]{1,}`)
+	reTopic   = regexp.MustCompile(`^#[a-z0-9_]+$`)
+)
+
+// Service manages the topics over the repository.
+type Service struct {
+	Repo repo.Repo
+	// Settings has the timezones of the chats, which the rules of the
+	// scheduled mentions follow.
+	Settings settings.Service
+}
+
+// Subscribe subscribes user to the topics of chatID. Users are saved as
+// well, to be mentioned by name later. Topics nobody is subscribed to yet
+// are only created if create is set, as for admins, or if the chat enables
+// settings.CreateTopics, otherwise ErrNewTopic is returned.
+func (s Service) Subscribe(ctx context.Context, chatID int64, user repo.User, create bool, topics ...string) error {
+	if !create {
+		err := s.checkNew(ctx, chatID, topics)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.Repo.SaveUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		err = s.Repo.SaveUserTopic(ctx, repo.UserTopic{
+			ChatID: chatID,
+			UserID: user.ID,
+			Topic:  topic,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNew returns ErrNewTopic with the first topic that doesn't exist in
+// chatID, unless the chat lets anyone create topics.
+func (s Service) checkNew(ctx context.Context, chatID int64, topics []string) error {
+	enabled, err := s.Settings.Enabled(ctx, chatID, settings.CreateTopics)
+	if err != nil || enabled {
+		return err
+	}
+
+	for _, topic := range topics {
+		exists, err := s.Repo.ExistsChatTopic(ctx, chatID, topic)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrNewTopic, topic)
+		}
+	}
+	return nil
+}
+
+// Unsubscribe returns how many of the topics userID was subscribed to.
+func (s Service) Unsubscribe(ctx context.Context, chatID int64, userID int64, topics ...string) (int64, error) {
+	var total int64
+	for _, topic := range topics {
+		n, err := s.Repo.DeleteUserTopic(ctx, repo.UserTopic{
+			ChatID: chatID,
+			UserID: userID,
+			Topic:  topic,
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// UserTopics lists the topics of userID, with their subscribers count.
+func (s Service) UserTopics(ctx context.Context, chatID int64, userID int64) ([]repo.UserTopic, error) {
+	return s.Repo.FindUserChatTopics(ctx, chatID, userID)
+}
+
+// ChatTopics lists the topics of chatID, the most subscribed first.
+func (s Service) ChatTopics(ctx context.Context, chatID int64) ([]repo.UserTopic, error) {
+	return s.Repo.FindChatTopics(ctx, chatID)
+}
+
+// Subscribers lists the users subscribed to any of the topics, each once.
+func (s Service) Subscribers(ctx context.Context, chatID int64, topics ...string) ([]repo.User, error) {
+	return s.Repo.FindUsersByTopics(ctx, chatID, topics)
+}
+
+// NewTopics saves the topics as called by the message msgID and returns
+// the ones it hadn't called before, so that its edits call just those.
+func (s Service) NewTopics(ctx context.Context, chatID int64, msgID int, topics []string) ([]string, error) {
+	called, err := s.Repo.FindMessageTopics(ctx, chatID, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, topic := range called {
+		seen[topic] = true
+	}
+	var added []string
+	for _, topic := range topics {
+		if !seen[topic] {
+			seen[topic] = true
+			added = append(added, topic)
+		}
+	}
+
+	err = s.Repo.SaveMessageTopics(ctx, chatID, msgID, added)
+	return added, err
+}
+
+// Schedule saves the mention of st.Topic at st.Time, repeating by st.Rule
+// if set.
+func (s Service) Schedule(ctx context.Context, st repo.ScheduledTopic) (repo.ScheduledTopic, error) {
+	ahead := time.Until(st.Time)
+	if ahead < MinScheduleDelay {
+		return st, ErrScheduleSoon
+	}
+	if ahead > MaxScheduleAhead {
+		return st, ErrScheduleLate
+	}
+
+	st.Status = repo.ScheduledCreated
+	id, err := s.Repo.SaveScheduledTopic(ctx, st)
+	if err != nil {
+		return st, err
+	}
+	st.ID = id
+
+	log.Printf("scheduled topic: id = %d, chat_id = %d, topic = %s, rule = %q, time = %s", st.ID, st.ChatID, st.Topic, st.Rule, st.Time.UTC())
+	return st, nil
+}
+
+// Pending lists the mentions scheduled in chatID, the next first.
+func (s Service) Pending(ctx context.Context, chatID int64) ([]repo.ScheduledTopic, error) {
+	return s.Repo.FindChatScheduledTopics(ctx, chatID)
+}
+
+// FindPending returns ErrScheduleNotFound unless id is pending in chatID.
+func (s Service) FindPending(ctx context.Context, chatID int64, id int64) (repo.ScheduledTopic, error) {
+	st, err := s.Repo.FindScheduledTopic(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return repo.ScheduledTopic{}, ErrScheduleNotFound
+	}
+	if err != nil {
+		return repo.ScheduledTopic{}, err
+	}
+	if st.ChatID != chatID || st.Status != repo.ScheduledCreated {
+		return repo.ScheduledTopic{}, ErrScheduleNotFound
+	}
+	return *st, nil
+}
+
+// Cancel stops the pending mention id of chatID.
+func (s Service) Cancel(ctx context.Context, chatID int64, id int64) (repo.ScheduledTopic, error) {
+	st, err := s.FindPending(ctx, chatID, id)
+	if err != nil {
+		return st, err
+	}
+
+	st.Status = repo.ScheduledCanceled
+	return st, s.Repo.UpdateScheduledTopic(ctx, st)
+}
+
+// mention sends the messages calling the subscribers of st, returning how
+// many were sent before an error.
+func (s Service) mention(ctx context.Context, b bot.Service, st repo.ScheduledTopic) (int, error) {
+	users, err := s.Subscribers(ctx, st.ChatID, st.Topic)
+	if err != nil {
+		return 0, err
+	}
+
+	texts := Mentions(users)
+	for i, text := range texts {
+		_, err = b.SendMessage(ctx, bot.SendMessageParams{
+			ChatID:                   st.ChatID,
+			Text:                     text,
+			ReplyToMessageID:         st.MessageID,
+			AllowSendingWithoutReply: true,
+			ParseMode:                "MarkdownV2",
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(texts), nil
+}
+
+// next is st after its mention at now, or after giving up on it. Mentions
+// that repeat move to their next time, the others end.
+func (s Service) next(ctx context.Context, st repo.ScheduledTopic, now time.Time, failed bool) (repo.ScheduledTopic, error) {
+	if st.Rule == "" {
+		st.Status = repo.ScheduledCompleted
+		if failed {
+			st.Status = repo.ScheduledFailed
+		}
+		return st, nil
+	}
+
+	rule, err := ParseRule(st.Rule)
+	if err != nil {
+		st.Status = repo.ScheduledFailed
+		st.LastError = fmt.Sprintf("invalid rule %q", st.Rule)
+		return st, nil
+	}
+
+	loc, err := s.Settings.Location(ctx, st.ChatID)
+	if err != nil {
+		return st, err
+	}
+	st.Time = rule.Next(now, loc)
+	st.Attempts = 0
+	return st, nil
+}
+
+// Hashtags returns the topics called in text.
+func Hashtags(text string) []string {
+	return reHashtag.FindAllString(text, -1)
+}
+
+// Mentions returns the MarkdownV2 texts mentioning users, a few per
+// message.
+func Mentions(users []repo.User) []string {
+	texts := []string{}
+	text := ""
+	for i, u := range users {
+		text += fmt.Sprintf("[%s](tg://user?id=%d) ", u.Name(), u.ID)
+		if (i+1)%mentionsPerMessage == 0 {
+			texts = append(texts, text)
+			text = ""
+		}
+	}
+	if text != "" {
+		texts = append(texts, text)
+	}
+	return texts
+}
@@ -0,0 +1,241 @@
+package topic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igoracmelo/euperturbot/repo"
+	"github.com/igoracmelo/euperturbot/settings"
+	"github.com/igoracmelo/euperturbot/settings/settingstest"
+)
+
+func newService(t *testing.T) Service {
+	t.Helper()
+
+	s := settingstest.New(t)
+	return Service{Repo: s.Repo, Settings: s}
+}
+
+// schedule saves a mention of #futebol in chat -1 at at
+func schedule(t *testing.T, s Service, at time.Time, rule string) repo.ScheduledTopic {
+	t.Helper()
+
+	st, err := s.Schedule(context.TODO(), repo.ScheduledTopic{
+		ChatID:    -1,
+		MessageID: 10,
+		UserID:    1,
+		Topic:     "#futebol",
+		Rule:      rule,
+		Time:      at,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// subscribe subscribes n users to #futebol in chat -1
+func subscribe(t *testing.T, s Service, n int) {
+	t.Helper()
+
+	for i := int64(1); i <= int64(n); i++ {
+		err := s.Subscribe(context.TODO(), -1, repo.User{ID: i, Username: "user"}, true, "#futebol")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertStatus(t *testing.T, s Service, id int64, want string) *repo.ScheduledTopic {
+	t.Helper()
+
+	st, err := s.Repo.FindScheduledTopic(context.TODO(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != want {
+		t.Fatalf("status - want: %s, got: %s", want, st.Status)
+	}
+	return st
+}
+
+func TestSubscribeAndList(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+
+	alice := repo.User{ID: 1, FirstName: "Alice", Username: "alice"}
+	bob := repo.User{ID: 2, FirstName: "Bob"}
+
+	err := s.Subscribe(ctx, -1, alice, true, "#volei", "#futebol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Subscribe(ctx, -1, bob, true, "#futebol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// other chat
+	err = s.Subscribe(ctx, -2, bob, true, "#volei")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topics, err := s.UserTopics(ctx, -1, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 2 ||
+		topics[0].Topic != "#futebol" || topics[0].Subscribers != 2 ||
+		topics[1].Topic != "#volei" || topics[1].Subscribers != 1 {
+		t.Fatalf("want #futebol (2) and #volei (1), got: %+v", topics)
+	}
+
+	users, err := s.Subscribers(ctx, -1, "#futebol", "#volei")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("want each subscriber once, got: %+v", users)
+	}
+
+	n, err := s.Unsubscribe(ctx, -1, alice.ID, "#volei", "#tenis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want 1 topic removed, got: %d", n)
+	}
+
+	users, err = s.Subscribers(ctx, -1, "#volei")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("want no subscribers, got: %+v", users)
+	}
+}
+
+func TestSubscribeNewTopic(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+	alice := repo.User{ID: 1, FirstName: "Alice"}
+	bob := repo.User{ID: 2, FirstName: "Bob"}
+
+	err := s.Subscribe(ctx, -1, alice, false, "#futebol")
+	if !errors.Is(err, ErrNewTopic) {
+		t.Fatalf("want ErrNewTopic, got: %v", err)
+	}
+
+	err = s.Subscribe(ctx, -1, bob, true, "#futebol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// exists now
+	err = s.Subscribe(ctx, -1, alice, false, "#futebol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Settings.SetEnabled(ctx, -1, settings.CreateTopics, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Subscribe(ctx, -1, alice, false, "#volei")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduleLimits(t *testing.T) {
+	s := newService(t)
+
+	for _, tc := range []struct {
+		at   time.Time
+		want error
+	}{
+		{time.Now().Add(30 * time.Second), ErrScheduleSoon},
+		{time.Now().Add(-time.Hour), ErrScheduleSoon},
+		{time.Now().AddDate(1, 1, 0), ErrScheduleLate},
+	} {
+		_, err := s.Schedule(context.TODO(), repo.ScheduledTopic{ChatID: -1, Topic: "#futebol", Time: tc.at})
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("at %s - err want: %v, got: %v", tc.at, tc.want, err)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+
+	st := schedule(t, s, time.Now().Add(time.Hour), "")
+
+	_, err := s.Cancel(ctx, -2, st.ID)
+	if !errors.Is(err, ErrScheduleNotFound) {
+		t.Fatalf("other chat - err want: %v, got: %v", ErrScheduleNotFound, err)
+	}
+
+	_, err = s.Cancel(ctx, -1, st.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := s.Pending(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("want nothing pending, got: %+v", pending)
+	}
+
+	_, err = s.Cancel(ctx, -1, st.ID)
+	if !errors.Is(err, ErrScheduleNotFound) {
+		t.Fatalf("canceled twice - err want: %v, got: %v", ErrScheduleNotFound, err)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	users := []repo.User{
+		{ID: 1, Username: "a"},
+		{ID: 2, FirstName: "B"},
+		{ID: 3, Username: "c"},
+		{ID: 4, Username: "d"},
+		{ID: 5, Username: "e"},
+	}
+
+	got := Mentions(users)
+	want := []string{
+		"[a](tg://user?id=1) [B](tg://user?id=2) [c](tg://user?id=3) [d](tg://user?id=4) ",
+		"[e](tg://user?id=5) ",
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("want: %q, got: %q", want, got)
+	}
+
+	if got := Mentions(nil); len(got) != 0 {
+		t.Fatalf("want no texts, got: %q", got)
+	}
+}
+
+func TestNewTopics(t *testing.T) {
+	ctx := context.TODO()
+	s := newService(t)
+
+	for _, tc := range []struct {
+		topics []string
+		want   []string
+	}{
+		{[]string{"#futebol"}, []string{"#futebol"}},
+		{[]string{"#futebol", "#volei", "#volei"}, []string{"#volei"}},
+		{[]string{"#volei"}, nil},
+	} {
+		got, err := s.NewTopics(ctx, -1, 10, tc.topics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Fatalf("%v - want: %v, got: %v", tc.topics, tc.want, got)
+		}
+	}
+}
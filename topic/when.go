@@ -0,0 +1,216 @@
+package topic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidWhen = errors.New("invalid schedule time")
+
+var weekdays = [7]struct {
+	short string
+	names []string
+}{
+	time.Sunday:    {"dom", []string{"dom", "domingo"}},
+	time.Monday:    {"seg", []string{"seg", "segunda"}},
+	time.Tuesday:   {"ter", []string{"ter", "terca", "terça"}},
+	time.Wednesday: {"qua", []string{"qua", "quarta"}},
+	time.Thursday:  {"qui", []string{"qui", "quinta"}},
+	time.Friday:    {"sex", []string{"sex", "sexta"}},
+	time.Saturday:  {"sab", []string{"sab", "sabado", "sábado"}},
+}
+
+var (
+	workdays = [7]bool{false, true, true, true, true, true, false}
+	weekend  = [7]bool{true, false, false, false, false, false, true}
+)
+
+// Rule repeats a mention on some days of the week at a time of the day, in
+// the timezone of the chat.
+type Rule struct {
+	Days   [7]bool // by time.Weekday
+	Hour   int
+	Minute int
+}
+
+// ParseRule reads rules like "toda sexta 20:00", "dias úteis às 12:30",
+// "seg, qua e sex 19:00", "todo dia 8:00" or "fim de semana 10:00".
+func ParseRule(text string) (Rule, error) {
+	var r Rule
+
+	fields := strings.Fields(strings.ToLower(strings.NewReplacer(",", " ").Replace(text)))
+	if len(fields) < 2 {
+		return r, ErrInvalidWhen
+	}
+
+	clock, err := time.Parse("15:04", fields[len(fields)-1])
+	if err != nil {
+		return r, ErrInvalidWhen
+	}
+	r.Hour, r.Minute = clock.Hour(), clock.Minute()
+
+	days := []string{}
+	for _, field := range fields[:len(fields)-1] {
+		switch field {
+		case "toda", "todo", "todas", "todos", "às", "as", "e", "a":
+			continue
+		}
+		days = append(days, field)
+	}
+
+	switch strings.Join(days, " ") {
+	case "dia", "dias":
+		r.Days = [7]bool{true, true, true, true, true, true, true}
+		return r, nil
+	case "dias úteis", "dias uteis", "dia útil", "dia util":
+		r.Days = workdays
+		return r, nil
+	case "fim de semana", "fins de semana", "fds":
+		r.Days = weekend
+		return r, nil
+	}
+
+	if len(days) == 0 {
+		return r, ErrInvalidWhen
+	}
+	for _, day := range days {
+		d, ok := parseWeekday(day)
+		if !ok {
+			return r, ErrInvalidWhen
+		}
+		r.Days[d] = true
+	}
+	return r, nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.TrimSuffix(s, "-feira")
+	s = strings.TrimSuffix(s, "-feiras")
+	for d, wd := range weekdays {
+		for _, name := range wd.names {
+			if s == name || s == name+"s" {
+				return time.Weekday(d), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// String is how the rule is stored, read back by ParseRule.
+func (r Rule) String() string {
+	days := []string{}
+	for d, on := range r.Days {
+		if on {
+			days = append(days, weekdays[d].short)
+		}
+	}
+	return fmt.Sprintf("%s %02d:%02d", strings.Join(days, ","), r.Hour, r.Minute)
+}
+
+// Describe is the rule for humans, like "toda sexta às 20:00".
+func (r Rule) Describe() string {
+	clock := fmt.Sprintf("às %02d:%02d", r.Hour, r.Minute)
+
+	days := []string{}
+	for d, on := range r.Days {
+		if on {
+			days = append(days, weekdays[d].names[len(weekdays[d].names)-1])
+		}
+	}
+
+	switch {
+	case len(days) == 7:
+		return "todo dia " + clock
+	case r.Days == workdays:
+		return "dias úteis " + clock
+	case r.Days == weekend:
+		return "fim de semana " + clock
+	case len(days) == 1 && (r.Days[time.Saturday] || r.Days[time.Sunday]):
+		return "todo " + days[0] + " " + clock
+	case len(days) == 1:
+		return "toda " + days[0] + " " + clock
+	}
+	return strings.Join(days[:len(days)-1], ", ") + " e " + days[len(days)-1] + " " + clock
+}
+
+// Next is the first time of the rule after after, in loc.
+func (r Rule) Next(after time.Time, loc *time.Location) time.Time {
+	t := after.In(loc)
+	for i := 0; i <= 7; i++ {
+		next := time.Date(t.Year(), t.Month(), t.Day()+i, r.Hour, r.Minute, 0, 0, loc)
+		if next.After(after) && r.Days[next.Weekday()] {
+			return next
+		}
+	}
+	// unreachable for a rule with any day
+	return time.Time{}
+}
+
+// When is when /agenda mentions the subscribers.
+type When struct {
+	// Delay is set when the user gave a duration.
+	Delay time.Duration
+	// At is the first mention.
+	At time.Time
+	// Rule is set for the mentions that repeat.
+	Rule *Rule
+}
+
+var absoluteLayouts = []string{
+	"2006-01-02 15:04",
+	"02/01/2006 15:04",
+	"2/1/2006 15:04",
+	"02/01 15:04",
+	"2/1 15:04",
+	"15:04",
+}
+
+// ParseWhen reads what users write in /agenda: a duration like "1h30m",
+// a date like "2026-11-02 19:00" or "25/12 19:00", a time of today like
+// "19:00", or a Rule. Dates are in loc.
+func ParseWhen(text string, now time.Time, loc *time.Location) (When, error) {
+	text = strings.TrimSpace(text)
+
+	d, err := time.ParseDuration(text)
+	if err == nil {
+		return When{Delay: d, At: now.Add(d)}, nil
+	}
+
+	local := now.In(loc)
+	for _, layout := range absoluteLayouts {
+		t, err := time.ParseInLocation(layout, text, loc)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case layout == "15:04":
+			// just the time, the next one
+			t = time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+			if !t.After(now) {
+				t = t.AddDate(0, 0, 1)
+			}
+		case !strings.Contains(layout, "2006"):
+			// no year, the next one
+			t = time.Date(local.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+			if !t.After(now) {
+				t = t.AddDate(1, 0, 0)
+			}
+		}
+		return When{At: t}, nil
+	}
+
+	r, err := ParseRule(text)
+	if err != nil {
+		return When{}, err
+	}
+	return When{At: r.Next(now, loc), Rule: &r}, nil
+}
+
+// formatTime shows t in loc, like "sex 24/10 20:00".
+func formatTime(t time.Time, loc *time.Location) string {
+	t = t.In(loc)
+	return weekdays[t.Weekday()].short + " " + t.Format("02/01 15:04")
+}
@@ -0,0 +1,108 @@
+package topic
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, tc := range []struct {
+		text     string
+		stored   string
+		describe string
+	}{
+		{"toda sexta 20:00", "sex 20:00", "toda sexta às 20:00"},
+		{"todas as sextas-feiras às 20:00", "sex 20:00", "toda sexta às 20:00"},
+		{"todo sábado 9:30", "sab 09:30", "todo sábado às 09:30"},
+		{"dias úteis às 12:30", "seg,ter,qua,qui,sex 12:30", "dias úteis às 12:30"},
+		{"todo dia 8:00", "dom,seg,ter,qua,qui,sex,sab 08:00", "todo dia às 08:00"},
+		{"fds 10:00", "dom,sab 10:00", "fim de semana às 10:00"},
+		{"seg, qua e sex 19:00", "seg,qua,sex 19:00", "segunda, quarta e sexta às 19:00"},
+		{"seg,qua,sex 19:00", "seg,qua,sex 19:00", "segunda, quarta e sexta às 19:00"},
+	} {
+		r, err := ParseRule(tc.text)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.text, err)
+		}
+		if r.String() != tc.stored {
+			t.Fatalf("%q stored - want: %q, got: %q", tc.text, tc.stored, r.String())
+		}
+		if r.Describe() != tc.describe {
+			t.Fatalf("%q described - want: %q, got: %q", tc.text, tc.describe, r.Describe())
+		}
+
+		// read back from the database
+		again, err := ParseRule(r.String())
+		if err != nil || again != r {
+			t.Fatalf("%q read back - want: %+v, got: %+v (%v)", tc.text, r, again, err)
+		}
+	}
+
+	for _, text := range []string{"", "20:00", "toda sexta", "toda sexto 20:00", "toda sexta 25:00", "todo 20:00"} {
+		_, err := ParseRule(text)
+		if !errors.Is(err, ErrInvalidWhen) {
+			t.Fatalf("%q - err want: %v, got: %v", text, ErrInvalidWhen, err)
+		}
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a sunday
+	now := time.Date(2026, 10, 18, 15, 0, 0, 0, loc)
+
+	for _, tc := range []struct {
+		text  string
+		at    time.Time
+		delay time.Duration
+		rule  string
+	}{
+		{text: "1h30m", at: now.Add(90 * time.Minute), delay: 90 * time.Minute},
+		{text: "2026-11-02 19:00", at: time.Date(2026, 11, 2, 19, 0, 0, 0, loc)},
+		{text: "02/11/2026 19:00", at: time.Date(2026, 11, 2, 19, 0, 0, 0, loc)},
+		{text: "25/12 19:00", at: time.Date(2026, 12, 25, 19, 0, 0, 0, loc)},
+		// passed this year
+		{text: "1/1 10:00", at: time.Date(2027, 1, 1, 10, 0, 0, 0, loc)},
+		{text: "19:00", at: time.Date(2026, 10, 18, 19, 0, 0, 0, loc)},
+		{text: "10:00", at: time.Date(2026, 10, 19, 10, 0, 0, 0, loc)},
+		{text: "toda sexta 20:00", at: time.Date(2026, 10, 23, 20, 0, 0, 0, loc), rule: "sex 20:00"},
+		{text: "todo domingo 16:00", at: time.Date(2026, 10, 18, 16, 0, 0, 0, loc), rule: "dom 16:00"},
+		{text: "todo domingo 14:00", at: time.Date(2026, 10, 25, 14, 0, 0, 0, loc), rule: "dom 14:00"},
+	} {
+		w, err := ParseWhen(tc.text, now, loc)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.text, err)
+		}
+		if !w.At.Equal(tc.at) || w.Delay != tc.delay {
+			t.Fatalf("%q - want: %s (%s), got: %s (%s)", tc.text, tc.at, tc.delay, w.At, w.Delay)
+		}
+		rule := ""
+		if w.Rule != nil {
+			rule = w.Rule.String()
+		}
+		if rule != tc.rule {
+			t.Fatalf("%q rule - want: %q, got: %q", tc.text, tc.rule, rule)
+		}
+	}
+
+	_, err = ParseWhen("amanhã", now, loc)
+	if !errors.Is(err, ErrInvalidWhen) {
+		t.Fatalf("err - want: %v, got: %v", ErrInvalidWhen, err)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, 10, 23, 23, 0, 0, 0, time.UTC)
+	if got := formatTime(at, loc); got != "sex 23/10 20:00" {
+		t.Fatalf("want: %q, got: %q", "sex 23/10 20:00", got)
+	}
+}
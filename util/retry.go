@@ -1,6 +1,8 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"math"
 	"time"
 )
@@ -9,21 +11,94 @@ type Retry struct {
 	MaxAttempts int
 	DelayFactor int
 	Delay       time.Duration
+	// MaxWait caps the total time waited on errors of RetryAfter, without
+	// limit if zero
+	MaxWait time.Duration
 }
 
-func (r Retry) Do(fn func() error) error {
+// Do calls fn until it succeeds, MaxAttempts is reached or ctx is done.
+// Errors of RetryAfter don't count as attempts, as they only ask to wait,
+// so they are retried while ctx and MaxWait allow.
+func (r Retry) Do(ctx context.Context, fn func() error) error {
 	var err error
+	var waited time.Duration
 
-	for i := 0; i < r.MaxAttempts; i++ {
+	for i := 0; i < r.MaxAttempts; {
 		err = fn()
 		if err == nil {
 			return nil
 		}
 
-		multiplier := int(math.Pow(float64(r.DelayFactor), float64(i)))
-		t := r.Delay * time.Duration(multiplier)
-		time.Sleep(t)
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+
+		var after retryAfterError
+		if errors.As(err, &after) {
+			waited += after.d
+			if r.MaxWait > 0 && waited > r.MaxWait {
+				break
+			}
+			if Sleep(ctx, after.d) != nil {
+				break
+			}
+			continue
+		}
+
+		i++
+		if i == r.MaxAttempts {
+			break
+		}
+
+		d := r.Delay
+		if r.DelayFactor > 1 {
+			d *= time.Duration(math.Pow(float64(r.DelayFactor), float64(i-1)))
+		}
+		if Sleep(ctx, d) != nil {
+			break
+		}
 	}
 
+	var after retryAfterError
+	if errors.As(err, &after) {
+		return after.err
+	}
 	return err
 }
+
+// Permanent wraps err so Retry.Do stops retrying and returns err.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// RetryAfter wraps err so Retry.Do waits d before trying again, instead of
+// its own delay, without counting it as an attempt.
+func RetryAfter(err error, d time.Duration) error {
+	return retryAfterError{err, d}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+type retryAfterError struct {
+	err error
+	d   time.Duration
+}
+
+func (e retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryAfterError) Unwrap() error {
+	return e.err
+}
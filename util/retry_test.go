@@ -0,0 +1,76 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	errFail := errors.New("fail")
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"success after failure", []error{errFail, nil}, 2, nil},
+		{"all attempts fail", []error{errFail, errFail, errFail}, 3, errFail},
+		{"permanent", []error{Permanent(errFail)}, 1, errFail},
+		{"retry after", []error{RetryAfter(errFail, 0), nil}, 2, nil},
+		{"retry after is not an attempt", []error{RetryAfter(errFail, 0), errFail, RetryAfter(errFail, 0), errFail, nil}, 5, nil},
+		{"attempts fail after retry after", []error{errFail, RetryAfter(errFail, 0), errFail, errFail}, 4, errFail},
+	}
+
+	for _, tt := range tests {
+		calls := 0
+		err := Retry{MaxAttempts: 3}.Do(context.Background(), func() error {
+			err := tt.errs[calls]
+			calls++
+			return err
+		})
+
+		if calls != tt.wantCalls {
+			t.Errorf("%s: calls - want: %d, got: %d", tt.name, tt.wantCalls, calls)
+		}
+		if err != tt.wantErr {
+			t.Errorf("%s: err - want: %v, got: %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestRetryAfterMaxWait(t *testing.T) {
+	errFail := errors.New("fail")
+
+	calls := 0
+	err := Retry{MaxAttempts: 1, MaxWait: 3 * time.Millisecond}.Do(context.Background(), func() error {
+		calls++
+		return RetryAfter(errFail, time.Millisecond)
+	})
+
+	// waits 3 times, the 4th would go over
+	if calls != 4 || err != errFail {
+		t.Fatalf("want 4 calls and %v, got %d calls and %v", errFail, calls, err)
+	}
+}
+
+func TestRetryAfterUntilDone(t *testing.T) {
+	errFail := errors.New("fail")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := Retry{MaxAttempts: 1}.Do(ctx, func() error {
+		calls++
+		if calls == 5 {
+			cancel()
+		}
+		return RetryAfter(errFail, time.Millisecond)
+	})
+
+	if calls != 5 || err != errFail {
+		t.Fatalf("want 5 calls and %v, got %d calls and %v", errFail, calls, err)
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -52,3 +53,16 @@ func Debounce(d time.Duration, fn func()) func() {
 		fn()
 	}
 }
+
+// Sleep pauses for d or until ctx is done, returning ctx.Err() in the latter.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}